@@ -28,6 +28,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +39,8 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/labstack/echo/v4"
+
+	"github.com/damongolding/immich-kiosk/utils"
 )
 
 const (
@@ -47,6 +50,9 @@ const (
 	defaultConfigFile = "config.yaml"
 )
 
+// ErrAccountNotFound is returned when the selected account is not in the config
+var ErrAccountNotFound = errors.New("account not found")
+
 type KioskSettings struct {
 	// Port which port to use
 	Port int `mapstructure:"port" default:"3000"`
@@ -69,14 +75,68 @@ type KioskSettings struct {
 	// Password the password used to add authentication to the frontend
 	Password string `mapstructure:"password" default:""`
 
+	// AdminPassword the password for the /admin dashboard. Empty disables the dashboard
+	AdminPassword string `mapstructure:"admin_password" default:""`
+
+	// APIToken the bearer token for the remote control api. Empty disables the api
+	APIToken string `mapstructure:"api_token" default:""`
+
 	// AssetWeighting use weighting when picking assets
 	AssetWeighting bool `mapstructure:"asset_weighting" default:"true"`
 
+	// DiskCacheDir directory to keep images in so they survive restarts. Empty disables the disk cache
+	DiskCacheDir string `mapstructure:"disk_cache_dir" default:""`
+
+	// DiskCacheSize the maximum size of the disk cache in MB
+	DiskCacheSize int `mapstructure:"disk_cache_size" default:"500"`
+
+	// AssetURLs serve images from short-lived signed urls instead of inlining them as base64 data
+	AssetURLs bool `mapstructure:"asset_urls" default:"false"`
+
+	// MQTT connection to an MQTT broker, e.g. for Home Assistant
+	MQTT MQTTSettings `mapstructure:"mqtt"`
+
 	// debug modes
 	Debug        bool `mapstructure:"debug" default:"false"`
 	DebugVerbose bool `mapstructure:"debug_verbose" default:"false"`
 }
 
+// MQTTSettings connection to an MQTT broker. Devices are published with Home Assistant discovery
+type MQTTSettings struct {
+	// Broker url of the broker, e.g. tcp://192.168.0.123:1883. Empty disables MQTT
+	Broker string `mapstructure:"broker" default:""`
+	// Username and Password to connect to the broker with
+	Username string `mapstructure:"username" default:""`
+	Password string `mapstructure:"password" default:""`
+	// ClientID id used to connect to the broker
+	ClientID string `mapstructure:"client_id" default:"immich-kiosk"`
+	// Topic prefix of the state and command topics
+	Topic string `mapstructure:"topic" default:"immich-kiosk"`
+	// DiscoveryPrefix Home Assistant discovery prefix
+	DiscoveryPrefix string `mapstructure:"discovery_prefix" default:"homeassistant"`
+}
+
+// ImmichAccount a named Immich account that can be selected with the account query
+type ImmichAccount struct {
+	// ImmichUrl Immich base url for this account
+	ImmichUrl string `mapstructure:"immich_url"`
+	// ImmichApiKey Immich key to access this account's assets
+	ImmichApiKey string `mapstructure:"immich_api_key"`
+}
+
+// Weather providers
+const (
+	WeatherProviderOpenWeatherMap = "openweathermap"
+	WeatherProviderOpenMeteo      = "open-meteo"
+	WeatherProviderMetNo          = "met.no"
+	WeatherProviderJSON           = "json"
+
+	// MaxForecastDays longest daily forecast
+	MaxForecastDays = 7
+	// MaxForecastHours longest hourly forecast
+	MaxForecastHours = 24
+)
+
 type WeatherLocation struct {
 	Name string `mapstructure:"name"`
 	Lat  string `mapstructure:"lat"`
@@ -84,6 +144,14 @@ type WeatherLocation struct {
 	API  string `mapstructure:"api"`
 	Unit string `mapstructure:"unit"`
 	Lang string `mapstructure:"lang"`
+	// Provider where the weather comes from. Empty uses OpenWeatherMap
+	Provider string `mapstructure:"provider"`
+	// URL endpoint of the json provider
+	URL string `mapstructure:"url"`
+	// ForecastLength number of days, or hours with ForecastHourly, shown in the forecast. 0 hides the forecast
+	ForecastLength int `mapstructure:"forecast"`
+	// ForecastHourly show an hourly forecast instead of a daily one
+	ForecastHourly bool `mapstructure:"forecast_hourly"`
 }
 
 // Config represents the main configuration structure for the Immich Kiosk application.
@@ -107,15 +175,29 @@ type Config struct {
 	mu *sync.Mutex
 	// ReloadTimeStamp timestamp for when the last client reload was called for
 	ReloadTimeStamp string
+	// ActiveSchedule name of the schedule entry applied to this config
+	ActiveSchedule string
+	// sleepWindows parsed SleepWindows
+	sleepWindows []utils.SleepWindow
 	// configLastModTime stores the last modification time of the configuration file
 	configLastModTime time.Time
 	// configHash stores the SHA-256 hash of the configuration file
 	configHash string
+	// onReload called after the config file has been reloaded
+	onReload func()
+	// profiles named settings read from the profiles section of the config file
+	profiles map[string]profile
 
 	// ImmichApiKey Immich key to access assets
 	ImmichApiKey string `mapstructure:"immich_api_key" default:""`
 	// ImmichUrl Immuch base url
 	ImmichUrl string `mapstructure:"immich_url" default:""`
+	// Accounts additional named Immich accounts
+	Accounts map[string]ImmichAccount `mapstructure:"accounts"`
+	// Account name of the account from Accounts to use. Empty uses ImmichUrl and ImmichApiKey
+	Account string `mapstructure:"account" query:"account" form:"account" default:"" lowercase:"true"`
+	// Profile name of the profile from the profiles section of the config file to apply on top of the base config
+	Profile string `mapstructure:"profile" query:"profile" form:"profile" default:"" lowercase:"true"`
 
 	// DisableUi a shortcut to disable ShowTime, ShowDate, ShowImageTime and ShowImageDate
 	DisableUi bool `mapstructure:"disable_ui" query:"disable_ui" form:"disable_ui" default:"false"`
@@ -148,13 +230,39 @@ type Config struct {
 	SleepStart string `mapstructure:"sleep_start" query:"sleep_start" form:"sleep_start" default:""`
 	// SleepEnd when to exit sleep mode
 	SleepEnd string `mapstructure:"sleep_end" query:"sleep_end" form:"sleep_end" default:""`
+	// SleepWindows more windows to sleep during, optionally limited to some days
+	SleepWindows []SleepWindow `mapstructure:"sleep_windows" default:"[]"`
 
 	// ShowArchived allow archived image to be displayed
 	ShowArchived bool `mapstructure:"show_archived" query:"show_archived" form:"show_archived" default:"false"`
+	// ShowVideos allow video assets to be displayed
+	ShowVideos bool `mapstructure:"show_videos" query:"show_videos" form:"show_videos" default:"false"`
 	// Person ID of person to display
 	Person []string `mapstructure:"person" query:"person" form:"person" default:"[]"`
 	// Album ID of album(s) to display
 	Album []string `mapstructure:"album" query:"album" form:"album" default:"[]"`
+	// Tag ID, value or name of tag(s) to display
+	Tag []string `mapstructure:"tag" query:"tag" form:"tag" default:"[]"`
+	// ExcludeAlbum ID of album(s) whose assets should never be displayed
+	ExcludeAlbum []string `mapstructure:"exclude_album" query:"exclude_album" form:"exclude_album" default:"[]"`
+	// ExcludePerson ID of person(s) whose assets should never be displayed
+	ExcludePerson []string `mapstructure:"exclude_person" query:"exclude_person" form:"exclude_person" default:"[]"`
+	// ExcludeAsset ID of asset(s) that should never be displayed
+	ExcludeAsset []string `mapstructure:"exclude_asset" query:"exclude_asset" form:"exclude_asset" default:"[]"`
+	// Search text prompt(s) used to find assets with Immich's smart search
+	Search []string `mapstructure:"search" query:"search" form:"search" default:"[]"`
+	// DateRange date range(s) of assets to display. YYYY-MM-DD_YYYY-MM-DD
+	DateRange []string `mapstructure:"date_range" query:"date_range" form:"date_range" default:"[]"`
+	// City city (or cities) of assets to display
+	City []string `mapstructure:"city" query:"city" form:"city" default:"[]"`
+	// State state(s) of assets to display
+	State []string `mapstructure:"state" query:"state" form:"state" default:"[]"`
+	// Country country (or countries) of assets to display
+	Country []string `mapstructure:"country" query:"country" form:"country" default:"[]"`
+	// CameraMake camera make(s) of assets to display
+	CameraMake []string `mapstructure:"camera_make" query:"camera_make" form:"camera_make" default:"[]"`
+	// CameraModel camera model(s) of assets to display
+	CameraModel []string `mapstructure:"camera_model" query:"camera_model" form:"camera_model" default:"[]"`
 
 	// ImageFit the fit style for main image
 	ImageFit string `mapstructure:"image_fit" query:"image_fit" form:"image_fit" default:"contain" lowercase:"true"`
@@ -162,6 +270,8 @@ type Config struct {
 	ImageEffect string `mapstructure:"image_effect" query:"image_effect" form:"image_effect" default:"" lowercase:"true"`
 	// ImageEffectAmount the amount of effect to apply
 	ImageEffectAmount int `mapstructure:"image_effect_amount" query:"image_effect_amount" form:"image_effect_amount" default:"120"`
+	// LivePhotos play the motion clip of live photos over the image. none|once|loop
+	LivePhotos string `mapstructure:"live_photos" query:"live_photos" form:"live_photos" default:"" lowercase:"true"`
 	// UseOriginalImage use the original image
 	UseOriginalImage bool `mapstructure:"use_original_image" query:"use_original_image" form:"use_original_image" default:"false"`
 	// BackgroundBlur whether to display blurred image as background
@@ -199,6 +309,12 @@ type Config struct {
 
 	WeatherLocations []WeatherLocation `mapstructure:"weather" default:"[]"`
 
+	// SelectionRules make albums and people more likely to be picked while the weather or time of day matches
+	SelectionRules []SelectionRule `mapstructure:"selection_rules" default:"[]"`
+
+	// Schedule changes albums, people, layout, theme and refresh during windows of time
+	Schedule []ScheduleEntry `mapstructure:"schedule" default:"[]"`
+
 	// Kiosk settings that are unable to be changed via URL queries
 	Kiosk KioskSettings `mapstructure:"kiosk"`
 
@@ -244,9 +360,20 @@ func bindEnvironmentVariables(v *viper.Viper) error {
 		{"kiosk.fetched_assets_size", "KIOSK_FETCHED_ASSETS_SIZE"},
 		{"kiosk.http_timeout", "KIOSK_HTTP_TIMEOUT"},
 		{"kiosk.password", "KIOSK_PASSWORD"},
+		{"kiosk.admin_password", "KIOSK_ADMIN_PASSWORD"},
+		{"kiosk.api_token", "KIOSK_API_TOKEN"},
 		{"kiosk.cache", "KIOSK_CACHE"},
 		{"kiosk.prefetch", "KIOSK_PREFETCH"},
 		{"kiosk.asset_weighting", "KIOSK_ASSET_WEIGHTING"},
+		{"kiosk.asset_urls", "KIOSK_ASSET_URLS"},
+		{"kiosk.disk_cache_dir", "KIOSK_DISK_CACHE_DIR"},
+		{"kiosk.disk_cache_size", "KIOSK_DISK_CACHE_SIZE"},
+		{"kiosk.mqtt.broker", "KIOSK_MQTT_BROKER"},
+		{"kiosk.mqtt.username", "KIOSK_MQTT_USERNAME"},
+		{"kiosk.mqtt.password", "KIOSK_MQTT_PASSWORD"},
+		{"kiosk.mqtt.client_id", "KIOSK_MQTT_CLIENT_ID"},
+		{"kiosk.mqtt.topic", "KIOSK_MQTT_TOPIC"},
+		{"kiosk.mqtt.discovery_prefix", "KIOSK_MQTT_DISCOVERY_PREFIX"},
 		{"kiosk.debug", "KIOSK_DEBUG"},
 		{"kiosk.debug_verbose", "KIOSK_DEBUG_VERBOSE"},
 	}
@@ -351,6 +478,43 @@ func (c *Config) checkLowercaseTaggedFields() {
 	}
 }
 
+// checkAccounts checks each named account has a url and API key, and adds http:// to
+// account urls without a scheme. Accounts missing required fields are removed.
+func (c *Config) checkAccounts() {
+	for name, account := range c.Accounts {
+		if account.ImmichUrl == "" || account.ImmichApiKey == "" {
+			log.Warn("Account is missing immich_url or immich_api_key. Ignoring this account.", "account", name)
+			delete(c.Accounts, name)
+			continue
+		}
+
+		if !strings.HasPrefix(strings.ToLower(account.ImmichUrl), "http://") && !strings.HasPrefix(strings.ToLower(account.ImmichUrl), "https://") {
+			account.ImmichUrl = defaultScheme + account.ImmichUrl
+			c.Accounts[name] = account
+		}
+	}
+}
+
+// useAccount swaps ImmichUrl and ImmichApiKey for those of the selected account.
+// Account names are case-insensitive. An empty Account keeps the default account.
+func (c *Config) useAccount() error {
+	if c.Account == "" {
+		return nil
+	}
+
+	c.Account = strings.ToLower(c.Account)
+
+	account, ok := c.Accounts[c.Account]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAccountNotFound, c.Account)
+	}
+
+	c.ImmichUrl = account.ImmichUrl
+	c.ImmichApiKey = account.ImmichApiKey
+
+	return nil
+}
+
 // checkRequiredFields check is required config files are set.
 func (c *Config) checkRequiredFields() {
 	switch {
@@ -367,7 +531,7 @@ func (c *Config) checkDebuging() {
 	}
 }
 
-// checkAlbumAndPerson validates and cleans up the Album and Person slices in the Config.
+// checkAlbumAndPerson validates and cleans up the Album, Person, Tag and Search slices in the Config.
 // It removes any empty strings or placeholder values ("ALBUM_ID" or "PERSON_ID"),
 // and trims whitespace from the remaining values.
 func (c *Config) checkAlbumAndPerson() {
@@ -386,31 +550,119 @@ func (c *Config) checkAlbumAndPerson() {
 		}
 	}
 	c.Person = newPerson
+
+	newTag := []string{}
+	for _, tag := range c.Tag {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			newTag = append(newTag, tag)
+		}
+	}
+	c.Tag = newTag
+
+	newSearch := []string{}
+	for _, search := range c.Search {
+		if search = strings.TrimSpace(search); search != "" {
+			newSearch = append(newSearch, search)
+		}
+	}
+	c.Search = newSearch
+}
+
+// checkSearchFilters cleans up the date range, location filter and exclusion slices in the Config.
+// It removes any empty strings and trims whitespace from the remaining values.
+// Malformed date ranges are ignored.
+func (c *Config) checkSearchFilters() {
+	for _, filter := range []*[]string{&c.DateRange, &c.City, &c.State, &c.Country, &c.CameraMake, &c.CameraModel, &c.ExcludeAlbum, &c.ExcludePerson, &c.ExcludeAsset} {
+		newFilter := []string{}
+		for _, value := range *filter {
+			if value = strings.TrimSpace(value); value != "" {
+				newFilter = append(newFilter, value)
+			}
+		}
+		*filter = newFilter
+	}
+
+	c.DateRange = slices.DeleteFunc(c.DateRange, func(dateRange string) bool {
+		if _, err := utils.ParseDateRange(dateRange); err != nil {
+			log.Warn("Invalid date range. Ignoring this date range.", "err", err)
+			return true
+		}
+		return false
+	})
+}
+
+// ClearSources removes every source of assets: albums, people, tags, searches and the date,
+// location and camera filters. Used before the sources are replaced as a whole.
+func (c *Config) ClearSources() {
+	c.Album = []string{}
+	c.Person = []string{}
+	c.Tag = []string{}
+	c.Search = []string{}
+	c.DateRange = []string{}
+	c.City = []string{}
+	c.State = []string{}
+	c.Country = []string{}
+	c.CameraMake = []string{}
+	c.CameraModel = []string{}
 }
 
 // checkWeatherLocations validates the WeatherLocations in the Config.
-// It checks each WeatherLocation for required fields (name, latitude, longitude, and API key),
+// It checks each WeatherLocation has a known provider and the fields that provider needs
+// (name, plus latitude and longitude for the forecast apis, an API key for OpenWeatherMap and a url for json),
 // and logs an error message if any required fields are missing.
 func (c *Config) checkWeatherLocations() {
 	for i := 0; i < len(c.WeatherLocations); i++ {
-		w := c.WeatherLocations[i]
+		w := &c.WeatherLocations[i]
+
+		w.Provider = strings.ToLower(strings.TrimSpace(w.Provider))
+		if w.Provider == "" {
+			w.Provider = WeatherProviderOpenWeatherMap
+		}
+
+		switch w.Provider {
+		case WeatherProviderOpenWeatherMap, WeatherProviderOpenMeteo, WeatherProviderMetNo, WeatherProviderJSON:
+		default:
+			log.Warn("Weather location has an unknown provider. Ignoring this location.", "provider", w.Provider, "name", w.Name)
+			c.WeatherLocations = append(c.WeatherLocations[:i], c.WeatherLocations[i+1:]...)
+			i--
+			continue
+		}
+
 		missingFields := []string{}
 		if w.Name == "" {
 			missingFields = append(missingFields, "name")
 		}
-		if w.Lat == "" {
+		// the json provider gets its weather from its url, so has no need for coordinates
+		if w.Lat == "" && w.Provider != WeatherProviderJSON {
 			missingFields = append(missingFields, "latitude")
 		}
-		if w.Lon == "" {
+		if w.Lon == "" && w.Provider != WeatherProviderJSON {
 			missingFields = append(missingFields, "longitude")
 		}
-		if w.API == "" {
+		if w.API == "" && w.Provider == WeatherProviderOpenWeatherMap {
 			missingFields = append(missingFields, "API key")
 		}
+		if w.URL == "" && w.Provider == WeatherProviderJSON {
+			missingFields = append(missingFields, "url")
+		}
 		if len(missingFields) > 0 {
 			log.Warn("Weather location is missing required fields. Ignoring this location.", "missing fields", strings.Join(missingFields, ", "), "name", w.Name)
 			c.WeatherLocations = append(c.WeatherLocations[:i], c.WeatherLocations[i+1:]...)
 			i--
+			continue
+		}
+
+		maxForecast := MaxForecastDays
+		if w.ForecastHourly {
+			maxForecast = MaxForecastHours
+		}
+
+		switch {
+		case w.ForecastLength < 0:
+			w.ForecastLength = 0
+		case w.ForecastLength > maxForecast:
+			log.Warn("Weather forecast is too long, shortening it", "name", w.Name, "forecast", w.ForecastLength, "max", maxForecast)
+			w.ForecastLength = maxForecast
 		}
 	}
 }
@@ -528,9 +780,21 @@ func (c *Config) reloadConfig(reason string) {
 		return
 	}
 
+	onReload := c.onReload
+
 	*c = *newConfig
 
+	c.onReload = onReload
 	c.updateConfigState()
+
+	if onReload != nil {
+		go onReload()
+	}
+}
+
+// OnReload sets a func to call after the config file has been reloaded.
+func (c *Config) OnReload(f func()) {
+	c.onReload = f
 }
 
 // updateConfigState updates the configuration state after a reload.
@@ -579,12 +843,28 @@ func (c *Config) Load() error {
 	c.checkRequiredFields()
 	c.checkLowercaseTaggedFields()
 	c.checkAlbumAndPerson()
+	c.checkSearchFilters()
 	c.checkUrlScheme()
+	c.checkAccounts()
+	c.checkProfiles()
 	c.checkHideCountries()
 	c.checkWeatherLocations()
+	c.checkSelectionRules()
+	c.checkSchedule()
+	c.checkSleepWindows()
 	c.checkDebuging()
 	c.checkFetchedAssetsSize()
 
+	if err := c.useAccount(); err != nil {
+		log.Error("Selecting account", "err", err)
+		c.Account = ""
+	}
+
+	if _, ok := c.profiles[c.Profile]; c.Profile != "" && !ok {
+		log.Error("Selecting profile", "err", fmt.Errorf("%w: %s", ErrProfileNotFound, c.Profile))
+		c.Profile = ""
+	}
+
 	return nil
 }
 
@@ -593,6 +873,18 @@ func (c *Config) ConfigWithOverrides(e echo.Context) error {
 
 	queries := e.QueryParams()
 
+	// the schedule is applied first, so profiles and queries can change the schedule's settings
+	c.useSchedule(time.Now())
+
+	// the profile is applied before queries, so queries can change the profile's settings
+	if profileName := e.FormValue("profile"); profileName != "" {
+		c.Profile = profileName
+	}
+
+	if err := c.useProfile(); err != nil {
+		return err
+	}
+
 	// check for person or album in quries and empty baseconfig slice if found
 	if queries.Has("person") {
 		c.Person = []string{}
@@ -602,11 +894,71 @@ func (c *Config) ConfigWithOverrides(e echo.Context) error {
 		c.Album = []string{}
 	}
 
+	if queries.Has("tag") {
+		c.Tag = []string{}
+	}
+
+	if queries.Has("search") {
+		c.Search = []string{}
+	}
+
+	// same for date range and location filters
+	if queries.Has("date_range") {
+		c.DateRange = []string{}
+	}
+
+	if queries.Has("city") {
+		c.City = []string{}
+	}
+
+	if queries.Has("state") {
+		c.State = []string{}
+	}
+
+	if queries.Has("country") {
+		c.Country = []string{}
+	}
+
+	if queries.Has("camera_make") {
+		c.CameraMake = []string{}
+	}
+
+	if queries.Has("camera_model") {
+		c.CameraModel = []string{}
+	}
+
+	// exclusions from the base config are always kept, exclusions from queries are added to them
+	excludeAlbum := c.ExcludeAlbum
+	excludePerson := c.ExcludePerson
+	excludeAsset := c.ExcludeAsset
+
 	err := e.Bind(c)
 	if err != nil {
 		return err
 	}
 
+	if err := c.useAccount(); err != nil {
+		return err
+	}
+
+	// POST requests send their params in the form body, which Bind reads as well as the queries
+	formParams, err := e.FormParams()
+	if err != nil {
+		formParams = queries
+	}
+
+	if formParams.Has("exclude_album") {
+		c.ExcludeAlbum = slices.Concat(excludeAlbum, c.ExcludeAlbum)
+	}
+
+	if formParams.Has("exclude_person") {
+		c.ExcludePerson = slices.Concat(excludePerson, c.ExcludePerson)
+	}
+
+	if formParams.Has("exclude_asset") {
+		c.ExcludeAsset = slices.Concat(excludeAsset, c.ExcludeAsset)
+	}
+
 	return nil
 
 }
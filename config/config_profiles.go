@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// ErrProfileNotFound is returned when the selected profile is not in the config
+var ErrProfileNotFound = errors.New("profile not found")
+
+// profile a named set of settings applied on top of the base config
+type profile struct {
+	// settings holds the values set by the profile
+	settings Config
+	// fields indexes of the Config fields set by the profile
+	fields []int
+}
+
+// profileFields maps the yaml key of each setting that can be set in a profile to its Config field index.
+// Only settings that can be changed via URL can be set in a profile.
+func profileFields() map[string]int {
+	typ := reflect.TypeOf(Config{})
+	fields := make(map[string]int)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key := field.Tag.Get("mapstructure")
+
+		if key == "" || key == "profile" || field.Tag.Get("query") == "" {
+			continue
+		}
+
+		fields[key] = i
+	}
+
+	return fields
+}
+
+// parseProfile reads the named profile from the config file.
+func (c *Config) parseProfile(name string) (profile, error) {
+	sub := c.V.Sub("profiles." + name)
+	if sub == nil {
+		return profile{}, errors.New("profile must be a map of settings")
+	}
+
+	allowed := profileFields()
+
+	p := profile{}
+
+	for _, key := range sub.AllKeys() {
+		i, ok := allowed[key]
+		if !ok {
+			return profile{}, fmt.Errorf("%s can not be set in a profile", key)
+		}
+		p.fields = append(p.fields, i)
+	}
+
+	if err := sub.Unmarshal(&p.settings); err != nil {
+		return profile{}, err
+	}
+
+	p.settings.checkLowercaseTaggedFields()
+	p.settings.checkAlbumAndPerson()
+	p.settings.checkSearchFilters()
+
+	return p, nil
+}
+
+// checkProfiles reads the profiles from the config file. Profiles with unknown
+// or unsupported settings are ignored.
+func (c *Config) checkProfiles() {
+	c.profiles = make(map[string]profile)
+
+	for name := range c.V.GetStringMap("profiles") {
+		p, err := c.parseProfile(name)
+		if err != nil {
+			log.Warn("Invalid profile. Ignoring this profile.", "profile", name, "err", err)
+			continue
+		}
+		c.profiles[strings.ToLower(name)] = p
+	}
+}
+
+// useProfile applies the settings of the selected profile. Exclusions are added to those
+// already set, so exclusions in the base config are always kept.
+// An empty Profile keeps the base config.
+func (c *Config) useProfile() error {
+	if c.Profile == "" {
+		return nil
+	}
+
+	c.Profile = strings.ToLower(c.Profile)
+
+	p, ok := c.profiles[c.Profile]
+	if !ok {
+		return fmt.Errorf("%w: %s. Available profiles: %s", ErrProfileNotFound, c.Profile, strings.Join(c.profileNames(), ", "))
+	}
+
+	val := reflect.ValueOf(c).Elem()
+	settings := reflect.ValueOf(p.settings)
+
+	for _, i := range p.fields {
+		field := val.Field(i)
+		value := settings.Field(i)
+
+		switch {
+		case strings.HasPrefix(val.Type().Field(i).Tag.Get("mapstructure"), "exclude_"):
+			value = reflect.ValueOf(slices.Concat(field.Interface().([]string), value.Interface().([]string)))
+		case value.Kind() == reflect.Slice:
+			// copy so requests never share the profile's slices
+			value = reflect.AppendSlice(reflect.MakeSlice(value.Type(), 0, value.Len()), value)
+		}
+
+		field.Set(value)
+	}
+
+	return nil
+}
+
+// profileNames returns the names of the profiles in the config.
+func (c *Config) profileNames() []string {
+	names := make([]string, 0, len(c.profiles))
+	for name := range c.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/utils"
+)
+
+// ScheduleEntry changes what is shown, and how, during a window of time.
+// Settings left empty keep their value from the base config.
+type ScheduleEntry struct {
+	// Name identifies the entry in logs. Defaults to the position of the entry in the schedule
+	Name string `mapstructure:"name"`
+	// Days the window opens on, e.g. mon-fri or weekends. Empty opens every day
+	Days []string `mapstructure:"days"`
+	// Start when the window opens. Leave start and end empty to use the whole day
+	Start string `mapstructure:"start"`
+	// End when the window closes. An end before the start crosses midnight
+	End string `mapstructure:"end"`
+	// Priority decides which entry is used when windows overlap. Higher wins
+	Priority int `mapstructure:"priority"`
+	// Album albums to display. Replaces every source of the base config
+	Album []string `mapstructure:"album"`
+	// Person people to display. Replaces every source of the base config
+	Person []string `mapstructure:"person"`
+	// Layout which layout to use
+	Layout string `mapstructure:"layout"`
+	// Theme which theme to use
+	Theme string `mapstructure:"theme"`
+	// Refresh time between fetching new image
+	Refresh int `mapstructure:"refresh"`
+
+	// weekdays parsed Days
+	weekdays []time.Weekday
+}
+
+// checkSchedule normalises the schedule and ignores entries that can never be used:
+// entries that change nothing, or with invalid days or times.
+func (c *Config) checkSchedule() {
+	schedule := c.Schedule[:0]
+
+	for i, entry := range c.Schedule {
+		if entry.Name == "" {
+			entry.Name = fmt.Sprintf("schedule %d", i+1)
+		}
+
+		if checkScheduleEntry(&entry) {
+			schedule = append(schedule, entry)
+		}
+	}
+
+	c.Schedule = schedule
+}
+
+// checkScheduleEntry normalises entry and reports whether it can be used.
+func checkScheduleEntry(entry *ScheduleEntry) bool {
+	entry.Album = trimIDs(entry.Album)
+	entry.Person = trimIDs(entry.Person)
+	entry.Layout = strings.ToLower(strings.TrimSpace(entry.Layout))
+	entry.Theme = strings.ToLower(strings.TrimSpace(entry.Theme))
+
+	if len(entry.Album) == 0 && len(entry.Person) == 0 && entry.Layout == "" && entry.Theme == "" && entry.Refresh <= 0 {
+		log.Warn("Schedule entry changes nothing. Ignoring this entry.", "schedule", entry.Name)
+		return false
+	}
+
+	weekdays, err := utils.ParseWeekdays(entry.Days)
+	if err != nil {
+		log.Warn("Schedule entry has invalid days. Ignoring this entry.", "schedule", entry.Name, "err", err)
+		return false
+	}
+	entry.weekdays = weekdays
+
+	if entry.Start == "" && entry.End == "" {
+		return true
+	}
+
+	if err := utils.ValidTimeWindow(entry.Start, entry.End); err != nil {
+		log.Warn("Schedule entry has an invalid time. Ignoring this entry.", "schedule", entry.Name, "err", err)
+		return false
+	}
+
+	return true
+}
+
+// trimIDs trims whitespace from ids and removes empty ones.
+func trimIDs(ids []string) []string {
+	trimmed := []string{}
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			trimmed = append(trimmed, id)
+		}
+	}
+	return trimmed
+}
+
+// active reports whether the window of the entry is open at now.
+func (entry ScheduleEntry) active(now time.Time) bool {
+	if entry.Start == "" && entry.End == "" {
+		return len(entry.weekdays) == 0 || slices.Contains(entry.weekdays, now.Weekday())
+	}
+
+	active, _ := utils.InTimeWindow(entry.Start, entry.End, entry.weekdays, now)
+	return active
+}
+
+// activeScheduleEntry returns the schedule entry in use at now. When windows overlap the entry
+// with the highest priority is used, and entries with the same priority in the order they are listed.
+func (c *Config) activeScheduleEntry(now time.Time) (ScheduleEntry, bool) {
+	var (
+		active ScheduleEntry
+		found  bool
+	)
+
+	for _, entry := range c.Schedule {
+		if !entry.active(now) {
+			continue
+		}
+
+		if !found || entry.Priority > active.Priority {
+			active = entry
+			found = true
+		}
+	}
+
+	return active, found
+}
+
+// ActiveScheduleName returns the name of the schedule entry in use at now, or an empty string
+// when no entry is in use.
+func (c *Config) ActiveScheduleName(now time.Time) string {
+	entry, ok := c.activeScheduleEntry(now)
+	if !ok {
+		return ""
+	}
+
+	return entry.Name
+}
+
+// useSchedule applies the settings of the schedule entry in use at now.
+func (c *Config) useSchedule(now time.Time) {
+	entry, ok := c.activeScheduleEntry(now)
+	if !ok {
+		c.ActiveSchedule = ""
+		return
+	}
+
+	c.ActiveSchedule = entry.Name
+
+	if len(entry.Album) > 0 || len(entry.Person) > 0 {
+		c.ClearSources()
+		c.Album = slices.Clone(entry.Album)
+		c.Person = slices.Clone(entry.Person)
+	}
+
+	if entry.Layout != "" {
+		c.Layout = entry.Layout
+	}
+
+	if entry.Theme != "" {
+		c.Theme = entry.Theme
+	}
+
+	if entry.Refresh > 0 {
+		c.Refresh = entry.Refresh
+	}
+}
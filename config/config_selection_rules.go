@@ -0,0 +1,92 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// TimeOfDayDay between sunrise and sunset
+	TimeOfDayDay = "day"
+	// TimeOfDayNight before sunrise or after sunset
+	TimeOfDayNight = "night"
+
+	// defaultSelectionBoost how much more likely sources of a rule are picked when no boost is set
+	defaultSelectionBoost = 5
+)
+
+// SelectionRule makes albums and people more likely to be picked while the weather or time of day matches.
+// A rule with no weather and no time of day always matches.
+type SelectionRule struct {
+	// Album albums to boost. They are added to the albums of the request while the rule matches
+	Album []string `mapstructure:"album"`
+	// Person people to boost. They are added to the people of the request while the rule matches
+	Person []string `mapstructure:"person"`
+	// Weather conditions that match, e.g. snow or rain. Empty matches any weather
+	Weather []string `mapstructure:"weather"`
+	// TimeOfDay day or night, using the sunrise and sunset of the weather location. Empty matches any time
+	TimeOfDay string `mapstructure:"time_of_day"`
+	// WeatherLocation name of the weather location to check. Empty uses the first weather location
+	WeatherLocation string `mapstructure:"weather_location"`
+	// Boost how many times more likely the albums and people are picked
+	Boost int `mapstructure:"boost"`
+}
+
+// checkSelectionRules normalises the selection rules and ignores rules that can never be used:
+// rules without albums or people, with an unknown time of day, or that need weather that is not configured.
+func (c *Config) checkSelectionRules() {
+	rules := c.SelectionRules[:0]
+
+	for _, rule := range c.SelectionRules {
+		if c.checkSelectionRule(&rule) {
+			rules = append(rules, rule)
+		}
+	}
+
+	c.SelectionRules = rules
+}
+
+// checkSelectionRule normalises rule and reports whether it can be used.
+func (c *Config) checkSelectionRule(rule *SelectionRule) bool {
+	if len(rule.Album) == 0 && len(rule.Person) == 0 {
+		log.Warn("Selection rule has no album or person. Ignoring this rule.", "weather", rule.Weather, "time_of_day", rule.TimeOfDay)
+		return false
+	}
+
+	for i, condition := range rule.Weather {
+		rule.Weather[i] = strings.ToLower(strings.TrimSpace(condition))
+	}
+
+	rule.TimeOfDay = strings.ToLower(strings.TrimSpace(rule.TimeOfDay))
+	switch rule.TimeOfDay {
+	case "", TimeOfDayDay, TimeOfDayNight:
+	default:
+		log.Warn("Selection rule has an unknown time of day. Ignoring this rule.", "time_of_day", rule.TimeOfDay)
+		return false
+	}
+
+	if rule.Boost <= 0 {
+		rule.Boost = defaultSelectionBoost
+	}
+
+	if len(rule.Weather) == 0 && rule.TimeOfDay == "" {
+		return true
+	}
+
+	if rule.WeatherLocation == "" {
+		if len(c.WeatherLocations) == 0 {
+			log.Warn("Selection rule needs a weather location but none are configured. Ignoring this rule.", "album", rule.Album, "person", rule.Person)
+			return false
+		}
+		rule.WeatherLocation = c.WeatherLocations[0].Name
+	}
+
+	if !slices.ContainsFunc(c.WeatherLocations, func(w WeatherLocation) bool { return w.Name == rule.WeatherLocation }) {
+		log.Warn("Selection rule has an unknown weather location. Ignoring this rule.", "weather_location", rule.WeatherLocation)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/utils"
+)
+
+// SleepWindow a daily window of time to sleep during, used alongside sleep_start and sleep_end.
+type SleepWindow struct {
+	// Start when the window opens
+	Start string `mapstructure:"start"`
+	// End when the window closes. An end before the start crosses midnight
+	End string `mapstructure:"end"`
+	// Days the window opens on, e.g. mon-fri or weekends. Empty opens every day
+	Days []string `mapstructure:"days"`
+	// Except dates the window does not open on, e.g. holidays. YYYY-MM-DD_YYYY-MM-DD
+	Except []string `mapstructure:"except"`
+}
+
+// checkSleepWindows parses the sleep windows. Windows with invalid times, days or dates are ignored.
+func (c *Config) checkSleepWindows() {
+	c.sleepWindows = nil
+
+	for _, window := range c.SleepWindows {
+		parsed, err := parseSleepWindow(window)
+		if err != nil {
+			log.Warn("Invalid sleep window. Ignoring this window.", "start", window.Start, "end", window.End, "err", err)
+			continue
+		}
+		c.sleepWindows = append(c.sleepWindows, parsed)
+	}
+}
+
+// parseSleepWindow converts window to the form used to evaluate it.
+func parseSleepWindow(window SleepWindow) (utils.SleepWindow, error) {
+	if err := utils.ValidTimeWindow(window.Start, window.End); err != nil {
+		return utils.SleepWindow{}, err
+	}
+
+	days, err := utils.ParseWeekdays(window.Days)
+	if err != nil {
+		return utils.SleepWindow{}, err
+	}
+
+	parsed := utils.SleepWindow{Start: window.Start, End: window.End, Days: days}
+
+	for _, dateRange := range window.Except {
+		except, err := utils.ParseDateRange(dateRange)
+		if err != nil {
+			return utils.SleepWindow{}, err
+		}
+		parsed.Except = append(parsed.Except, except)
+	}
+
+	return parsed, nil
+}
+
+// HasSleep reports whether sleep mode is set up, either with sleep_start and sleep_end or with sleep windows.
+func (c *Config) HasSleep() bool {
+	return (c.SleepStart != "" && c.SleepEnd != "") || len(c.sleepWindows) > 0
+}
+
+// SleepState reports whether the kiosk should be asleep at now and, if so, when it wakes.
+func (c *Config) SleepState(now time.Time) (bool, time.Time) {
+	windows := c.sleepWindows
+
+	if c.SleepStart != "" && c.SleepEnd != "" {
+		if err := utils.ValidTimeWindow(c.SleepStart, c.SleepEnd); err != nil {
+			log.Error("parsing sleep time:", err)
+		}
+		// clip so requests never append to the base config's windows
+		windows = append(slices.Clip(windows), utils.SleepWindow{Start: c.SleepStart, End: c.SleepEnd})
+	}
+
+	return utils.SleepState(windows, now)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/log"
 
@@ -70,6 +71,93 @@ func TestImmichUrlImmichMulitplePerson(t *testing.T) {
 	assert.Contains(t, c.Person, "laura", "Expected 'laura' to be added to Person slice")
 }
 
+// TestImmichUrlImmichMulitpleTag tests that tag queries replace the base config tags
+func TestImmichUrlImmichMulitpleTag(t *testing.T) {
+	c := New()
+	c.Tag = []string{"BASE_TAG"}
+
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Add("tag", "holidays")
+	q.Add("tag", "family")
+
+	req := httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	err := c.ConfigWithOverrides(e.NewContext(req, rec))
+	assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+
+	assert.NotContains(t, c.Tag, "BASE_TAG", "BASE_TAG should not be present")
+	assert.Equal(t, []string{"holidays", "family"}, c.Tag, "Expected 2 tags to be added")
+}
+
+// TestAccountOverride tests selecting a named account via URL queries
+func TestAccountOverride(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		account     string
+		wantUrl     string
+		wantApiKey  string
+		wantAccount string
+		wantErr     error
+	}{
+		{
+			name:       "No account",
+			account:    "",
+			wantUrl:    "http://default:2283",
+			wantApiKey: "default-key",
+		},
+		{
+			name:        "Named account",
+			account:     "Partner",
+			wantUrl:     "http://partner:2283",
+			wantApiKey:  "partner-key",
+			wantAccount: "partner",
+		},
+		{
+			name:       "Unknown account",
+			account:    "stranger",
+			wantUrl:    "http://default:2283",
+			wantApiKey: "default-key",
+			wantErr:    ErrAccountNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.ImmichUrl = "http://default:2283"
+			c.ImmichApiKey = "default-key"
+			c.Accounts = map[string]ImmichAccount{
+				"partner": {ImmichUrl: "http://partner:2283", ImmichApiKey: "partner-key"},
+			}
+
+			e := echo.New()
+
+			q := make(url.Values)
+			if tt.account != "" {
+				q.Add("account", tt.account)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil)
+			rec := httptest.NewRecorder()
+
+			err := c.ConfigWithOverrides(e.NewContext(req, rec))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "Expected account error")
+				return
+			}
+
+			assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+			assert.Equal(t, tt.wantUrl, c.ImmichUrl, "Unexpected ImmichUrl")
+			assert.Equal(t, tt.wantApiKey, c.ImmichApiKey, "Unexpected ImmichApiKey")
+			assert.Equal(t, tt.wantAccount, c.Account, "Unexpected Account")
+		})
+	}
+}
+
 // TestMalformedURLs testing urls without scheme or ports
 func TestMalformedURLs(t *testing.T) {
 
@@ -172,6 +260,80 @@ func TestImmichUrlImmichMulitpleAlbum(t *testing.T) {
 	assert.Contains(t, configWithBaseOnly.Album, "BASE_ALBUM_2", "BASE_ALBUM_2 should be present")
 }
 
+// TestSearchFilterOverrides tests that date range and location queries replace the base config
+func TestSearchFilterOverrides(t *testing.T) {
+
+	c := New()
+	c.DateRange = []string{"2019-01-01_2019-12-31"}
+	c.City = []string{"Lisbon"}
+
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Add("city", "Porto")
+	q.Add("city", "Faro")
+	q.Add("country", "Portugal")
+
+	req := httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	err := c.ConfigWithOverrides(e.NewContext(req, rec))
+	assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+
+	assert.Equal(t, []string{"2019-01-01_2019-12-31"}, c.DateRange, "Base date range should persist")
+	assert.Equal(t, []string{"Porto", "Faro"}, c.City, "Base city should be replaced")
+	assert.Equal(t, []string{"Portugal"}, c.Country, "Country should be added")
+}
+
+// TestExclusionOverrides tests that excluded queries are added to the base config exclusions
+func TestExclusionOverrides(t *testing.T) {
+
+	c := New()
+	c.ExcludeAlbum = []string{"BASE_ALBUM"}
+	c.ExcludeAsset = []string{"BASE_ASSET"}
+
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Add("exclude_album", "ALBUM_1")
+	q.Add("exclude_person", "PERSON_1")
+
+	req := httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	err := c.ConfigWithOverrides(e.NewContext(req, rec))
+	assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+
+	assert.Equal(t, []string{"BASE_ALBUM", "ALBUM_1"}, c.ExcludeAlbum, "Base album exclusions should be kept")
+	assert.Equal(t, []string{"PERSON_1"}, c.ExcludePerson, "Person exclusion should be added")
+	assert.Equal(t, []string{"BASE_ASSET"}, c.ExcludeAsset, "Base asset exclusions should persist")
+}
+
+// TestExclusionFormOverrides tests that exclusions sent in a POST form body are added to the base config exclusions
+func TestExclusionFormOverrides(t *testing.T) {
+
+	c := New()
+	c.ExcludeAlbum = []string{"BASE_ALBUM"}
+	c.ExcludeAsset = []string{"BASE_ASSET"}
+
+	e := echo.New()
+
+	form := make(url.Values)
+	form.Add("exclude_album", "ALBUM_1")
+	form.Add("exclude_asset", "ASSET_1")
+
+	req := httptest.NewRequest(http.MethodPost, "/image", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+
+	err := c.ConfigWithOverrides(e.NewContext(req, rec))
+	assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+
+	assert.Equal(t, []string{"BASE_ALBUM", "ALBUM_1"}, c.ExcludeAlbum, "Base album exclusions should be kept")
+	assert.Equal(t, []string{"BASE_ASSET", "ASSET_1"}, c.ExcludeAsset, "Base asset exclusions should be kept")
+	assert.Empty(t, c.ExcludePerson, "Person exclusions should not change")
+}
+
 func TestAlbumAndPerson(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -292,6 +454,51 @@ func TestCheckWeatherLocations(t *testing.T) {
 			},
 			expected: "Weather location is missing required fields: latitude, longitude, API key",
 		},
+		{
+			name: "Open-Meteo without API key",
+			config: &Config{
+				WeatherLocations: []WeatherLocation{
+					{Name: "City", Lat: "123", Lon: "456", Provider: "Open-Meteo"},
+				},
+			},
+			expected: "",
+		},
+		{
+			name: "Json without coordinates",
+			config: &Config{
+				WeatherLocations: []WeatherLocation{
+					{Name: "Garden", URL: "http://station.local/weather.json", Provider: "json"},
+				},
+			},
+			expected: "",
+		},
+		{
+			name: "Met.no missing latitude",
+			config: &Config{
+				WeatherLocations: []WeatherLocation{
+					{Name: "City", Lon: "456", Provider: "met.no"},
+				},
+			},
+			expected: "Weather location is missing required fields: latitude",
+		},
+		{
+			name: "Json missing url",
+			config: &Config{
+				WeatherLocations: []WeatherLocation{
+					{Name: "City", Lat: "123", Lon: "456", Provider: "json"},
+				},
+			},
+			expected: "Weather location is missing required fields: url",
+		},
+		{
+			name: "Unknown provider",
+			config: &Config{
+				WeatherLocations: []WeatherLocation{
+					{Name: "City", Lat: "123", Lon: "456", API: "abc123", Provider: "barometer"},
+				},
+			},
+			expected: "Weather location has an unknown provider",
+		},
 	}
 
 	for _, tt := range tests {
@@ -305,9 +512,247 @@ func TestCheckWeatherLocations(t *testing.T) {
 			output := strings.TrimSpace(buf.String())
 			if tt.expected == "" {
 				assert.Empty(t, output)
+				assert.Len(t, tt.config.WeatherLocations, 1, "Valid locations should be kept")
 			} else {
 				assert.NotEmpty(t, output)
+				assert.Empty(t, tt.config.WeatherLocations, "Invalid locations should be ignored")
 			}
 		})
 	}
 }
+
+// TestProfileOverrides tests profiles are applied between the base config and URL queries
+func TestProfileOverrides(t *testing.T) {
+
+	profiles := `
+profiles:
+  Kitchen:
+    album: ["kitchen-album"]
+    layout: splitview
+    theme: SOLID
+    sleep_start: "22:00"
+    sleep_end: "07:00"
+    exclude_person: ["kitchen-person"]
+  broken:
+    immich_api_key: "other-key"
+`
+
+	tests := []struct {
+		name        string
+		query       url.Values
+		wantAlbum   []string
+		wantLayout  string
+		wantTheme   string
+		wantExclude []string
+		wantErr     error
+	}{
+		{
+			name:        "No profile",
+			query:       url.Values{},
+			wantAlbum:   []string{"base-album"},
+			wantLayout:  "single",
+			wantTheme:   "fade",
+			wantExclude: []string{"base-person"},
+		},
+		{
+			name:        "Profile",
+			query:       url.Values{"profile": {"kitchen"}},
+			wantAlbum:   []string{"kitchen-album"},
+			wantLayout:  "splitview",
+			wantTheme:   "solid",
+			wantExclude: []string{"base-person", "kitchen-person"},
+		},
+		{
+			name:        "Query overrides profile",
+			query:       url.Values{"profile": {"KITCHEN"}, "layout": {"portrait"}, "album": {"query-album"}},
+			wantAlbum:   []string{"query-album"},
+			wantLayout:  "portrait",
+			wantTheme:   "solid",
+			wantExclude: []string{"base-person", "kitchen-person"},
+		},
+		{
+			name:    "Unknown profile",
+			query:   url.Values{"profile": {"garage"}},
+			wantErr: ErrProfileNotFound,
+		},
+		{
+			name:    "Profile with settings that can not be overridden",
+			query:   url.Values{"profile": {"broken"}},
+			wantErr: ErrProfileNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.ImmichApiKey = "base-key"
+			c.Album = []string{"base-album"}
+			c.ExcludePerson = []string{"base-person"}
+
+			c.V.SetConfigType("yaml")
+			assert.NoError(t, c.V.ReadConfig(strings.NewReader(profiles)))
+			c.checkProfiles()
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query.Encode(), nil)
+			rec := httptest.NewRecorder()
+
+			err := c.ConfigWithOverrides(e.NewContext(req, rec))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "Expected profile error")
+				return
+			}
+
+			assert.NoError(t, err, "ConfigWithOverrides should not return an error")
+			assert.Equal(t, tt.wantAlbum, c.Album, "Unexpected Album")
+			assert.Equal(t, tt.wantLayout, c.Layout, "Unexpected Layout")
+			assert.Equal(t, tt.wantTheme, c.Theme, "Unexpected Theme")
+			assert.Equal(t, tt.wantExclude, c.ExcludePerson, "Unexpected ExcludePerson")
+			assert.Equal(t, "base-key", c.ImmichApiKey, "Profiles must not change credentials")
+		})
+	}
+}
+
+// TestCheckSelectionRules tests selection rules are normalised and unusable rules are ignored
+func TestCheckSelectionRules(t *testing.T) {
+	c := &Config{
+		WeatherLocations: []WeatherLocation{{Name: "london"}, {Name: "paris"}},
+		SelectionRules: []SelectionRule{
+			{Album: []string{"snow"}, Weather: []string{" Snow "}},
+			{Person: []string{"owl"}, TimeOfDay: "Night", WeatherLocation: "paris", Boost: 2},
+			{Album: []string{"always"}},
+			{Weather: []string{"rain"}},
+			{Album: []string{"dusk"}, TimeOfDay: "dusk"},
+			{Album: []string{"berlin"}, Weather: []string{"rain"}, WeatherLocation: "berlin"},
+		},
+	}
+
+	c.checkSelectionRules()
+
+	assert.Equal(t, []SelectionRule{
+		{Album: []string{"snow"}, Weather: []string{"snow"}, WeatherLocation: "london", Boost: defaultSelectionBoost},
+		{Person: []string{"owl"}, TimeOfDay: TimeOfDayNight, WeatherLocation: "paris", Boost: 2},
+		{Album: []string{"always"}, Boost: defaultSelectionBoost},
+	}, c.SelectionRules)
+
+	c = &Config{
+		SelectionRules: []SelectionRule{{Album: []string{"snow"}, Weather: []string{"snow"}}},
+	}
+	c.checkSelectionRules()
+	assert.Empty(t, c.SelectionRules, "Rules needing weather should be ignored without weather locations")
+}
+
+func TestSchedule(t *testing.T) {
+	c := &Config{
+		Album:   []string{"base"},
+		Layout:  "single",
+		Refresh: 60,
+		Schedule: []ScheduleEntry{
+			{Name: "kids", Days: []string{"weekends"}, Start: "7", End: "11", Album: []string{" kids "}, Priority: 1},
+			{Name: "evening", Start: "18", End: "23", Album: []string{"travel"}, Layout: "Splitview"},
+			{Name: "late", Start: "2230", End: "0100", Theme: "none", Priority: 2},
+			{Name: "holiday", Days: []string{"sat"}, Refresh: 30},
+			{Name: "nothing", Start: "9", End: "10"},
+			{Name: "bad days", Days: []string{"someday"}, Theme: "fade"},
+			{Name: "bad time", Start: "9", Theme: "fade"},
+			{Theme: "fade", Start: "25", End: "26"},
+		},
+	}
+
+	c.checkSchedule()
+
+	names := []string{}
+	for _, entry := range c.Schedule {
+		names = append(names, entry.Name)
+	}
+	assert.Equal(t, []string{"kids", "evening", "late", "holiday"}, names)
+
+	// 2023-01-07 is a Saturday
+	saturday := func(hour, minute int) time.Time { return time.Date(2023, 1, 7, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{name: "no window", now: saturday(12, 0).AddDate(0, 0, 1), want: ""},
+		{name: "priority over all day entry", now: saturday(8, 0), want: "kids"},
+		{name: "all day entry", now: saturday(12, 0), want: "holiday"},
+		{name: "listed first", now: saturday(19, 0).AddDate(0, 0, 1), want: "evening"},
+		{name: "overlap", now: saturday(22, 45), want: "late"},
+		{name: "after midnight", now: saturday(0, 30).AddDate(0, 0, 1), want: "late"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, c.ActiveScheduleName(test.now))
+		})
+	}
+
+	requestConfig := *c
+	requestConfig.Person = []string{"person"}
+	requestConfig.Tag = []string{"tag"}
+	requestConfig.DateRange = []string{"2023-01-01_2023-12-31"}
+	requestConfig.City = []string{"Paris"}
+	requestConfig.useSchedule(saturday(8, 0))
+	assert.Equal(t, "kids", requestConfig.ActiveSchedule)
+	assert.Equal(t, []string{"kids"}, requestConfig.Album)
+	assert.Empty(t, requestConfig.Person, "Albums of a schedule entry should replace the people of the base config")
+	assert.Empty(t, requestConfig.Tag, "Albums of a schedule entry should replace the tags of the base config")
+	assert.Empty(t, requestConfig.DateRange, "Albums of a schedule entry should replace the date filters of the base config")
+	assert.Empty(t, requestConfig.City, "Albums of a schedule entry should replace the location filters of the base config")
+	assert.Equal(t, "single", requestConfig.Layout)
+	assert.Equal(t, 60, requestConfig.Refresh)
+
+	requestConfig = *c
+	requestConfig.useSchedule(saturday(19, 0).AddDate(0, 0, 1))
+	assert.Equal(t, []string{"travel"}, requestConfig.Album)
+	assert.Equal(t, "splitview", requestConfig.Layout)
+	assert.Equal(t, []string{"base"}, c.Album, "The base config should not change")
+}
+
+func TestSleepWindows(t *testing.T) {
+	c := &Config{
+		SleepWindows: []SleepWindow{
+			{Start: "22", End: "7", Days: []string{"sun-thu"}, Except: []string{"2024-12-24_2024-12-26"}},
+			{Start: "22", End: "9", Days: []string{"weekends"}},
+			{Start: "25", End: "7"},
+			{Start: "22", End: "7", Days: []string{"someday"}},
+			{Start: "22", End: "7", Except: []string{"christmas"}},
+		},
+	}
+
+	c.checkSleepWindows()
+	assert.Len(t, c.sleepWindows, 2, "Invalid windows should be ignored")
+	assert.True(t, c.HasSleep())
+
+	// 2024-03-01 is a Friday
+	asleep, wakesAt := c.SleepState(time.Date(2024, 3, 3, 8, 0, 0, 0, time.UTC))
+	assert.True(t, asleep, "Saturday's window should still be open on Sunday morning")
+	assert.Equal(t, time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC), wakesAt)
+
+	asleep, _ = c.SleepState(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	assert.False(t, asleep)
+
+	requestConfig := *c
+	requestConfig.SleepStart = "12"
+	requestConfig.SleepEnd = "13"
+	asleep, wakesAt = requestConfig.SleepState(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	assert.True(t, asleep, "sleep_start and sleep_end should be used with the sleep windows")
+	assert.Equal(t, time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC), wakesAt)
+	assert.Len(t, c.sleepWindows, 2, "The base config's windows should not change")
+
+	assert.False(t, (&Config{}).HasSleep())
+}
+
+func TestCheckSearchFilters(t *testing.T) {
+	c := &Config{
+		DateRange: []string{" 2019-01-01_2019-12-31 ", "2019-01-01", "2019-13-01_2019-12-31", ""},
+		City:      []string{" London ", ""},
+	}
+
+	c.checkSearchFilters()
+
+	assert.Equal(t, []string{"2019-01-01_2019-12-31"}, c.DateRange, "Malformed date ranges should be ignored")
+	assert.Equal(t, []string{"London"}, c.City)
+}
@@ -0,0 +1,284 @@
+// Package diskcache provides a size capped, least recently used cache of image bytes on disk.
+//
+// Entries are keyed by asset ID, size and checksum, so a changed asset is never
+// served from a stale entry. The cache survives restarts: existing entries are
+// picked up again when the cache is opened, ordered by when they were last used.
+package diskcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// tempPrefix prefix of files being written, which are removed when the cache is opened
+const tempPrefix = ".tmp-"
+
+// validKey matches keys that are safe to use as file names
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Cache image bytes stored on disk with least recently used eviction.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// entry a file in the cache. The most recently used entry is at the front of the list.
+type entry struct {
+	key  string
+	size int64
+}
+
+// Key returns the cache key for the given asset ID, size and checksum.
+// It reports false when the asset can not be cached, e.g. when the checksum is unknown.
+func Key(assetID, size, checksum string) (string, bool) {
+	if assetID == "" || size == "" || checksum == "" {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(checksum))
+	key := assetID + "_" + size + "_" + hex.EncodeToString(sum[:8])
+
+	return key, validKey.MatchString(key)
+}
+
+// ParseKey returns the asset ID and size the given key was made from.
+func ParseKey(key string) (string, string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// New opens the cache in dir, creating dir when needed, and keeps it under maxSize bytes.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("disk cache size must be greater than 0")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load adds the entries already in the cache dir, oldest first.
+func (c *Cache) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type existing struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []existing
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+
+		if strings.HasPrefix(name, tempPrefix) {
+			_ = os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+
+		if !dirEntry.Type().IsRegular() || !validKey.MatchString(name) {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, existing{key: name, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushFront(&entry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+
+	c.evict()
+
+	return nil
+}
+
+// path returns the file path of the given key.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// Get returns the bytes stored under key and marks them as recently used.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	element, found := c.entries[key]
+	if found {
+		c.lru.MoveToFront(element)
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		log.Error("reading disk cache", "key", key, "err", err)
+		c.remove(key)
+		return nil, false
+	}
+
+	// modification time records use so the order survives a restart
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+
+	return data, true
+}
+
+// Set stores data under key, evicting the least recently used entries to stay under the size cap.
+func (c *Cache) Set(key string, data []byte) error {
+	if !validKey.MatchString(key) {
+		return errors.New("invalid disk cache key")
+	}
+
+	size := int64(len(data))
+	if size > c.maxSize {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(c.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if element, found := c.entries[key]; found {
+		e := element.Value.(*entry)
+		c.size += size - e.size
+		e.size = size
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[key] = c.lru.PushFront(&entry{key: key, size: size})
+		c.size += size
+	}
+
+	c.evict()
+
+	return nil
+}
+
+// remove deletes the entry stored under key.
+func (c *Cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.removeElement(element)
+	}
+}
+
+// removeElement deletes the entry and its file. c.mu must be held.
+func (c *Cache) removeElement(element *list.Element) {
+	e := element.Value.(*entry)
+
+	c.lru.Remove(element)
+	delete(c.entries, e.key)
+	c.size -= e.size
+
+	if err := os.Remove(c.path(e.key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error("removing disk cache entry", "key", e.key, "err", err)
+	}
+}
+
+// evict removes least recently used entries until the cache is under its size cap. c.mu must be held.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.removeElement(oldest)
+	}
+}
+
+// Keys returns the keys of all entries, most recently used first.
+func (c *Cache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, c.lru.Len())
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*entry).key)
+	}
+
+	return keys
+}
+
+// Size returns the number of bytes stored.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Len returns the number of entries stored.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,102 @@
+package diskcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		assetID   string
+		size      string
+		checksum  string
+		cacheable bool
+	}{
+		{name: "Valid", assetID: "3d7e5f2a-1b2c-4d5e-8f90-a1b2c3d4e5f6", size: "preview", checksum: "a+b/c==", cacheable: true},
+		{name: "Missing checksum", assetID: "asset-1", size: "preview", checksum: "", cacheable: false},
+		{name: "Missing asset ID", assetID: "", size: "preview", checksum: "abc", cacheable: false},
+		{name: "Path in asset ID", assetID: "../../etc", size: "preview", checksum: "abc", cacheable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cacheable := Key(tt.assetID, tt.size, tt.checksum)
+			assert.Equal(t, tt.cacheable, cacheable, "Unexpected cacheable")
+		})
+	}
+
+	first, _ := Key("asset-1", "preview", "checksum-1")
+	changed, _ := Key("asset-1", "preview", "checksum-2")
+	blurred, _ := Key("asset-1", "preview-blur", "checksum-1")
+
+	assert.NotEqual(t, first, changed, "A changed asset should not share a key")
+	assert.NotEqual(t, first, blurred, "Sizes should not share a key")
+
+	assetID, size, ok := ParseKey(blurred)
+	assert.True(t, ok, "Key should parse")
+	assert.Equal(t, "asset-1", assetID, "Unexpected asset ID")
+	assert.Equal(t, "preview-blur", size, "Unexpected size")
+}
+
+func TestEviction(t *testing.T) {
+	c, err := New(t.TempDir(), 10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Set("a", []byte("1234")))
+	assert.NoError(t, c.Set("b", []byte("1234")))
+
+	// using a makes b the least recently used
+	_, found := c.Get("a")
+	assert.True(t, found, "a should be cached")
+
+	assert.NoError(t, c.Set("c", []byte("1234")))
+
+	_, found = c.Get("b")
+	assert.False(t, found, "b should have been evicted")
+
+	data, found := c.Get("a")
+	assert.True(t, found, "a should be cached")
+	assert.Equal(t, []byte("1234"), data)
+
+	_, found = c.Get("c")
+	assert.True(t, found, "c should be cached")
+
+	assert.Equal(t, int64(8), c.Size(), "Unexpected cache size")
+	assert.NoError(t, c.Set("big", []byte("12345678901")), "Oversized entries are skipped")
+	assert.Equal(t, 2, c.Len(), "Oversized entries should not be stored")
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := New(dir, 100)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Set("old", []byte("old")))
+	assert.NoError(t, c.Set("new", []byte("new")))
+
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "old"), past, past))
+
+	// left behind by an interrupted write
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, tempPrefix+"123"), []byte("partial"), 0o644))
+
+	reopened, err := New(dir, 4)
+	assert.NoError(t, err)
+
+	_, found := reopened.Get("old")
+	assert.False(t, found, "The least recently used entry should be evicted when reopened under a smaller cap")
+
+	data, found := reopened.Get("new")
+	assert.True(t, found, "Entries should survive a restart")
+	assert.Equal(t, []byte("new"), data)
+
+	_, err = os.Stat(filepath.Join(dir, tempPrefix+"123"))
+	assert.True(t, os.IsNotExist(err), "Partial writes should be removed")
+}
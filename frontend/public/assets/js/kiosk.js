@@ -3703,6 +3703,7 @@ var kiosk = (() => {
   var kioskElement;
   var menuElement;
   var menuPausePlayButton;
+  var videoElement = null;
   function initPolling(interval, kiosk2, menu2, pausePlayButton) {
     pollInterval = interval;
     kioskElement = kiosk2;
@@ -3727,13 +3728,61 @@ var kiosk = (() => {
     }
     animationFrameId = requestAnimationFrame(updateKiosk);
   }
+  function newestVideo() {
+    const frames = htmx_esm_default.findAll(".frame");
+    if (frames.length === 0) return null;
+    return htmx_esm_default.find(
+      frames[frames.length - 1],
+      ".frame--video video"
+    );
+  }
+  function updateVideoProgress() {
+    if (!videoElement || !progressBarElement || !videoElement.duration) return;
+    const progress = Math.min(
+      videoElement.currentTime / videoElement.duration,
+      1
+    );
+    progressBarElement.style.width = `${progress * 100}%`;
+  }
+  function handleVideoEnded() {
+    releaseVideo();
+    htmx_esm_default.trigger(kioskElement, "kiosk-new-image");
+  }
+  function handleVideoError() {
+    console.error("Video could not be played, falling back to refresh timer");
+    releaseVideo();
+    lastPollTime = performance.now();
+    animationFrameId = requestAnimationFrame(updateKiosk);
+  }
+  function playVideo(video) {
+    videoElement = video;
+    videoElement.addEventListener("timeupdate", updateVideoProgress);
+    videoElement.addEventListener("ended", handleVideoEnded);
+    videoElement.addEventListener("error", handleVideoError);
+    videoElement.play().catch((err) => {
+      console.error("Video playback failed", err);
+    });
+  }
+  function releaseVideo() {
+    if (!videoElement) return;
+    videoElement.removeEventListener("timeupdate", updateVideoProgress);
+    videoElement.removeEventListener("ended", handleVideoEnded);
+    videoElement.removeEventListener("error", handleVideoError);
+    videoElement = null;
+  }
   function startPolling() {
     progressBarElement = htmx_esm_default.find(".progress--bar");
     progressBarElement == null ? void 0 : progressBarElement.classList.remove("progress--bar-paused");
     menuElement == null ? void 0 : menuElement.classList.add("navigation-hidden");
     lastPollTime = performance.now();
     pausedTime = null;
-    animationFrameId = requestAnimationFrame(updateKiosk);
+    releaseVideo();
+    const video = newestVideo();
+    if (video) {
+      playVideo(video);
+    } else {
+      animationFrameId = requestAnimationFrame(updateKiosk);
+    }
     document.body.classList.remove("polling-paused");
     isPaused = false;
   }
@@ -3746,6 +3795,7 @@ var kiosk = (() => {
     if (isPaused && animationFrameId === null) return;
     cancelAnimationFrame(animationFrameId);
     pausedTime = performance.now();
+    videoElement == null ? void 0 : videoElement.pause();
     progressBarElement == null ? void 0 : progressBarElement.classList.add("progress--bar-paused");
     if (showMenu) {
       menuElement == null ? void 0 : menuElement.classList.remove("navigation-hidden");
@@ -3755,7 +3805,13 @@ var kiosk = (() => {
   }
   function resumePolling() {
     if (!isPaused) return;
-    animationFrameId = requestAnimationFrame(updateKiosk);
+    if (videoElement) {
+      videoElement.play().catch((err) => {
+        console.error("Video playback failed", err);
+      });
+    } else {
+      animationFrameId = requestAnimationFrame(updateKiosk);
+    }
     progressBarElement == null ? void 0 : progressBarElement.classList.remove("progress--bar-paused");
     menuElement == null ? void 0 : menuElement.classList.add("navigation-hidden");
     document.body.classList.remove("polling-paused");
@@ -3764,6 +3820,36 @@ var kiosk = (() => {
   function togglePolling() {
     isPaused ? resumePolling() : pausePolling();
   }
+  function initEvents(deviceID, params) {
+    if (!("EventSource" in window) || !deviceID) return;
+    const query = new URLSearchParams({ device: deviceID });
+    if (typeof params.password === "string") {
+      query.set("password", params.password);
+    }
+    const events = new EventSource(`/events?${query.toString()}`);
+    events.addEventListener("next-image", () => {
+      htmx_esm_default.trigger(kioskElement, "kiosk-new-image");
+    });
+    events.addEventListener("previous-image", () => {
+      const previousImage = htmx_esm_default.find("#navigation-interaction-area--previous-image");
+      previousImage && htmx_esm_default.trigger(previousImage, "kiosk-prev-image");
+    });
+    events.addEventListener("pause", () => pausePolling());
+    events.addEventListener("resume", () => resumePolling());
+    events.addEventListener("sleep", () => {
+      document.body.classList.add("sleep");
+    });
+    events.addEventListener("wake", () => {
+      document.body.classList.remove("sleep");
+    });
+    events.addEventListener("reload", () => {
+      window.location.reload();
+    });
+    events.addEventListener("flush-cache", () => {
+      const flushCacheButton = htmx_esm_default.find(".navigation--flush-cache");
+      flushCacheButton && htmx_esm_default.trigger(flushCacheButton, "click");
+    });
+  }
 
   // src/ts/wakelock.ts
   var preventSleep = () => __async(void 0, null, function* () {
@@ -3887,6 +3973,7 @@ var kiosk = (() => {
       } else {
         console.error("Could not start polling");
       }
+      initEvents(kioskData.deviceID, kioskData.params);
       if (nextImageMenuButton2 && prevImageMenuButton2) {
         initMenu(
           nextImageMenuButton2,
@@ -3914,12 +4001,14 @@ var kiosk = (() => {
     fullscreenButton == null ? void 0 : fullscreenButton.addEventListener("click", handleFullscreenClick);
     addFullscreenEventListener(fullscreenButton);
     htmx_esm_default.on("htmx:afterRequest", function(e) {
+      var _a2;
       const offlineSVG = htmx_esm_default.find("#offline");
       if (!offlineSVG) {
         console.error("offline svg missing");
         return;
       }
-      if (e.detail.successful) {
+      const immichOffline = ((_a2 = e.detail.xhr) == null ? void 0 : _a2.getResponseHeader("kiosk-offline")) === "true";
+      if (e.detail.successful && !immichOffline) {
         htmx_esm_default.removeClass(offlineSVG, "offline");
       } else {
         htmx_esm_default.addClass(offlineSVG, "offline");
@@ -6,6 +6,7 @@ import {
 } from "./fullscreen";
 import {
   initPolling,
+  initEvents,
   startPolling,
   togglePolling,
   pausePolling,
@@ -23,6 +24,7 @@ interface HTMXEvent extends Event {
   preventDefault: () => void;
   detail: {
     successful: boolean;
+    xhr?: XMLHttpRequest;
   };
 }
 
@@ -33,6 +35,7 @@ type KioskData = {
   debug: boolean;
   debugVerbose: boolean;
   version: string;
+  deviceID: string;
   params: Record<string, unknown>;
   refresh: number;
   disableScreensaver: boolean;
@@ -109,6 +112,8 @@ async function init(): Promise<void> {
     console.error("Could not start polling");
   }
 
+  initEvents(kioskData.deviceID, kioskData.params);
+
   if (nextImageMenuButton && prevImageMenuButton) {
     initMenu(
       nextImageMenuButton as HTMLElement,
@@ -153,6 +158,7 @@ function addEventListeners(): void {
   addFullscreenEventListener(fullscreenButton);
 
   // Server online check. Fires after every AJAX request.
+  // Kiosk also reports when it is showing recent assets because Immich is offline.
   htmx.on("htmx:afterRequest", function (e: HTMXEvent) {
     const offlineSVG = htmx.find("#offline");
 
@@ -161,7 +167,10 @@ function addEventListeners(): void {
       return;
     }
 
-    if (e.detail.successful) {
+    const immichOffline =
+      e.detail.xhr?.getResponseHeader("kiosk-offline") === "true";
+
+    if (e.detail.successful && !immichOffline) {
       htmx.removeClass(offlineSVG, "offline");
     } else {
       htmx.addClass(offlineSVG, "offline");
@@ -10,6 +10,7 @@ let pollInterval: number;
 let kioskElement: HTMLElement | null;
 let menuElement: HTMLElement | null;
 let menuPausePlayButton: HTMLElement | null;
+let videoElement: HTMLVideoElement | null = null;
 
 function initPolling(
   interval: number,
@@ -51,7 +52,81 @@ function updateKiosk(timestamp: number) {
 }
 
 /**
- * Start the polling process to fetch new images
+ * Find the video in the most recently added frame (if any)
+ * @returns {HTMLVideoElement | null} The video element or null
+ */
+function newestVideo(): HTMLVideoElement | null {
+  const frames = htmx.findAll(".frame");
+  if (frames.length === 0) return null;
+
+  return htmx.find(
+    frames[frames.length - 1],
+    ".frame--video video",
+  ) as HTMLVideoElement | null;
+}
+
+/**
+ * Updates the progress bar to match the video playback position
+ */
+function updateVideoProgress() {
+  if (!videoElement || !progressBarElement || !videoElement.duration) return;
+
+  const progress = Math.min(
+    videoElement.currentTime / videoElement.duration,
+    1,
+  );
+  progressBarElement.style.width = `${progress * 100}%`;
+}
+
+/**
+ * Request the next image once the video has ended
+ */
+function handleVideoEnded() {
+  releaseVideo();
+  htmx.trigger(kioskElement as HTMLElement, "kiosk-new-image");
+}
+
+/**
+ * Fall back to the refresh timer if the video can not be played
+ */
+function handleVideoError() {
+  console.error("Video could not be played, falling back to refresh timer");
+  releaseVideo();
+  lastPollTime = performance.now();
+  animationFrameId = requestAnimationFrame(updateKiosk);
+}
+
+/**
+ * Play the video and advance to the next image once it has ended
+ * @param {HTMLVideoElement} video - The video element to play
+ */
+function playVideo(video: HTMLVideoElement) {
+  videoElement = video;
+  videoElement.addEventListener("timeupdate", updateVideoProgress);
+  videoElement.addEventListener("ended", handleVideoEnded);
+  videoElement.addEventListener("error", handleVideoError);
+
+  videoElement.play().catch((err) => {
+    console.error("Video playback failed", err);
+  });
+}
+
+/**
+ * Remove video event listeners and stop tracking the current video
+ */
+function releaseVideo() {
+  if (!videoElement) return;
+
+  videoElement.removeEventListener("timeupdate", updateVideoProgress);
+  videoElement.removeEventListener("ended", handleVideoEnded);
+  videoElement.removeEventListener("error", handleVideoError);
+  videoElement = null;
+}
+
+/**
+ * Start the polling process to fetch new images.
+ * If the new frame contains a video the next image is fetched
+ * once the video has ended instead of using the refresh timer.
  */
 function startPolling() {
   progressBarElement = htmx.find(".progress--bar") as HTMLElement | null;
@@ -62,7 +137,14 @@ function startPolling() {
   lastPollTime = performance.now();
   pausedTime = null;
 
-  animationFrameId = requestAnimationFrame(updateKiosk);
+  releaseVideo();
+
+  const video = newestVideo();
+  if (video) {
+    playVideo(video);
+  } else {
+    animationFrameId = requestAnimationFrame(updateKiosk);
+  }
 
   document.body.classList.remove("polling-paused");
 
@@ -89,6 +171,8 @@ function pausePolling(showMenu: boolean = true) {
   cancelAnimationFrame(animationFrameId as number);
   pausedTime = performance.now();
 
+  videoElement?.pause();
+
   progressBarElement?.classList.add("progress--bar-paused");
 
   if (showMenu) {
@@ -105,7 +189,13 @@ function pausePolling(showMenu: boolean = true) {
 function resumePolling() {
   if (!isPaused) return;
 
-  animationFrameId = requestAnimationFrame(updateKiosk);
+  if (videoElement) {
+    videoElement.play().catch((err) => {
+      console.error("Video playback failed", err);
+    });
+  } else {
+    animationFrameId = requestAnimationFrame(updateKiosk);
+  }
 
   progressBarElement?.classList.remove("progress--bar-paused");
   menuElement?.classList.add("navigation-hidden");
@@ -122,8 +212,56 @@ function togglePolling() {
   isPaused ? resumePolling() : pausePolling();
 }
 
+/**
+ * Listen for events pushed by the server, e.g. from the admin page or Home Assistant.
+ * The browser reconnects to the stream by itself if the connection drops.
+ * @param {string} deviceID - The ID of this device
+ * @param {Record<string, unknown>} params - The kiosk url params, needed for the password
+ */
+function initEvents(deviceID: string, params: Record<string, unknown>) {
+  if (!("EventSource" in window) || !deviceID) return;
+
+  const query = new URLSearchParams({ device: deviceID });
+  if (typeof params.password === "string") {
+    query.set("password", params.password);
+  }
+
+  const events = new EventSource(`/events?${query.toString()}`);
+
+  events.addEventListener("next-image", () => {
+    htmx.trigger(kioskElement as HTMLElement, "kiosk-new-image");
+  });
+
+  events.addEventListener("previous-image", () => {
+    const previousImage = htmx.find("#navigation-interaction-area--previous-image");
+    previousImage && htmx.trigger(previousImage, "kiosk-prev-image");
+  });
+
+  events.addEventListener("pause", () => pausePolling());
+
+  events.addEventListener("resume", () => resumePolling());
+
+  events.addEventListener("sleep", () => {
+    document.body.classList.add("sleep");
+  });
+
+  events.addEventListener("wake", () => {
+    document.body.classList.remove("sleep");
+  });
+
+  events.addEventListener("reload", () => {
+    window.location.reload();
+  });
+
+  events.addEventListener("flush-cache", () => {
+    const flushCacheButton = htmx.find(".navigation--flush-cache");
+    flushCacheButton && htmx.trigger(flushCacheButton, "click");
+  });
+}
+
 export {
   initPolling,
+  initEvents,
   startPolling,
   pausePolling,
   resumePolling,
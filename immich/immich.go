@@ -6,7 +6,6 @@
 package immich
 
 import (
-	"net/http"
 	"sync"
 	"time"
 
@@ -32,28 +31,30 @@ const (
 	AlbumKeywordShared     string = "shared"
 	AlbumKeywordFavourites string = "favourites"
 	AlbumKeywordFavorites  string = "favorites"
+	AlbumKeywordMemories   string = "memories"
 
 	AssetSizeThumbnail string = "thumbnail"
 	AssetSizeOriginal  string = "original"
 )
 
 var (
-	// requestConfig the config for this request
-	requestConfig config.Config
 	// apiCache cache store for immich api call(s)
 	apiCache *cache.Cache
 	// apiCacheLock is used to synchronize access to the apiCache
 	apiCacheLock sync.Mutex
-	// httpClient default http client for Immich api calls
-	httpClient = &http.Client{
-		Timeout: time.Second * time.Duration(requestConfig.Kiosk.HTTPTimeout),
-	}
 )
 
 type ImmichPersonStatistics struct {
 	Assets int `json:"assets"`
 }
 
+// ImmichAssetStatistics the number of assets in the library
+type ImmichAssetStatistics struct {
+	Images int `json:"images"`
+	Videos int `json:"videos"`
+	Total  int `json:"total"`
+}
+
 type ImmichError struct {
 	Message    []string `json:"message"`
 	Error      string   `json:"error"`
@@ -126,7 +127,7 @@ type ImmichAsset struct {
 	IsTrashed        bool            `json:"isTrashed"`
 	Duration         string          `json:"-"` // `json:"duration"`
 	ExifInfo         ExifInfo        `json:"exifInfo"`
-	LivePhotoVideoID any             `json:"-"`      // `json:"livePhotoVideoId"`
+	LivePhotoVideoID string          `json:"livePhotoVideoId"`
 	People           []Person        `json:"people"` // `json:"people"`
 	UnassignedFaces  []Face          `json:"unassignedFaces"`
 	Checksum         string          `json:"checksum"` // `json:"checksum"`
@@ -137,6 +138,12 @@ type ImmichAsset struct {
 	RatioWanted      ImageOrientation
 	IsPortrait       bool
 	IsLandscape      bool
+	IsMemory         bool
+
+	// requestConfig the config for the request this asset belongs to
+	requestConfig config.Config
+	// client makes the Immich api calls for this asset
+	client *Client
 }
 
 type ImmichAlbum struct {
@@ -147,6 +154,14 @@ type ImmichAlbum struct {
 
 type ImmichAlbums []ImmichAlbum
 
+type ImmichTag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ImmichTags []ImmichTag
+
 type ImmichSearchRandomBody struct {
 	City          string   `url:"city,omitempty" json:"city,omitempty"`
 	Country       string   `url:"country,omitempty" json:"country,omitempty"`
@@ -167,6 +182,7 @@ type ImmichSearchRandomBody struct {
 	PersonIds     []string `url:"personIds,omitempty" json:"personIds,omitempty"`
 	Size          int      `url:"size,omitempty" json:"size,omitempty"`
 	State         string   `url:"state,omitempty" json:"state,omitempty"`
+	TagIds        []string `url:"tagIds,omitempty" json:"tagIds,omitempty"`
 	TakenAfter    string   `url:"takenAfter,omitempty" json:"takenAfter,omitempty"`
 	TakenBefore   string   `url:"takenBefore,omitempty" json:"takenBefore,omitempty"`
 	TrashedAfter  string   `url:"trashedAfter,omitempty" json:"trashedAfter,omitempty"`
@@ -189,21 +205,56 @@ type ImmichSearchMetadataResponse struct {
 	} `json:"assets"`
 }
 
+type ImmichSearchMetadataAssetsResponse struct {
+	Assets struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+		NextPage string `json:"nextPage"`
+	} `json:"assets"`
+}
+
+type ImmichSearchSmartBody struct {
+	Query        string `url:"query" json:"query"`
+	Type         string `url:"type,omitempty" json:"type,omitempty"`
+	WithArchived bool   `url:"withArchived,omitempty" json:"withArchived,omitempty"`
+	WithExif     bool   `url:"withExif,omitempty" json:"withExif,omitempty"`
+	Size         int    `url:"size,omitempty" json:"size,omitempty"`
+	Page         int    `url:"page,omitempty" json:"page,omitempty"`
+}
+
+type ImmichSearchSmartResponse struct {
+	Assets struct {
+		Total    int           `json:"total"`
+		Items    []ImmichAsset `json:"items"`
+		NextPage string        `json:"nextPage"`
+	} `json:"assets"`
+}
+
 func init() {
 	// Setting up Immich api cache
 	apiCache = cache.New(5*time.Minute, 10*time.Minute)
 }
 
-// NewImage returns a new image instance
+// NewImage returns a new image instance which uses the given config for all of its Immich api calls.
 func NewImage(base config.Config) ImmichAsset {
-	requestConfig = base
-	return ImmichAsset{}
+	return ImmichAsset{
+		requestConfig: base,
+		client:        NewClient(base.ImmichApiKey, time.Second*time.Duration(base.Kiosk.HTTPTimeout)),
+	}
+}
+
+// setAsset replaces the asset with the given asset, keeping the config and client of the request.
+func (i *ImmichAsset) setAsset(asset ImmichAsset) {
+	asset.requestConfig = i.requestConfig
+	asset.client = i.client
+	*i = asset
 }
 
 type ImmichApiCall func(string, string, []byte) ([]byte, error)
 
 type ImmichApiResponse interface {
-	ImmichAsset | []ImmichAsset | ImmichAlbum | ImmichAlbums | ImmichPersonStatistics | int | ImmichSearchMetadataResponse | []Face
+	ImmichAsset | []ImmichAsset | ImmichAlbum | ImmichAlbums | ImmichTags | ImmichPersonStatistics | ImmichAssetStatistics | int | ImmichSearchMetadataResponse | ImmichSearchMetadataAssetsResponse | ImmichSearchSmartResponse | []Face
 }
 
 func FluchApiCache() {
@@ -1,6 +1,7 @@
 package immich
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand/v2"
@@ -13,10 +14,10 @@ import (
 
 // albums retrieves albums from Immich based on the shared parameter.
 // It constructs the API URL, makes the API call, and returns the albums.
-func (i *ImmichAsset) albums(requestID string, shared bool) (ImmichAlbums, error) {
+func (i *ImmichAsset) albums(ctx context.Context, requestID string, shared bool) (ImmichAlbums, error) {
 	var albums ImmichAlbums
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -31,7 +32,7 @@ func (i *ImmichAsset) albums(requestID string, shared bool) (ImmichAlbums, error
 		apiUrl.RawQuery = "shared=true"
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, albums)
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, albums)
 	body, err := immichApiCall("GET", apiUrl.String(), nil)
 	if err != nil {
 		return immichApiFail(albums, err, body, apiUrl.String())
@@ -46,20 +47,20 @@ func (i *ImmichAsset) albums(requestID string, shared bool) (ImmichAlbums, error
 }
 
 // allSharedAlbums retrieves all shared albums from Immich.
-func (i *ImmichAsset) allSharedAlbums(requestID string) (ImmichAlbums, error) {
-	return i.albums(requestID, true)
+func (i *ImmichAsset) allSharedAlbums(ctx context.Context, requestID string) (ImmichAlbums, error) {
+	return i.albums(ctx, requestID, true)
 }
 
 // allAlbums retrieves all non-shared albums from Immich.
-func (i *ImmichAsset) allAlbums(requestID string) (ImmichAlbums, error) {
-	return i.albums(requestID, false)
+func (i *ImmichAsset) allAlbums(ctx context.Context, requestID string) (ImmichAlbums, error) {
+	return i.albums(ctx, requestID, false)
 }
 
 // albumAssets retrieves all assets associated with a specific album from Immich.
-func (i *ImmichAsset) albumAssets(albumID, requestID string) (ImmichAlbum, error) {
+func (i *ImmichAsset) albumAssets(ctx context.Context, albumID, requestID string) (ImmichAlbum, error) {
 	var album ImmichAlbum
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -70,7 +71,7 @@ func (i *ImmichAsset) albumAssets(albumID, requestID string) (ImmichAlbum, error
 		Path:   path.Join("api", "albums", albumID),
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, album)
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, album)
 	body, err := immichApiCall("GET", apiUrl.String(), nil)
 	if err != nil {
 		return immichApiFail(album, err, body, apiUrl.String())
@@ -93,31 +94,38 @@ func (i *ImmichAsset) countAssetsInAlbums(albums ImmichAlbums) int {
 }
 
 // AlbumImageCount retrieves the number of images in a specific album from Immich.
-func (i *ImmichAsset) AlbumImageCount(albumID string, requestID string) (int, error) {
+func (i *ImmichAsset) AlbumImageCount(ctx context.Context, albumID string, requestID string) (int, error) {
 	switch albumID {
 	case AlbumKeywordAll:
-		albums, err := i.allAlbums(requestID)
+		albums, err := i.allAlbums(ctx, requestID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to get all albums: %w", err)
 		}
 		return i.countAssetsInAlbums(albums), nil
 
 	case AlbumKeywordShared:
-		albums, err := i.allSharedAlbums(requestID)
+		albums, err := i.allSharedAlbums(ctx, requestID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to get shared albums: %w", err)
 		}
 		return i.countAssetsInAlbums(albums), nil
 
 	case AlbumKeywordFavourites, AlbumKeywordFavorites:
-		favouriteImagesCount, err := i.favouriteImagesCount(requestID)
+		favouriteImagesCount, err := i.favouriteImagesCount(ctx, requestID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to get favorite images: %w", err)
 		}
 		return favouriteImagesCount, nil
 
+	case AlbumKeywordMemories:
+		memoriesImageCount, err := i.memoriesImageCount(ctx, requestID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get memories: %w", err)
+		}
+		return memoriesImageCount, nil
+
 	default:
-		album, err := i.albumAssets(albumID, requestID)
+		album, err := i.albumAssets(ctx, albumID, requestID)
 		if err != nil {
 			return 0, fmt.Errorf("failed to get album assets for album %s: %w", albumID, err)
 		}
@@ -126,8 +134,8 @@ func (i *ImmichAsset) AlbumImageCount(albumID string, requestID string) (int, er
 }
 
 // RandomImageFromAlbum retrieve random image within a specified album from Immich
-func (i *ImmichAsset) RandomImageFromAlbum(albumID, requestID, kioskDeviceID string, isPrefetch bool) error {
-	album, err := i.albumAssets(albumID, requestID)
+func (i *ImmichAsset) RandomImageFromAlbum(ctx context.Context, albumID, requestID, kioskDeviceID string, isPrefetch bool) error {
+	album, err := i.albumAssets(ctx, albumID, requestID)
 	if err != nil {
 		return err
 	}
@@ -141,26 +149,34 @@ func (i *ImmichAsset) RandomImageFromAlbum(albumID, requestID, kioskDeviceID str
 		album.Assets[i], album.Assets[j] = album.Assets[j], album.Assets[i]
 	})
 
+	excluded, err := i.excludedAssets(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	anyExcluded := false
+
 	for _, pick := range album.Assets {
-		// We only want images and that are not trashed or archived (unless wanted by user)
-		if pick.Type != ImageType || pick.IsTrashed || (pick.IsArchived && !requestConfig.ShowArchived) || !i.ratioCheck(&pick) {
+		if excluded.contains(pick.ID) {
+			anyExcluded = true
 			continue
 		}
 
-		*i = pick
-		break
-	}
+		// We only want supported assets that are not trashed or archived (unless wanted by user)
+		if !i.isSupportedAssetType(pick.Type) || pick.IsTrashed || (pick.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&pick) {
+			continue
+		}
 
-	if i.ID == "" {
-		log.Error("no images found", "for album", albumID)
-		return fmt.Errorf("no images found for album %s", albumID)
+		i.setAsset(pick)
+		return nil
 	}
 
-	return nil
+	log.Error("no images found", "for album", albumID)
+	return noViableAssets("album "+albumID, anyExcluded)
 }
 
-func (i *ImmichAsset) RandomAlbumFromSharedAlbums(requestID string) (string, error) {
-	albums, err := i.allSharedAlbums(requestID)
+func (i *ImmichAsset) RandomAlbumFromSharedAlbums(ctx context.Context, requestID string) (string, error) {
+	albums, err := i.allSharedAlbums(ctx, requestID)
 	if err != nil {
 		return "", err
 	}
@@ -174,13 +190,13 @@ func (i *ImmichAsset) RandomAlbumFromSharedAlbums(requestID string) (string, err
 		})
 	}
 
-	pickedAlbum := utils.PickRandomImageType(requestConfig.Kiosk.AssetWeighting, albumsWithWeighting)
+	pickedAlbum := utils.PickRandomImageType(i.requestConfig.Kiosk.AssetWeighting, albumsWithWeighting)
 
 	return pickedAlbum.ID, nil
 }
 
-func (i *ImmichAsset) RandomAlbumFromAllAlbums(requestID string) (string, error) {
-	albums, err := i.allAlbums(requestID)
+func (i *ImmichAsset) RandomAlbumFromAllAlbums(ctx context.Context, requestID string) (string, error) {
+	albums, err := i.allAlbums(ctx, requestID)
 	if err != nil {
 		return "", err
 	}
@@ -194,7 +210,7 @@ func (i *ImmichAsset) RandomAlbumFromAllAlbums(requestID string) (string, error)
 		})
 	}
 
-	pickedAlbum := utils.PickRandomImageType(requestConfig.Kiosk.AssetWeighting, albumsWithWeighting)
+	pickedAlbum := utils.PickRandomImageType(i.requestConfig.Kiosk.AssetWeighting, albumsWithWeighting)
 
 	return pickedAlbum.ID, nil
 }
@@ -0,0 +1,281 @@
+package immich
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/metrics"
+)
+
+const (
+	// clientMaxAttempts the number of times a request is sent before giving up
+	clientMaxAttempts = 3
+	// clientRetryBackoff the wait before the first retry, doubled for every retry after that
+	clientRetryBackoff = 500 * time.Millisecond
+)
+
+// idSegment matches url path segments holding an ID
+var idSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// apiEndpoint returns the path of apiUrl with IDs replaced, so requests can be grouped by endpoint.
+func apiEndpoint(apiUrl string) string {
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return "unknown"
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// Client sends requests to the Immich api.
+//
+// Every request is bound to a context so a request is abandoned as soon as the
+// kiosk request that needs it is cancelled. Failed requests are retried with
+// exponential backoff, but only when sending them again is safe: idempotent
+// requests are retried on any failure, all other requests only on a 5xx response.
+type Client struct {
+	apiKey     string
+	httpClient *http.Client
+	// streamClient sends requests whose responses can take longer to read than the timeout, e.g. videos
+	streamClient *http.Client
+
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// httpClients the http clients for one timeout, shared by every Client with that timeout
+// so their connections are kept alive and reused between requests.
+type httpClients struct {
+	api    *http.Client
+	stream *http.Client
+}
+
+var (
+	httpClientsMu sync.Mutex
+	// httpClientsByTimeout the http clients made so far, by timeout
+	httpClientsByTimeout = map[time.Duration]httpClients{}
+)
+
+// clientsFor returns the http clients for timeout, making them the first time they are needed.
+func clientsFor(timeout time.Duration) httpClients {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	clients, found := httpClientsByTimeout[timeout]
+	if !found {
+		clients = httpClients{
+			api:    &http.Client{Timeout: timeout},
+			stream: &http.Client{Transport: streamTransport(timeout)},
+		}
+		httpClientsByTimeout[timeout] = clients
+	}
+
+	return clients
+}
+
+// NewClient returns a client that authenticates with the given api key.
+// A timeout of zero or less means requests have no timeout.
+func NewClient(apiKey string, timeout time.Duration) *Client {
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	clients := clientsFor(timeout)
+
+	return &Client{
+		apiKey:       apiKey,
+		httpClient:   clients.api,
+		streamClient: clients.stream,
+		maxAttempts:  clientMaxAttempts,
+		backoff:      clientRetryBackoff,
+	}
+}
+
+// streamTransport returns a transport whose timeouts only cover connecting and waiting for the
+// response headers, so a response body can be streamed for as long as it takes.
+func streamTransport(timeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = timeout
+	return transport
+}
+
+// readOnlyPosts endpoints that are sent as POST requests but only read from Immich.
+var readOnlyPosts = []string{
+	"/api/search/metadata",
+	"/api/search/random",
+	"/api/search/smart",
+}
+
+// isIdempotent reports whether a request with the given method to endpoint can safely be sent more than once.
+func isIdempotent(method, endpoint string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return slices.Contains(readOnlyPosts, endpoint)
+	default:
+		return false
+	}
+}
+
+// shouldRetry reports whether a request with the given method to endpoint should be sent again
+// after it failed with the given response or error.
+func shouldRetry(method, endpoint string, res *http.Response, err error) bool {
+	if err != nil {
+		return isIdempotent(method, endpoint)
+	}
+
+	return res.StatusCode >= http.StatusInternalServerError
+}
+
+// wait blocks for the backoff of the given attempt or until the context is done.
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(c.backoff << attempt)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Do sends a request with the given method, body and headers to Immich and returns the response.
+// Responses with an unexpected status code are returned as is once retries are used up.
+// The caller is responsible for closing the response body.
+func (c *Client) Do(ctx context.Context, method, apiUrl string, body []byte, header http.Header) (*http.Response, error) {
+	return c.send(ctx, c.httpClient, method, apiUrl, body, header)
+}
+
+// Stream is like Do, but the client timeout only covers waiting for the response headers.
+// Reading the response body is limited by ctx alone, so long videos are not cut off.
+func (c *Client) Stream(ctx context.Context, method, apiUrl string, header http.Header) (*http.Response, error) {
+	return c.send(ctx, c.streamClient, method, apiUrl, nil, header)
+}
+
+// send sends the request with httpClient, retrying failed requests when it is safe to.
+func (c *Client) send(ctx context.Context, httpClient *http.Client, method, apiUrl string, body []byte, header http.Header) (*http.Response, error) {
+
+	endpoint := apiEndpoint(apiUrl)
+
+	for attempt := 0; attempt < c.maxAttempts; attempt++ {
+
+		if attempt > 0 {
+			metrics.ImmichRetries.WithLabelValues(endpoint).Inc()
+			if err := c.wait(ctx, attempt-1); err != nil {
+				return nil, err
+			}
+		}
+
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, apiUrl, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+
+		req.Header.Set("x-api-key", c.apiKey)
+
+		start := time.Now()
+		res, err := httpClient.Do(req)
+
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(res.StatusCode)
+		}
+		metrics.ImmichRequests.WithLabelValues(endpoint, status).Inc()
+		metrics.ImmichRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+		// the kiosk request has gone away so there is no one to retry for
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if res != nil {
+				res.Body.Close()
+			}
+			return nil, ctxErr
+		}
+
+		lastAttempt := attempt == c.maxAttempts-1
+
+		if !shouldRetry(method, endpoint, res, err) || lastAttempt {
+			if err != nil {
+				return nil, err
+			}
+			return res, nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		log.Error("Request failed, retrying", "attempt", attempt+1, "URL", apiUrl, "err", err)
+	}
+
+	return nil, errors.New("request failed: no attempts made")
+}
+
+// Fetch sends a json request to Immich and returns the body of a successful response.
+func (c *Client) Fetch(ctx context.Context, method, apiUrl string, body []byte) ([]byte, error) {
+
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+
+	if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.Do(ctx, method, apiUrl, body, header)
+	if err != nil {
+		log.Error("Request failed", "URL", apiUrl, "err", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		log.Error(err)
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Error("reading response body", "url", apiUrl, "err", err)
+		return nil, err
+	}
+
+	return responseBody, nil
+}
@@ -0,0 +1,146 @@
+package immich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-querystring/query"
+)
+
+// ErrAllAssetsExcluded is returned when every asset that could be displayed for a source is excluded
+var ErrAllAssetsExcluded = errors.New("no assets left after exclusions")
+
+// noViableAssets returns the error for a source without a displayable asset.
+// If any of its assets were excluded the error wraps ErrAllAssetsExcluded.
+func noViableAssets(source string, anyExcluded bool) error {
+	if anyExcluded {
+		return fmt.Errorf("%w for %s", ErrAllAssetsExcluded, source)
+	}
+	return fmt.Errorf("no viable images found for %s", source)
+}
+
+// assetExclusions IDs of assets that must never be displayed
+type assetExclusions map[string]struct{}
+
+// contains reports whether the asset with the given ID is excluded.
+func (e assetExclusions) contains(assetID string) bool {
+	_, excluded := e[assetID]
+	return excluded
+}
+
+// personAssetIDs retrieves the IDs of all assets of a specific person from Immich.
+func (i *ImmichAsset) personAssetIDs(ctx context.Context, personID, requestID string) ([]string, error) {
+
+	assetIDs := []string{}
+	pageCount := 1
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal("parsing url", err)
+	}
+
+	requestBody := ImmichSearchRandomBody{
+		PersonIds:    []string{personID},
+		WithArchived: true,
+		Size:         1000,
+	}
+
+	for {
+
+		var personAssets ImmichSearchMetadataAssetsResponse
+
+		requestBody.Page = pageCount
+
+		// convert body to queries so url is unique and can be cached.
+		// assetIDs is added so the response is not confused with cached asset counts
+		queries, _ := query.Values(requestBody)
+		queries.Set("assetIDs", "true")
+
+		apiUrl := url.URL{
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Path:     "api/search/metadata",
+			RawQuery: queries.Encode(),
+		}
+
+		jsonBody, err := json.Marshal(requestBody)
+		if err != nil {
+			log.Fatal("marshaling request body", err)
+		}
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, personAssets)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(personAssets, err, apiBody, apiUrl.String())
+			return assetIDs, err
+		}
+
+		err = json.Unmarshal(apiBody, &personAssets)
+		if err != nil {
+			_, err = immichApiFail(personAssets, err, apiBody, apiUrl.String())
+			return assetIDs, err
+		}
+
+		for _, asset := range personAssets.Assets.Items {
+			assetIDs = append(assetIDs, asset.ID)
+		}
+
+		if personAssets.Assets.NextPage == "" {
+			break
+		}
+
+		pageCount++
+	}
+
+	return assetIDs, nil
+}
+
+// excludedAssets returns the IDs of the assets set in exclude_asset, along with the assets
+// within the albums set in exclude_album and the assets of the people set in exclude_person.
+// Album and person assets are retrieved through cached api calls.
+func (i *ImmichAsset) excludedAssets(ctx context.Context, requestID string) (assetExclusions, error) {
+	excluded := assetExclusions{}
+
+	for _, assetID := range i.requestConfig.ExcludeAsset {
+		excluded[assetID] = struct{}{}
+	}
+
+	for _, albumID := range i.requestConfig.ExcludeAlbum {
+		album, err := i.albumAssets(ctx, albumID, requestID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, asset := range album.Assets {
+			excluded[asset.ID] = struct{}{}
+		}
+	}
+
+	for _, personID := range i.requestConfig.ExcludePerson {
+		assetIDs, err := i.personAssetIDs(ctx, personID, requestID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, assetID := range assetIDs {
+			excluded[assetID] = struct{}{}
+		}
+	}
+
+	return excluded, nil
+}
+
+// IsExcluded reports whether the asset with the given ID must never be displayed with the
+// config of i, because it is in exclude_asset, within an excluded album or of an excluded person.
+func (i *ImmichAsset) IsExcluded(ctx context.Context, assetID, requestID string) (bool, error) {
+	excluded, err := i.excludedAssets(ctx, requestID)
+	if err != nil {
+		return false, err
+	}
+
+	return excluded.contains(assetID), nil
+}
@@ -1,17 +1,18 @@
 package immich
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 
 	"github.com/charmbracelet/log"
 )
 
-func (i *ImmichAsset) CheckForFaces(requestID string) {
+func (i *ImmichAsset) CheckForFaces(ctx context.Context, requestID string) {
 
 	var faces []Face
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -23,7 +24,7 @@ func (i *ImmichAsset) CheckForFaces(requestID string) {
 		RawQuery: "id=" + i.ID,
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, faces)
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, faces)
 	body, err := immichApiCall("GET", apiUrl.String(), nil)
 	if err != nil {
 		_, err = immichApiFail(faces, err, body, apiUrl.String())
@@ -1,6 +1,7 @@
 package immich
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -12,25 +13,25 @@ import (
 )
 
 // favouriteImagesCount retrieves the total count of favorite images from the Immich server.
-func (i *ImmichAsset) favouriteImagesCount(requestID string) (int, error) {
+func (i *ImmichAsset) favouriteImagesCount(ctx context.Context, requestID string) (int, error) {
 
 	var allFavouritesCount int
 	pageCount := 1
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal("parsing url", err)
 	}
 
 	requestBody := ImmichSearchRandomBody{
-		Type:       string(ImageType),
+		Type:       i.searchAssetType(),
 		IsFavorite: true,
 		WithPeople: false,
 		WithExif:   false,
-		Size:       requestConfig.Kiosk.FetchedAssetsSize,
+		Size:       i.requestConfig.Kiosk.FetchedAssetsSize,
 	}
 
-	if requestConfig.ShowArchived {
+	if i.requestConfig.ShowArchived {
 		requestBody.WithArchived = true
 	}
 
@@ -55,7 +56,7 @@ func (i *ImmichAsset) favouriteImagesCount(requestID string) (int, error) {
 			log.Fatal("marshaling request body", err)
 		}
 
-		immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, favourites)
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, favourites)
 		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
 		if err != nil {
 			_, err = immichApiFail(favourites, err, apiBody, apiUrl.String())
@@ -81,7 +82,7 @@ func (i *ImmichAsset) favouriteImagesCount(requestID string) (int, error) {
 }
 
 // RandomImageFromFavourites retrieves a random favorite image from the Immich server.
-func (i *ImmichAsset) RandomImageFromFavourites(requestID, kioskDeviceID string, isPrefetch bool) error {
+func (i *ImmichAsset) RandomImageFromFavourites(ctx context.Context, requestID, kioskDeviceID string, isPrefetch bool) error {
 
 	if isPrefetch {
 		log.Debug(requestID, "PREFETCH", kioskDeviceID, "Getting Random favourite image", true)
@@ -89,22 +90,20 @@ func (i *ImmichAsset) RandomImageFromFavourites(requestID, kioskDeviceID string,
 		log.Debug(requestID + " Getting Random favourite image")
 	}
 
-	var immichAssets []ImmichAsset
-
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal("parsing url", err)
 	}
 
 	requestBody := ImmichSearchRandomBody{
-		Type:       string(ImageType),
+		Type:       i.searchAssetType(),
 		IsFavorite: true,
 		WithExif:   true,
 		WithPeople: true,
-		Size:       requestConfig.Kiosk.FetchedAssetsSize,
+		Size:       i.requestConfig.Kiosk.FetchedAssetsSize,
 	}
 
-	if requestConfig.ShowArchived {
+	if i.requestConfig.ShowArchived {
 		requestBody.WithArchived = true
 	}
 
@@ -123,52 +122,71 @@ func (i *ImmichAsset) RandomImageFromFavourites(requestID, kioskDeviceID string,
 		log.Fatal("marshaling request body", err)
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, immichAssets)
-	apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	// refresh the cached assets once before giving up, so favourites that are all excluded can not loop forever
+	anyExcluded := false
 
-	err = json.Unmarshal(apiBody, &immichAssets)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	for attempts := 0; attempts < 2; attempts++ {
 
-	if len(immichAssets) == 0 {
-		log.Debug(requestID + " No images left in cache. Refreshing and trying again")
-		apiCache.Delete(apiUrl.String())
-		return i.RandomImageFromFavourites(requestID, kioskDeviceID, isPrefetch)
-	}
+		var immichAssets []ImmichAsset
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, immichAssets)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
 
-	for immichAssetIndex, img := range immichAssets {
-		// We only want images and that are not trashed or archived (unless wanted by user)
-		if img.Type != ImageType || img.IsTrashed || (img.IsArchived && !requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+		err = json.Unmarshal(apiBody, &immichAssets)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		if len(immichAssets) == 0 {
+			log.Debug(requestID + " No images left in cache. Refreshing and trying again")
+			apiCache.Delete(i.apiCacheKey(apiUrl.String()))
 			continue
 		}
 
-		if requestConfig.Kiosk.Cache {
-			// Remove the current image from the slice
-			immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
-			jsonBytes, err := json.Marshal(immichAssetsToCache)
-			if err != nil {
-				log.Error("Failed to marshal immichAssetsToCache", "error", err)
-				return err
+		excluded, err := i.excludedAssets(ctx, requestID)
+		if err != nil {
+			return err
+		}
+
+		for immichAssetIndex, img := range immichAssets {
+			if excluded.contains(img.ID) {
+				anyExcluded = true
+				continue
+			}
+
+			// We only want supported assets that are not trashed or archived (unless wanted by user)
+			if !i.isSupportedAssetType(img.Type) || img.IsTrashed || (img.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+				continue
 			}
 
-			// replace cwith cache minus used image
-			err = apiCache.Replace(apiUrl.String(), jsonBytes, cache.DefaultExpiration)
-			if err != nil {
-				log.Debug("cache not found!")
+			if i.requestConfig.Kiosk.Cache {
+				// Remove the current image from the slice
+				immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
+				jsonBytes, err := json.Marshal(immichAssetsToCache)
+				if err != nil {
+					log.Error("Failed to marshal immichAssetsToCache", "error", err)
+					return err
+				}
+
+				// replace cwith cache minus used image
+				err = apiCache.Replace(i.apiCacheKey(apiUrl.String()), jsonBytes, cache.DefaultExpiration)
+				if err != nil {
+					log.Debug("cache not found!")
+				}
 			}
+
+			i.setAsset(img)
+			return nil
 		}
 
-		*i = img
-		return nil
+		log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
+		apiCache.Delete(i.apiCacheKey(apiUrl.String()))
 	}
 
-	log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
-	apiCache.Delete(apiUrl.String())
-	return i.RandomImage(requestID, kioskDeviceID, isPrefetch)
+	return noViableAssets("favourites", anyExcluded)
 }
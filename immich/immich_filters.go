@@ -0,0 +1,136 @@
+package immich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-querystring/query"
+
+	"github.com/damongolding/immich-kiosk/utils"
+)
+
+const (
+	FilterDateRange   string = "DATE_RANGE"
+	FilterCity        string = "CITY"
+	FilterState       string = "STATE"
+	FilterCountry     string = "COUNTRY"
+	FilterCameraMake  string = "CAMERA_MAKE"
+	FilterCameraModel string = "CAMERA_MODEL"
+	FilterTag         string = "TAG"
+)
+
+// SearchFilter narrows down the assets Immich returns to those matching a date range or location.
+// The zero value applies no filter.
+type SearchFilter struct {
+	// Type one of the Filter* constants
+	Type string
+	// Value the date range, city, state, country, camera make, camera model or tag ID to filter by
+	Value string
+}
+
+// apply adds the filter to the given search body.
+func (f SearchFilter) apply(requestBody *ImmichSearchRandomBody) error {
+	switch f.Type {
+	case "":
+		return nil
+	case FilterDateRange:
+		dateRange, err := utils.ParseDateRange(f.Value)
+		if err != nil {
+			return err
+		}
+		requestBody.TakenAfter = dateRange.From.Format(time.RFC3339)
+		requestBody.TakenBefore = dateRange.To.Format(time.RFC3339)
+	case FilterCity:
+		requestBody.City = f.Value
+	case FilterState:
+		requestBody.State = f.Value
+	case FilterCountry:
+		requestBody.Country = f.Value
+	case FilterCameraMake:
+		requestBody.Make = f.Value
+	case FilterCameraModel:
+		requestBody.Model = f.Value
+	case FilterTag:
+		requestBody.TagIds = []string{f.Value}
+	default:
+		return fmt.Errorf("unknown search filter %q", f.Type)
+	}
+
+	return nil
+}
+
+// SearchFilterImageCount retrieves the number of assets matching the given filter.
+func (i *ImmichAsset) SearchFilterImageCount(ctx context.Context, filter SearchFilter, requestID string) (int, error) {
+
+	var filterCount int
+	pageCount := 1
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal("parsing url", err)
+	}
+
+	requestBody := ImmichSearchRandomBody{
+		Type:       i.searchAssetType(),
+		WithPeople: false,
+		WithExif:   false,
+		Size:       i.requestConfig.Kiosk.FetchedAssetsSize,
+	}
+
+	if i.requestConfig.ShowArchived {
+		requestBody.WithArchived = true
+	}
+
+	if err := filter.apply(&requestBody); err != nil {
+		return 0, err
+	}
+
+	for {
+
+		var filtered ImmichSearchMetadataResponse
+
+		requestBody.Page = pageCount
+
+		// convert body to queries so url is unique and can be cached
+		queries, _ := query.Values(requestBody)
+
+		apiUrl := url.URL{
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Path:     "api/search/metadata",
+			RawQuery: queries.Encode(),
+		}
+
+		jsonBody, err := json.Marshal(requestBody)
+		if err != nil {
+			log.Fatal("marshaling request body", err)
+		}
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, filtered)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(filtered, err, apiBody, apiUrl.String())
+			return filterCount, err
+		}
+
+		err = json.Unmarshal(apiBody, &filtered)
+		if err != nil {
+			_, err = immichApiFail(filtered, err, apiBody, apiUrl.String())
+			return filterCount, err
+		}
+
+		filterCount += filtered.Assets.Total
+
+		if filtered.Assets.NextPage == "" {
+			break
+		}
+
+		pageCount++
+	}
+
+	return filterCount, nil
+}
@@ -1,17 +1,16 @@
 package immich
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"path"
-	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/patrickmn/go-cache"
+
+	"github.com/damongolding/immich-kiosk/metrics"
 )
 
 // immichApiFail handles failures in Immich API calls by unmarshaling the error response,
@@ -27,30 +26,39 @@ func immichApiFail[T ImmichApiResponse](value T, err error, body []byte, apiUrl
 	return value, fmt.Errorf("%s : %v", immichError.Error, immichError.Message)
 }
 
-// immichApiCallDecorator Decorator to impliment cache for the immichApiCall func
-func immichApiCallDecorator[T ImmichApiResponse](immichApiCall ImmichApiCall, requestID string, jsonShape T) ImmichApiCall {
+// apiCacheKey returns the key used to cache the response of the given api url.
+// Keys are partitioned by account so one account's assets are never served to another account.
+func (i *ImmichAsset) apiCacheKey(apiUrl string) string {
+	return i.requestConfig.Account + "|" + apiUrl
+}
+
+// immichApiCallDecorator Decorator to impliment cache for the immichApiCall func of the given asset
+func immichApiCallDecorator[T ImmichApiResponse](ctx context.Context, i *ImmichAsset, requestID string, jsonShape T) ImmichApiCall {
 	return func(method, apiUrl string, body []byte) ([]byte, error) {
 
-		if !requestConfig.Kiosk.Cache {
-			return immichApiCall(method, apiUrl, body)
+		if !i.requestConfig.Kiosk.Cache {
+			return i.immichApiCall(ctx, method, apiUrl, body)
 		}
 
 		apiCacheLock.Lock()
 		defer apiCacheLock.Unlock()
 
-		if apiData, found := apiCache.Get(apiUrl); found {
-			if requestConfig.Kiosk.DebugVerbose {
+		apiData, found := apiCache.Get(i.apiCacheKey(apiUrl))
+		metrics.CacheLookup(metrics.CacheAPI, found)
+
+		if found {
+			if i.requestConfig.Kiosk.DebugVerbose {
 				log.Debug(requestID+" Cache hit", "url", apiUrl)
 			}
 			log.Debug(requestID+" Cache hit", "url", apiUrl)
 			return apiData.([]byte), nil
 		}
 
-		if requestConfig.Kiosk.DebugVerbose {
+		if i.requestConfig.Kiosk.DebugVerbose {
 			log.Debug(requestID+" Cache miss", "url", apiUrl)
 		}
 
-		apiBody, err := immichApiCall(method, apiUrl, body)
+		apiBody, err := i.immichApiCall(ctx, method, apiUrl, body)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -70,8 +78,8 @@ func immichApiCallDecorator[T ImmichApiResponse](immichApiCall ImmichApiCall, re
 			return nil, err
 		}
 
-		apiCache.Set(apiUrl, jsonBytes, cache.DefaultExpiration)
-		if requestConfig.Kiosk.DebugVerbose {
+		apiCache.Set(i.apiCacheKey(apiUrl), jsonBytes, cache.DefaultExpiration)
+		if i.requestConfig.Kiosk.DebugVerbose {
 			log.Debug(requestID+" Cache saved", "url", apiUrl)
 		}
 
@@ -80,57 +88,30 @@ func immichApiCallDecorator[T ImmichApiResponse](immichApiCall ImmichApiCall, re
 }
 
 // immichApiCall bootstrap for immich api call
-func (i *ImmichAsset) immichApiCall(method, apiUrl string, body []byte) ([]byte, error) {
-
-	var responseBody []byte
-
-	for attempts := 0; attempts < 3; attempts++ {
-
-		var bodyReader io.Reader
-		if body != nil {
-			bodyReader = bytes.NewReader(body)
-		}
-
-		req, err := http.NewRequest(method, apiUrl, bodyReader)
-		if err != nil {
-			log.Error(err)
-			return responseBody, err
-		}
-
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("x-api-key", requestConfig.ImmichApiKey)
-
-		if method == "POST" || method == "PUT" || method == "PATCH" {
-			req.Header.Set("Content-Type", "application/json")
-		}
-
-		res, err := httpClient.Do(req)
-		if err != nil {
-			log.Error("Request failed, retrying", "attempt", attempts, "URL", apiUrl, "err", err)
-			time.Sleep(time.Duration(attempts) * time.Second)
-			continue
-		}
-
-		defer res.Body.Close()
-
-		if res.StatusCode < 200 || res.StatusCode >= 300 {
-			err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
-			log.Error(err)
-			_, _ = io.Copy(io.Discard, res.Body)
-			return responseBody, err
-		}
-
-		responseBody, err = io.ReadAll(res.Body)
-		if err != nil {
-			log.Error("reading response body", "url", apiUrl, "err", err)
-			return responseBody, err
-		}
-
-		return responseBody, nil
+func (i *ImmichAsset) immichApiCall(ctx context.Context, method, apiUrl string, body []byte) ([]byte, error) {
+	return i.client.Fetch(ctx, method, apiUrl, body)
+}
 
+// isSupportedAssetType reports whether an asset of the given type can be displayed.
+// Images are always supported, videos only when ShowVideos is enabled.
+func (i *ImmichAsset) isSupportedAssetType(assetType ImmichAssetType) bool {
+	switch assetType {
+	case ImageType:
+		return true
+	case VideoType:
+		return i.requestConfig.ShowVideos
+	default:
+		return false
 	}
+}
 
-	return responseBody, fmt.Errorf("Request failed: max retries exceeded")
+// searchAssetType returns the asset type to request from Immich's search endpoints.
+// An empty string requests all asset types, which is needed when videos are wanted.
+func (i *ImmichAsset) searchAssetType() string {
+	if i.requestConfig.ShowVideos {
+		return ""
+	}
+	return string(ImageType)
 }
 
 // ratioCheck checks if the given image matches the desired ratio.
@@ -182,10 +163,10 @@ func (i *ImmichAsset) addRatio() {
 }
 
 // AssetInfo fetches the image information from Immich
-func (i *ImmichAsset) AssetInfo(requestID string) {
+func (i *ImmichAsset) AssetInfo(ctx context.Context, requestID string) {
 	var immichAsset ImmichAsset
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Error(err)
 		return
@@ -197,7 +178,7 @@ func (i *ImmichAsset) AssetInfo(requestID string) {
 		Path:   path.Join("api", "assets", i.ID),
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, immichAsset)
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, immichAsset)
 	body, err := immichApiCall("GET", apiUrl.String(), nil)
 	if err != nil {
 		_, err = immichApiFail(immichAsset, err, body, apiUrl.String())
@@ -212,22 +193,22 @@ func (i *ImmichAsset) AssetInfo(requestID string) {
 		return
 	}
 
-	*i = immichAsset
+	i.setAsset(immichAsset)
 }
 
 // ImagePreview fetches the raw image data from Immich
-func (i *ImmichAsset) ImagePreview() ([]byte, error) {
+func (i *ImmichAsset) ImagePreview(ctx context.Context) ([]byte, error) {
 
 	var bytes []byte
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Error(err)
 		return bytes, err
 	}
 
 	assetSize := AssetSizeThumbnail
-	if requestConfig.UseOriginalImage {
+	if i.requestConfig.UseOriginalImage {
 		assetSize = AssetSizeOriginal
 	}
 
@@ -238,7 +219,7 @@ func (i *ImmichAsset) ImagePreview() ([]byte, error) {
 		RawQuery: "size=preview",
 	}
 
-	return i.immichApiCall("GET", apiUrl.String(), nil)
+	return i.immichApiCall(ctx, "GET", apiUrl.String(), nil)
 }
 
 // FacesCenterPoint calculates the center point of all detected faces in an image as percentages.
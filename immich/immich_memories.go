@@ -0,0 +1,276 @@
+package immich
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-querystring/query"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/damongolding/immich-kiosk/utils"
+)
+
+// memoriesMaxYears how many years back to look for memories
+const memoriesMaxYears = 30
+
+// memoryWindow a single day, in an earlier year, matching today's month and day
+type memoryWindow struct {
+	YearsAgo    int
+	TakenAfter  time.Time
+	TakenBefore time.Time
+}
+
+// memoryWindows returns a window for today's month and day in each of the previous years.
+// Years where the date does not exist (e.g. the 29th of February) are skipped.
+func memoryWindows(now time.Time, maxYears int) []memoryWindow {
+	windows := []memoryWindow{}
+
+	for yearsAgo := 1; yearsAgo <= maxYears; yearsAgo++ {
+		start := time.Date(now.Year()-yearsAgo, now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+		// time.Date normalises dates that do not exist, e.g. 29th of February -> 1st of March
+		if start.Month() != now.Month() || start.Day() != now.Day() {
+			continue
+		}
+
+		windows = append(windows, memoryWindow{
+			YearsAgo:    yearsAgo,
+			TakenAfter:  start,
+			TakenBefore: start.AddDate(0, 0, 1),
+		})
+	}
+
+	return windows
+}
+
+// memoryRequestBody returns the search body for assets taken within the given window.
+func (i *ImmichAsset) memoryRequestBody(window memoryWindow) ImmichSearchRandomBody {
+	requestBody := ImmichSearchRandomBody{
+		Type:        i.searchAssetType(),
+		TakenAfter:  window.TakenAfter.Format(time.RFC3339),
+		TakenBefore: window.TakenBefore.Format(time.RFC3339),
+		WithExif:    true,
+		WithPeople:  true,
+		Size:        i.requestConfig.Kiosk.FetchedAssetsSize,
+	}
+
+	if i.requestConfig.ShowArchived {
+		requestBody.WithArchived = true
+	}
+
+	return requestBody
+}
+
+// memoryWindowCount retrieves the number of assets taken within the given window.
+func (i *ImmichAsset) memoryWindowCount(ctx context.Context, window memoryWindow, requestID string) (int, error) {
+
+	var windowCount int
+	pageCount := 1
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal("parsing url", err)
+	}
+
+	requestBody := i.memoryRequestBody(window)
+	requestBody.WithExif = false
+	requestBody.WithPeople = false
+
+	for {
+
+		var memories ImmichSearchMetadataResponse
+
+		requestBody.Page = pageCount
+
+		// convert body to queries so url is unique and can be cached
+		queries, _ := query.Values(requestBody)
+
+		apiUrl := url.URL{
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Path:     "api/search/metadata",
+			RawQuery: queries.Encode(),
+		}
+
+		jsonBody, err := json.Marshal(requestBody)
+		if err != nil {
+			log.Fatal("marshaling request body", err)
+		}
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, memories)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(memories, err, apiBody, apiUrl.String())
+			return windowCount, err
+		}
+
+		err = json.Unmarshal(apiBody, &memories)
+		if err != nil {
+			_, err = immichApiFail(memories, err, apiBody, apiUrl.String())
+			return windowCount, err
+		}
+
+		windowCount += memories.Assets.Total
+
+		if memories.Assets.NextPage == "" {
+			break
+		}
+
+		pageCount++
+	}
+
+	return windowCount, nil
+}
+
+// memoriesWithWeighting returns the memory windows that contain assets, weighted by their asset count.
+func (i *ImmichAsset) memoriesWithWeighting(ctx context.Context, requestID string) (map[string]memoryWindow, []utils.AssetWithWeighting, error) {
+	windows := map[string]memoryWindow{}
+	windowsWithWeighting := []utils.AssetWithWeighting{}
+
+	for _, window := range memoryWindows(time.Now(), memoriesMaxYears) {
+		count, err := i.memoryWindowCount(ctx, window, requestID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		windowID := strconv.Itoa(window.YearsAgo)
+		windows[windowID] = window
+		windowsWithWeighting = append(windowsWithWeighting, utils.AssetWithWeighting{
+			Asset:  utils.WeightedAsset{Type: "MEMORY", ID: windowID},
+			Weight: count,
+		})
+	}
+
+	return windows, windowsWithWeighting, nil
+}
+
+// memoriesImageCount retrieves the number of assets taken on today's month and day in previous years.
+func (i *ImmichAsset) memoriesImageCount(ctx context.Context, requestID string) (int, error) {
+	_, windowsWithWeighting, err := i.memoriesWithWeighting(ctx, requestID)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, window := range windowsWithWeighting {
+		total += window.Weight
+	}
+
+	return total, nil
+}
+
+// RandomImageFromMemories retrieves a random asset taken on today's month and day in a previous year.
+func (i *ImmichAsset) RandomImageFromMemories(ctx context.Context, requestID, kioskDeviceID string, isPrefetch bool) error {
+
+	if isPrefetch {
+		log.Debug(requestID, "PREFETCH", kioskDeviceID, "Getting Random memory", true)
+	} else {
+		log.Debug(requestID + " Getting Random memory")
+	}
+
+	windows, windowsWithWeighting, err := i.memoriesWithWeighting(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	if len(windowsWithWeighting) == 0 {
+		log.Error("no memories found for today")
+		return fmt.Errorf("no memories found for today")
+	}
+
+	pickedWindow := utils.PickRandomImageType(i.requestConfig.Kiosk.AssetWeighting, windowsWithWeighting)
+
+	return i.randomImageFromMemoryWindow(ctx, windows[pickedWindow.ID], requestID)
+}
+
+// randomImageFromMemoryWindow retrieves a random asset taken within the given window.
+func (i *ImmichAsset) randomImageFromMemoryWindow(ctx context.Context, window memoryWindow, requestID string) error {
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal("parsing url", err)
+	}
+
+	requestBody := i.memoryRequestBody(window)
+
+	// convert body to queries so url is unique and can be cached
+	queries, _ := query.Values(requestBody)
+
+	apiUrl := url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     "api/search/random",
+		RawQuery: fmt.Sprintf("kiosk=%x", sha256.Sum256([]byte(queries.Encode()))),
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		log.Fatal("marshaling request body", err)
+	}
+
+	// memory windows are small, so only refresh the cached assets once before giving up
+	for attempts := 0; attempts < 2; attempts++ {
+
+		var immichAssets []ImmichAsset
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, immichAssets)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		err = json.Unmarshal(apiBody, &immichAssets)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		excluded, err := i.excludedAssets(ctx, requestID)
+		if err != nil {
+			return err
+		}
+
+		for immichAssetIndex, img := range immichAssets {
+			// We only want supported assets that are not trashed, excluded or archived (unless wanted by user)
+			if !i.isSupportedAssetType(img.Type) || img.IsTrashed || excluded.contains(img.ID) || (img.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+				continue
+			}
+
+			if i.requestConfig.Kiosk.Cache {
+				// Remove the current image from the slice
+				immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
+				jsonBytes, err := json.Marshal(immichAssetsToCache)
+				if err != nil {
+					log.Error("Failed to marshal immichAssetsToCache", "error", err)
+					return err
+				}
+
+				// replace cwith cache minus used image
+				err = apiCache.Replace(i.apiCacheKey(apiUrl.String()), jsonBytes, cache.DefaultExpiration)
+				if err != nil {
+					log.Debug("cache not found!")
+				}
+			}
+
+			img.IsMemory = true
+			i.setAsset(img)
+			return nil
+		}
+
+		log.Debug(requestID+" No viable memories left in cache. Refreshing and trying again", "years ago", window.YearsAgo)
+		apiCache.Delete(i.apiCacheKey(apiUrl.String()))
+	}
+
+	return fmt.Errorf("no viable memories found for %d years ago", window.YearsAgo)
+}
@@ -1,6 +1,7 @@
 package immich
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -15,11 +16,11 @@ import (
 
 // DEPRECIATED
 // personAssets retrieves all assets associated with a specific person from Immich.
-func (i *ImmichAsset) personAssets(personID, requestID string) ([]ImmichAsset, error) {
+func (i *ImmichAsset) personAssets(ctx context.Context, personID, requestID string) ([]ImmichAsset, error) {
 
 	var images []ImmichAsset
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -30,7 +31,7 @@ func (i *ImmichAsset) personAssets(personID, requestID string) ([]ImmichAsset, e
 		Path:   path.Join("api", "people", personID, "assets"),
 	}
 
-	immichApiCal := immichApiCallDecorator(i.immichApiCall, requestID, images)
+	immichApiCal := immichApiCallDecorator(ctx, i, requestID, images)
 	body, err := immichApiCal("GET", apiUrl.String(), nil)
 	if err != nil {
 		return immichApiFail(images, err, body, apiUrl.String())
@@ -45,11 +46,11 @@ func (i *ImmichAsset) personAssets(personID, requestID string) ([]ImmichAsset, e
 }
 
 // PersonImageCount returns the number of images associated with a specific person in Immich.
-func (i *ImmichAsset) PersonImageCount(personID, requestID string) (int, error) {
+func (i *ImmichAsset) PersonImageCount(ctx context.Context, personID, requestID string) (int, error) {
 
 	var personStatistics ImmichPersonStatistics
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -60,7 +61,7 @@ func (i *ImmichAsset) PersonImageCount(personID, requestID string) (int, error)
 		Path:   path.Join("api", "people", personID, "statistics"),
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, personStatistics)
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, personStatistics)
 	body, err := immichApiCall("GET", apiUrl.String(), nil)
 	if err != nil {
 		_, err = immichApiFail(personStatistics, err, body, apiUrl.String())
@@ -78,9 +79,9 @@ func (i *ImmichAsset) PersonImageCount(personID, requestID string) (int, error)
 
 // DEPRECIATED
 // RandomImageOfPerson retrieve random image of person from Immich
-func (i *ImmichAsset) OLDRandomImageOfPerson(personID, requestID, kioskDeviceID string, isPrefetch bool) error {
+func (i *ImmichAsset) OLDRandomImageOfPerson(ctx context.Context, personID, requestID, kioskDeviceID string, isPrefetch bool) error {
 
-	images, err := i.personAssets(personID, requestID)
+	images, err := i.personAssets(ctx, personID, requestID)
 	if err != nil {
 		return err
 	}
@@ -94,13 +95,18 @@ func (i *ImmichAsset) OLDRandomImageOfPerson(personID, requestID, kioskDeviceID
 		images[i], images[j] = images[j], images[i]
 	})
 
+	excluded, err := i.excludedAssets(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
 	for _, pick := range images {
-		// Filter out non-image assets, trashed, archived (unless configured), and incorrect ratio
-		if pick.Type != ImageType || pick.IsTrashed || (pick.IsArchived && !requestConfig.ShowArchived) || !i.ratioCheck(&pick) {
+		// Filter out non-image assets, trashed, excluded, archived (unless configured), and incorrect ratio
+		if !i.isSupportedAssetType(pick.Type) || pick.IsTrashed || excluded.contains(pick.ID) || (pick.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&pick) {
 			continue
 		}
 
-		*i = pick
+		i.setAsset(pick)
 		break
 	}
 
@@ -128,24 +134,22 @@ func (i *ImmichAsset) OLDRandomImageOfPerson(personID, requestID, kioskDeviceID
 }
 
 // RandomImageOfPerson retrieve random image of person from Immich
-func (i *ImmichAsset) RandomImageOfPerson(personID, requestID, kioskDeviceID string, isPrefetch bool) error {
-
-	var immichAssets []ImmichAsset
+func (i *ImmichAsset) RandomImageOfPerson(ctx context.Context, personID, requestID, kioskDeviceID string, isPrefetch bool) error {
 
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal("parsing url", err)
 	}
 
 	requestBody := ImmichSearchRandomBody{
 		PersonIds:  []string{personID},
-		Type:       string(ImageType),
+		Type:       i.searchAssetType(),
 		WithExif:   true,
 		WithPeople: true,
-		Size:       requestConfig.Kiosk.FetchedAssetsSize,
+		Size:       i.requestConfig.Kiosk.FetchedAssetsSize,
 	}
 
-	if requestConfig.ShowArchived {
+	if i.requestConfig.ShowArchived {
 		requestBody.WithArchived = true
 	}
 
@@ -164,52 +168,71 @@ func (i *ImmichAsset) RandomImageOfPerson(personID, requestID, kioskDeviceID str
 		log.Fatal("marshaling request body", err)
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, immichAssets)
-	apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	// refresh the cached assets once before giving up, so a person whose assets are all excluded can not loop forever
+	anyExcluded := false
 
-	err = json.Unmarshal(apiBody, &immichAssets)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	for attempts := 0; attempts < 2; attempts++ {
 
-	if len(immichAssets) == 0 {
-		log.Debug(requestID + " No images left in cache. Refreshing and trying again")
-		apiCache.Delete(apiUrl.String())
-		return i.RandomImageOfPerson(personID, requestID, kioskDeviceID, isPrefetch)
-	}
+		var immichAssets []ImmichAsset
 
-	for immichAssetIndex, img := range immichAssets {
-		// We only want images and that are not trashed or archived (unless wanted by user)
-		if img.Type != ImageType || img.IsTrashed || (img.IsArchived && !requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, immichAssets)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		err = json.Unmarshal(apiBody, &immichAssets)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		if len(immichAssets) == 0 {
+			log.Debug(requestID + " No images left in cache. Refreshing and trying again")
+			apiCache.Delete(i.apiCacheKey(apiUrl.String()))
 			continue
 		}
 
-		if requestConfig.Kiosk.Cache {
-			// Remove the current image from the slice
-			immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
-			jsonBytes, err := json.Marshal(immichAssetsToCache)
-			if err != nil {
-				log.Error("Failed to marshal immichAssetsToCache", "error", err)
-				return err
+		excluded, err := i.excludedAssets(ctx, requestID)
+		if err != nil {
+			return err
+		}
+
+		for immichAssetIndex, img := range immichAssets {
+			if excluded.contains(img.ID) {
+				anyExcluded = true
+				continue
 			}
 
-			// replace cwith cache minus used image
-			err = apiCache.Replace(apiUrl.String(), jsonBytes, cache.DefaultExpiration)
-			if err != nil {
-				log.Debug("cache not found!")
+			// We only want supported assets that are not trashed or archived (unless wanted by user)
+			if !i.isSupportedAssetType(img.Type) || img.IsTrashed || (img.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+				continue
 			}
+
+			if i.requestConfig.Kiosk.Cache {
+				// Remove the current image from the slice
+				immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
+				jsonBytes, err := json.Marshal(immichAssetsToCache)
+				if err != nil {
+					log.Error("Failed to marshal immichAssetsToCache", "error", err)
+					return err
+				}
+
+				// replace cwith cache minus used image
+				err = apiCache.Replace(i.apiCacheKey(apiUrl.String()), jsonBytes, cache.DefaultExpiration)
+				if err != nil {
+					log.Debug("cache not found!")
+				}
+			}
+
+			i.setAsset(img)
+			return nil
 		}
 
-		*i = img
-		return nil
+		log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
+		apiCache.Delete(i.apiCacheKey(apiUrl.String()))
 	}
 
-	log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
-	apiCache.Delete(apiUrl.String())
-	return i.RandomImageOfPerson(personID, requestID, kioskDeviceID, isPrefetch)
+	return noViableAssets("person "+personID, anyExcluded)
 }
@@ -1,18 +1,22 @@
 package immich
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"path"
+	"strings"
 
 	"github.com/charmbracelet/log"
 	"github.com/google/go-querystring/query"
 	"github.com/patrickmn/go-cache"
 )
 
-// GetRandomImage retrieve a random image from Immich
-func (i *ImmichAsset) RandomImage(requestID, kioskDeviceID string, isPrefetch bool) error {
+// GetRandomImage retrieve a random image from Immich.
+// The given filter limits the images to a date range or location, the zero value SearchFilter applies no filter.
+func (i *ImmichAsset) RandomImage(ctx context.Context, filter SearchFilter, requestID, kioskDeviceID string, isPrefetch bool) error {
 
 	if isPrefetch {
 		log.Debug(requestID, "PREFETCH", kioskDeviceID, "Getting Random image", true)
@@ -20,25 +24,27 @@ func (i *ImmichAsset) RandomImage(requestID, kioskDeviceID string, isPrefetch bo
 		log.Debug(requestID + " Getting Random image")
 	}
 
-	var immichAssets []ImmichAsset
-
-	u, err := url.Parse(requestConfig.ImmichUrl)
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
 	if err != nil {
 		log.Fatal("parsing url", err)
 		return err
 	}
 
 	requestBody := ImmichSearchRandomBody{
-		Type:       string(ImageType),
+		Type:       i.searchAssetType(),
 		WithExif:   true,
 		WithPeople: true,
-		Size:       requestConfig.Kiosk.FetchedAssetsSize,
+		Size:       i.requestConfig.Kiosk.FetchedAssetsSize,
 	}
 
-	if requestConfig.ShowArchived {
+	if i.requestConfig.ShowArchived {
 		requestBody.WithArchived = true
 	}
 
+	if err := filter.apply(&requestBody); err != nil {
+		return err
+	}
+
 	// convert body to queries so url is unique and can be cached
 	queries, _ := query.Values(requestBody)
 
@@ -54,52 +60,111 @@ func (i *ImmichAsset) RandomImage(requestID, kioskDeviceID string, isPrefetch bo
 		log.Fatal("marshaling request body", err)
 	}
 
-	immichApiCall := immichApiCallDecorator(i.immichApiCall, requestID, immichAssets)
-	apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	// a fresh page of random assets can still hold no viable ones, so only refresh the cached assets once before giving up
+	anyExcluded := false
 
-	err = json.Unmarshal(apiBody, &immichAssets)
-	if err != nil {
-		_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
-		return err
-	}
+	for attempts := 0; attempts < 2; attempts++ {
 
-	if len(immichAssets) == 0 {
-		log.Debug(requestID + " No images left in cache. Refreshing and trying again")
-		apiCache.Delete(apiUrl.String())
-		return i.RandomImage(requestID, kioskDeviceID, isPrefetch)
-	}
+		var immichAssets []ImmichAsset
+
+		immichApiCall := immichApiCallDecorator(ctx, i, requestID, immichAssets)
+		apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
+
+		err = json.Unmarshal(apiBody, &immichAssets)
+		if err != nil {
+			_, err = immichApiFail(immichAssets, err, apiBody, apiUrl.String())
+			return err
+		}
 
-	for immichAssetIndex, img := range immichAssets {
-		// We only want images and that are not trashed or archived (unless wanted by user)
-		if img.Type != ImageType || img.IsTrashed || (img.IsArchived && !requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+		if len(immichAssets) == 0 {
+			log.Debug(requestID + " No images left in cache. Refreshing and trying again")
+			apiCache.Delete(i.apiCacheKey(apiUrl.String()))
 			continue
 		}
 
-		if requestConfig.Kiosk.Cache {
-			// Remove the current image from the slice
-			immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
-			jsonBytes, err := json.Marshal(immichAssetsToCache)
-			if err != nil {
-				log.Error("Failed to marshal immichAssetsToCache", "error", err)
-				return err
+		excluded, err := i.excludedAssets(ctx, requestID)
+		if err != nil {
+			return err
+		}
+
+		for immichAssetIndex, img := range immichAssets {
+			if excluded.contains(img.ID) {
+				anyExcluded = true
+				continue
 			}
 
-			// replace cwith cache minus used image
-			err = apiCache.Replace(apiUrl.String(), jsonBytes, cache.DefaultExpiration)
-			if err != nil {
-				log.Debug("cache not found!")
+			// We only want supported assets that are not trashed or archived (unless wanted by user)
+			if !i.isSupportedAssetType(img.Type) || img.IsTrashed || (img.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+				continue
 			}
+
+			if i.requestConfig.Kiosk.Cache {
+				// Remove the current image from the slice
+				immichAssetsToCache := append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
+				jsonBytes, err := json.Marshal(immichAssetsToCache)
+				if err != nil {
+					log.Error("Failed to marshal immichAssetsToCache", "error", err)
+					return err
+				}
+
+				// replace cwith cache minus used image
+				err = apiCache.Replace(i.apiCacheKey(apiUrl.String()), jsonBytes, cache.DefaultExpiration)
+				if err != nil {
+					log.Debug("cache not found!")
+				}
+			}
+
+			i.setAsset(img)
+			return nil
 		}
 
-		*i = img
-		return nil
+		log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
+		apiCache.Delete(i.apiCacheKey(apiUrl.String()))
+	}
+
+	if filter.Type != "" {
+		return noViableAssets(fmt.Sprintf("%s %q", strings.ToLower(filter.Type), filter.Value), anyExcluded)
+	}
+
+	return noViableAssets("random images", anyExcluded)
+}
+
+// LibraryImageCount returns the number of assets in the library, counting videos only when they are shown.
+func (i *ImmichAsset) LibraryImageCount(ctx context.Context, requestID string) (int, error) {
+
+	var statistics ImmichAssetStatistics
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiUrl := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join("api", "assets", "statistics"),
+	}
+
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, statistics)
+	body, err := immichApiCall("GET", apiUrl.String(), nil)
+	if err != nil {
+		_, err = immichApiFail(statistics, err, body, apiUrl.String())
+		return 0, err
+	}
+
+	err = json.Unmarshal(body, &statistics)
+	if err != nil {
+		_, err = immichApiFail(statistics, err, body, apiUrl.String())
+		return 0, err
+	}
+
+	if i.requestConfig.ShowVideos {
+		return statistics.Images + statistics.Videos, nil
 	}
 
-	log.Debug(requestID + " No viable images left in cache. Refreshing and trying again")
-	apiCache.Delete(apiUrl.String())
-	return i.RandomImage(requestID, kioskDeviceID, isPrefetch)
+	return statistics.Images, nil
 }
@@ -0,0 +1,156 @@
+package immich
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-querystring/query"
+	"github.com/patrickmn/go-cache"
+)
+
+// smartSearch retrieves the assets that best match the given text prompt using Immich's smart (CLIP) search.
+// It returns the search response along with the URL the response is cached under.
+func (i *ImmichAsset) smartSearch(ctx context.Context, searchQuery, requestID string) (ImmichSearchSmartResponse, string, error) {
+
+	var searchResponse ImmichSearchSmartResponse
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal("parsing url", err)
+	}
+
+	requestBody := ImmichSearchSmartBody{
+		Query:    searchQuery,
+		Type:     i.searchAssetType(),
+		WithExif: true,
+		Size:     i.requestConfig.Kiosk.FetchedAssetsSize,
+	}
+
+	if i.requestConfig.ShowArchived {
+		requestBody.WithArchived = true
+	}
+
+	// convert body to queries so url is unique and can be cached
+	queries, _ := query.Values(requestBody)
+
+	apiUrl := url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     "api/search/smart",
+		RawQuery: fmt.Sprintf("kiosk=%x", sha256.Sum256([]byte(queries.Encode()))),
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		log.Fatal("marshaling request body", err)
+	}
+
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, searchResponse)
+	apiBody, err := immichApiCall("POST", apiUrl.String(), jsonBody)
+	if err != nil {
+		_, err = immichApiFail(searchResponse, err, apiBody, apiUrl.String())
+		return searchResponse, apiUrl.String(), err
+	}
+
+	err = json.Unmarshal(apiBody, &searchResponse)
+	if err != nil {
+		_, err = immichApiFail(searchResponse, err, apiBody, apiUrl.String())
+		return searchResponse, apiUrl.String(), err
+	}
+
+	return searchResponse, apiUrl.String(), nil
+}
+
+// SearchImageCount returns the number of assets left to show for the given text prompt.
+// Assets are removed from the cached search as they are shown, so once they have all been shown
+// the search is sent to Immich again.
+func (i *ImmichAsset) SearchImageCount(ctx context.Context, searchQuery, requestID string) (int, error) {
+	searchResponse, apiUrl, err := i.smartSearch(ctx, searchQuery, requestID)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(searchResponse.Assets.Items) == 0 && searchResponse.Assets.Total > 0 {
+		log.Debug(requestID+" No search results left in cache. Refreshing", "query", searchQuery)
+		apiCache.Delete(i.apiCacheKey(apiUrl))
+
+		searchResponse, _, err = i.smartSearch(ctx, searchQuery, requestID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(searchResponse.Assets.Items), nil
+}
+
+// RandomImageFromSearch retrieve a random image matching the given text prompt from Immich.
+func (i *ImmichAsset) RandomImageFromSearch(ctx context.Context, searchQuery, requestID, kioskDeviceID string, isPrefetch bool) error {
+
+	if isPrefetch {
+		log.Debug(requestID, "PREFETCH", kioskDeviceID, "Getting Random image from search", searchQuery)
+	} else {
+		log.Debug(requestID+" Getting Random image from search", "query", searchQuery)
+	}
+
+	anyExcluded := false
+
+	// search results are the same each time, so only refresh the cached assets once before giving up
+	for attempts := 0; attempts < 2; attempts++ {
+
+		searchResponse, apiUrl, err := i.smartSearch(ctx, searchQuery, requestID)
+		if err != nil {
+			return err
+		}
+
+		immichAssets := searchResponse.Assets.Items
+
+		excluded, err := i.excludedAssets(ctx, requestID)
+		if err != nil {
+			return err
+		}
+
+		// search results are ordered by relevance, so pick from them at random
+		for _, immichAssetIndex := range rand.Perm(len(immichAssets)) {
+			img := immichAssets[immichAssetIndex]
+
+			if excluded.contains(img.ID) {
+				anyExcluded = true
+				continue
+			}
+
+			// We only want supported assets that are not trashed or archived (unless wanted by user)
+			if !i.isSupportedAssetType(img.Type) || img.IsTrashed || (img.IsArchived && !i.requestConfig.ShowArchived) || !i.ratioCheck(&img) {
+				continue
+			}
+
+			if i.requestConfig.Kiosk.Cache {
+				// Remove the current image from the slice
+				searchResponse.Assets.Items = append(immichAssets[:immichAssetIndex], immichAssets[immichAssetIndex+1:]...)
+				jsonBytes, err := json.Marshal(searchResponse)
+				if err != nil {
+					log.Error("Failed to marshal searchResponse", "error", err)
+					return err
+				}
+
+				// replace cwith cache minus used image
+				err = apiCache.Replace(i.apiCacheKey(apiUrl), jsonBytes, cache.DefaultExpiration)
+				if err != nil {
+					log.Debug("cache not found!")
+				}
+			}
+
+			i.setAsset(img)
+			return nil
+		}
+
+		log.Debug(requestID+" No viable search results left in cache. Refreshing and trying again", "query", searchQuery)
+		apiCache.Delete(i.apiCacheKey(apiUrl))
+	}
+
+	return noViableAssets(fmt.Sprintf("search %q", searchQuery), anyExcluded)
+}
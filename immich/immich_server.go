@@ -0,0 +1,80 @@
+package immich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Ping checks that the Immich server can be reached.
+// The call is never cached as it reports on the server right now.
+func (i *ImmichAsset) Ping(ctx context.Context) error {
+
+	var pong struct {
+		Res string `json:"res"`
+	}
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		return err
+	}
+
+	apiUrl := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "api/server/ping",
+	}
+
+	body, err := i.immichApiCall(ctx, "GET", apiUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(body, &pong)
+	if err != nil {
+		return err
+	}
+
+	if pong.Res != "pong" {
+		return fmt.Errorf("unexpected ping response: %q", pong.Res)
+	}
+
+	return nil
+}
+
+// ServerAbout information about the Immich server
+type ServerAbout struct {
+	Version string `json:"version"`
+}
+
+// About returns information about the Immich server. Unlike Ping, the call needs
+// a valid API key, so it also checks that the key is accepted.
+// The call is never cached as it reports on the server right now.
+func (i *ImmichAsset) About(ctx context.Context) (ServerAbout, error) {
+
+	var about ServerAbout
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		return about, err
+	}
+
+	apiUrl := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "api/server/about",
+	}
+
+	body, err := i.immichApiCall(ctx, "GET", apiUrl.String(), nil)
+	if err != nil {
+		return about, err
+	}
+
+	err = json.Unmarshal(body, &about)
+	if err != nil {
+		return about, err
+	}
+
+	return about, nil
+}
@@ -0,0 +1,99 @@
+package immich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// allTags retrieves all tags from Immich.
+func (i *ImmichAsset) allTags(ctx context.Context, requestID string) (ImmichTags, error) {
+	var tags ImmichTags
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiUrl := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "api/tags",
+	}
+
+	immichApiCall := immichApiCallDecorator(ctx, i, requestID, tags)
+	body, err := immichApiCall("GET", apiUrl.String(), nil)
+	if err != nil {
+		return immichApiFail(tags, err, body, apiUrl.String())
+	}
+
+	err = json.Unmarshal(body, &tags)
+	if err != nil {
+		return immichApiFail(tags, err, body, apiUrl.String())
+	}
+
+	return tags, nil
+}
+
+// findTag returns the tag matching the given ID, value (the full path e.g. "Holidays/Portugal") or name.
+// Values and names are matched case-insensitively.
+func (tags ImmichTags) findTag(tag string) (ImmichTag, bool) {
+	for _, t := range tags {
+		if t.ID == tag {
+			return t, true
+		}
+	}
+
+	for _, t := range tags {
+		if strings.EqualFold(t.Value, tag) {
+			return t, true
+		}
+	}
+
+	for _, t := range tags {
+		if strings.EqualFold(t.Name, tag) {
+			return t, true
+		}
+	}
+
+	return ImmichTag{}, false
+}
+
+// tagFilter resolves the given tag ID, value or name to a SearchFilter for that tag.
+func (i *ImmichAsset) tagFilter(ctx context.Context, tag, requestID string) (SearchFilter, error) {
+	tags, err := i.allTags(ctx, requestID)
+	if err != nil {
+		return SearchFilter{}, err
+	}
+
+	foundTag, found := tags.findTag(tag)
+	if !found {
+		return SearchFilter{}, fmt.Errorf("tag %q not found", tag)
+	}
+
+	return SearchFilter{Type: FilterTag, Value: foundTag.ID}, nil
+}
+
+// TagImageCount returns the number of assets with the given tag.
+func (i *ImmichAsset) TagImageCount(ctx context.Context, tag, requestID string) (int, error) {
+	filter, err := i.tagFilter(ctx, tag, requestID)
+	if err != nil {
+		return 0, err
+	}
+
+	return i.SearchFilterImageCount(ctx, filter, requestID)
+}
+
+// RandomImageWithTag retrieve a random image with the given tag from Immich.
+func (i *ImmichAsset) RandomImageWithTag(ctx context.Context, tag, requestID, kioskDeviceID string, isPrefetch bool) error {
+	filter, err := i.tagFilter(ctx, tag, requestID)
+	if err != nil {
+		return err
+	}
+
+	return i.RandomImage(ctx, filter, requestID, kioskDeviceID, isPrefetch)
+}
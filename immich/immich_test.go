@@ -1,9 +1,18 @@
 package immich
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/damongolding/immich-kiosk/config"
 )
 
 func TestArchiveLogic(t *testing.T) {
@@ -157,3 +166,423 @@ func TestFacesCenterPoint(t *testing.T) {
 		})
 	}
 }
+
+func TestIsSupportedAssetType(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		assetType  ImmichAssetType
+		showVideos bool
+		want       bool
+	}{
+		{name: "Image", assetType: ImageType, showVideos: false, want: true},
+		{name: "Image with videos", assetType: ImageType, showVideos: true, want: true},
+		{name: "Video", assetType: VideoType, showVideos: false, want: false},
+		{name: "Video with videos", assetType: VideoType, showVideos: true, want: true},
+		{name: "Audio", assetType: AudioType, showVideos: true, want: false},
+		{name: "Other", assetType: OtherType, showVideos: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewImage(config.Config{ShowVideos: tt.showVideos})
+
+			assert.Equal(t, tt.want, i.isSupportedAssetType(tt.assetType), "Unexpected isSupportedAssetType value")
+		})
+	}
+}
+
+func TestMemoryWindows(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		maxYears      int
+		wantYearsAgo  []int
+		wantFirstFrom string
+		wantFirstTo   string
+	}{
+		{
+			name:          "Regular day",
+			now:           time.Date(2024, time.October, 18, 15, 30, 0, 0, time.UTC),
+			maxYears:      3,
+			wantYearsAgo:  []int{1, 2, 3},
+			wantFirstFrom: "2023-10-18T00:00:00Z",
+			wantFirstTo:   "2023-10-19T00:00:00Z",
+		},
+		{
+			name:          "End of year",
+			now:           time.Date(2024, time.December, 31, 8, 0, 0, 0, time.UTC),
+			maxYears:      1,
+			wantYearsAgo:  []int{1},
+			wantFirstFrom: "2023-12-31T00:00:00Z",
+			wantFirstTo:   "2024-01-01T00:00:00Z",
+		},
+		{
+			name:          "Leap day skips years without the date",
+			now:           time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+			maxYears:      8,
+			wantYearsAgo:  []int{4, 8},
+			wantFirstFrom: "2020-02-29T00:00:00Z",
+			wantFirstTo:   "2020-03-01T00:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := memoryWindows(tt.now, tt.maxYears)
+
+			yearsAgo := []int{}
+			for _, window := range windows {
+				yearsAgo = append(yearsAgo, window.YearsAgo)
+			}
+
+			assert.Equal(t, tt.wantYearsAgo, yearsAgo, "Unexpected memory years")
+			assert.Equal(t, tt.wantFirstFrom, windows[0].TakenAfter.Format(time.RFC3339), "Unexpected window start")
+			assert.Equal(t, tt.wantFirstTo, windows[0].TakenBefore.Format(time.RFC3339), "Unexpected window end")
+		})
+	}
+}
+
+func TestFindTag(t *testing.T) {
+	tags := ImmichTags{
+		{ID: "1", Name: "Portugal", Value: "Holidays/Portugal"},
+		{ID: "2", Name: "Holidays", Value: "Holidays"},
+		{ID: "3", Name: "Portugal", Value: "Work/Portugal"},
+	}
+
+	tests := []struct {
+		name   string
+		tag    string
+		wantID string
+		found  bool
+	}{
+		{name: "By ID", tag: "3", wantID: "3", found: true},
+		{name: "By value", tag: "work/portugal", wantID: "3", found: true},
+		{name: "By name", tag: "holidays", wantID: "2", found: true},
+		{name: "First name match", tag: "Portugal", wantID: "1", found: true},
+		{name: "Not found", tag: "Spain", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, found := tags.findTag(tt.tag)
+			assert.Equal(t, tt.found, found, "Unexpected found")
+			assert.Equal(t, tt.wantID, tag.ID, "Unexpected tag")
+		})
+	}
+}
+
+func TestExcludedAssetIDs(t *testing.T) {
+	i := NewImage(config.Config{ExcludeAsset: []string{"asset-1", "asset-2"}})
+
+	excluded, err := i.excludedAssets(context.Background(), "")
+	assert.NoError(t, err, "Unexpected error")
+
+	assert.True(t, excluded.contains("asset-1"), "asset-1 should be excluded")
+	assert.True(t, excluded.contains("asset-2"), "asset-2 should be excluded")
+	assert.False(t, excluded.contains("asset-3"), "asset-3 should not be excluded")
+}
+
+func TestApiCacheKeyPartitionedByAccount(t *testing.T) {
+	apiUrl := "http://immich:2283/api/albums"
+
+	defaultAccount := NewImage(config.Config{})
+	partnerAccount := NewImage(config.Config{Account: "partner"})
+
+	defaultKey := defaultAccount.apiCacheKey(apiUrl)
+	partnerKey := partnerAccount.apiCacheKey(apiUrl)
+
+	assert.NotEqual(t, defaultKey, partnerKey, "Accounts should not share cache keys")
+}
+
+func TestClientRetries(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		method       string
+		status       int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "GET success", method: "GET", status: http.StatusOK, wantAttempts: 1},
+		{name: "GET 5xx retried", method: "GET", status: http.StatusBadGateway, wantAttempts: 3, wantErr: true},
+		{name: "POST 5xx retried", method: "POST", status: http.StatusServiceUnavailable, wantAttempts: 3, wantErr: true},
+		{name: "GET 4xx not retried", method: "GET", status: http.StatusNotFound, wantAttempts: 1, wantErr: true},
+		{name: "POST 4xx not retried", method: "POST", status: http.StatusBadRequest, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				assert.Equal(t, "key", r.Header.Get("x-api-key"), "Missing api key")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			client := NewClient("key", time.Second)
+			client.backoff = time.Millisecond
+
+			_, err := client.Fetch(context.Background(), tt.method, server.URL, []byte("{}"))
+
+			assert.Equal(t, tt.wantErr, err != nil, "Unexpected error: %v", err)
+			assert.Equal(t, tt.wantAttempts, attempts.Load(), "Unexpected number of attempts")
+		})
+	}
+}
+
+func TestClientNetworkErrorRetries(t *testing.T) {
+
+	// nothing listens on a closed server, so every request fails before a response is received
+	server := httptest.NewServer(http.NotFoundHandler())
+	serverURL := server.URL
+	server.Close()
+
+	client := NewClient("key", time.Second)
+	client.backoff = time.Millisecond
+
+	var attempts atomic.Int32
+	// a client of its own, as the http clients are shared between every Client with the same timeout
+	client.httpClient = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	_, err := client.Fetch(context.Background(), "GET", serverURL, nil)
+	assert.Error(t, err, "Expected an error")
+	assert.Equal(t, int32(3), attempts.Load(), "GET should be retried")
+
+	attempts.Store(0)
+
+	_, err = client.Fetch(context.Background(), "POST", serverURL, []byte("{}"))
+	assert.Error(t, err, "Expected an error")
+	assert.Equal(t, int32(1), attempts.Load(), "POST should not be retried")
+
+	attempts.Store(0)
+
+	_, err = client.Fetch(context.Background(), "POST", serverURL+"/api/search/random", []byte("{}"))
+	assert.Error(t, err, "Expected an error")
+	assert.Equal(t, int32(3), attempts.Load(), "Read-only POST should be retried")
+}
+
+func TestClientsShared(t *testing.T) {
+	first := NewClient("key", time.Second)
+	second := NewClient("other-key", time.Second)
+
+	assert.Same(t, first.httpClient, second.httpClient, "Clients with the same timeout should share connections")
+	assert.Same(t, first.streamClient, second.streamClient, "Clients with the same timeout should share connections")
+	assert.NotSame(t, first.httpClient, NewClient("key", 2*time.Second).httpClient, "Clients with another timeout should not be shared")
+}
+
+func TestClientContextCancelled(t *testing.T) {
+
+	var attempts atomic.Int32
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		cancel()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient("key", time.Second)
+	client.backoff = time.Millisecond
+
+	_, err := client.Fetch(ctx, "GET", server.URL, nil)
+	assert.ErrorIs(t, err, context.Canceled, "Expected the context error")
+	assert.Equal(t, int32(1), attempts.Load(), "Cancelled requests should not be retried")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestApiEndpoint(t *testing.T) {
+
+	tests := []struct {
+		apiUrl string
+		want   string
+	}{
+		{apiUrl: "https://photos.example.com/api/assets/random?count=1", want: "/api/assets/random"},
+		{apiUrl: "https://photos.example.com/api/albums/0b4d29d2-5d0e-4a65-9b6b-1a2b3c4d5e6f", want: "/api/albums/:id"},
+		{apiUrl: "https://photos.example.com/api/people/0B4D29D2-5D0E-4A65-9B6B-1A2B3C4D5E6F/statistics", want: "/api/people/:id/statistics"},
+		{apiUrl: "https://photos.example.com/api/server/about", want: "/api/server/about"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.apiUrl, func(t *testing.T) {
+			assert.Equal(t, tt.want, apiEndpoint(tt.apiUrl))
+		})
+	}
+}
+
+func TestRandomImageGivesUp(t *testing.T) {
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	c := config.Config{ImmichUrl: server.URL, ImmichApiKey: "key"}
+	c.Kiosk.HTTPTimeout = 1
+	c.Kiosk.FetchedAssetsSize = 10
+
+	i := NewImage(c)
+
+	err := i.RandomImage(context.Background(), SearchFilter{Type: FilterCity, Value: "Nowhere"}, "", "", false)
+	assert.ErrorContains(t, err, "no viable images found for city", "Expected an error when no assets match")
+	assert.Equal(t, int32(2), calls.Load(), "Refreshing should be bounded")
+}
+
+func TestRandomImageOfPersonAllExcluded(t *testing.T) {
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`[{"id": "asset-1", "type": "IMAGE"}, {"id": "asset-2", "type": "IMAGE"}]`))
+	}))
+	defer server.Close()
+
+	c := config.Config{ImmichUrl: server.URL, ImmichApiKey: "key", ExcludeAsset: []string{"asset-1", "asset-2"}}
+	c.Kiosk.HTTPTimeout = 1
+	c.Kiosk.FetchedAssetsSize = 10
+
+	i := NewImage(c)
+
+	err := i.RandomImageOfPerson(context.Background(), "person-1", "", "", false)
+	assert.ErrorIs(t, err, ErrAllAssetsExcluded, "Expected the exclusions error")
+	assert.Equal(t, int32(2), calls.Load(), "Refreshing should be bounded")
+}
+
+// newSearchStandIn returns a test server answering smart searches with the given assets,
+// and the number of searches it has answered.
+func newSearchStandIn(t *testing.T, assetIDs ...string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var searches atomic.Int32
+
+	items := make([]map[string]string, len(assetIDs))
+	for i, id := range assetIDs {
+		items[i] = map[string]string{"id": id, "type": "IMAGE"}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/search/smart" {
+			http.NotFound(w, r)
+			return
+		}
+		searches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"assets": map[string]any{"total": len(items), "items": items},
+		})
+	}))
+
+	return server, &searches
+}
+
+// searchConfig returns a config using the search stand in, with cached api responses.
+func searchConfig(server *httptest.Server) config.Config {
+	c := config.Config{ImmichUrl: server.URL, ImmichApiKey: "key"}
+	c.Kiosk.HTTPTimeout = 1
+	c.Kiosk.FetchedAssetsSize = 10
+	c.Kiosk.Cache = true
+	return c
+}
+
+func TestSearchImageCount(t *testing.T) {
+	server, searches := newSearchStandIn(t, "asset-1", "asset-2", "asset-3")
+	defer server.Close()
+
+	i := NewImage(searchConfig(server))
+
+	count, err := i.SearchImageCount(context.Background(), "dogs", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	assert.NoError(t, i.RandomImageFromSearch(context.Background(), "dogs", "", "", false))
+
+	count, err = i.SearchImageCount(context.Background(), "dogs", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count, "Shown assets should not be counted")
+	assert.Equal(t, int32(1), searches.Load(), "Searches should be cached")
+}
+
+func TestSearchImageCountRefresh(t *testing.T) {
+	server, searches := newSearchStandIn(t, "asset-1")
+	defer server.Close()
+
+	i := NewImage(searchConfig(server))
+
+	assert.NoError(t, i.RandomImageFromSearch(context.Background(), "dogs", "", "", false))
+	assert.Equal(t, "asset-1", i.ID)
+
+	count, err := i.SearchImageCount(context.Background(), "dogs", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "The search should be refreshed once every asset has been shown")
+	assert.Equal(t, int32(2), searches.Load())
+}
+
+func TestRandomImageFromSearchExclusions(t *testing.T) {
+	server, searches := newSearchStandIn(t, "asset-1", "asset-2", "asset-3")
+	defer server.Close()
+
+	c := searchConfig(server)
+	c.ExcludeAsset = []string{"asset-1"}
+
+	i := NewImage(c)
+
+	shown := []string{}
+	for range 3 {
+		assert.NoError(t, i.RandomImageFromSearch(context.Background(), "dogs", "", "", false))
+		assert.NotEqual(t, "asset-1", i.ID, "Excluded assets should never be shown")
+		shown = append(shown, i.ID)
+	}
+
+	assert.ElementsMatch(t, []string{"asset-2", "asset-3"}, shown[:2], "Each asset should be shown before the search is refreshed")
+	assert.Equal(t, int32(2), searches.Load(), "The search should be refreshed once the cached assets are used up")
+
+	c.ExcludeAsset = []string{"asset-1", "asset-2", "asset-3"}
+	i = NewImage(c)
+
+	err := i.RandomImageFromSearch(context.Background(), "dogs", "", "", false)
+	assert.ErrorIs(t, err, ErrAllAssetsExcluded, "Expected the exclusions error")
+}
+
+func TestClientStreamOutlivesTimeout(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		_, _ = w.Write([]byte("video"))
+	}))
+	defer server.Close()
+
+	client := NewClient("key", 50*time.Millisecond)
+
+	res, err := client.Stream(context.Background(), http.MethodGet, server.URL, nil)
+	assert.NoError(t, err, "Response headers arrive within the timeout")
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err, "Streaming should not be cut off by the client timeout")
+	assert.Equal(t, "video", string(body))
+
+	res, err = client.Do(context.Background(), http.MethodGet, server.URL, nil, nil)
+	if err == nil {
+		_, err = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	assert.Error(t, err, "Regular requests should still time out")
+}
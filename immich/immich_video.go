@@ -0,0 +1,61 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/charmbracelet/log"
+)
+
+// videoProxyHeaders request headers from the browser that are forwarded to Immich
+// so seeking and conditional requests work through the kiosk proxy.
+var videoProxyHeaders = []string{
+	"Range",
+	"If-Range",
+	"If-None-Match",
+	"If-Modified-Since",
+}
+
+// VideoPlayback requests the video playback stream for the asset from Immich.
+// Selected request headers from the browser (e.g. Range) are forwarded so the
+// response can be proxied as is. The caller is responsible for closing the response body.
+func (i *ImmichAsset) VideoPlayback(ctx context.Context, requestHeaders http.Header) (*http.Response, error) {
+
+	u, err := url.Parse(i.requestConfig.ImmichUrl)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	apiUrl := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join("api", "assets", i.ID, "video", "playback"),
+	}
+
+	header := http.Header{}
+	for _, h := range videoProxyHeaders {
+		if value := requestHeaders.Get(h); value != "" {
+			header.Set(h, value)
+		}
+	}
+
+	// the stream lasts as long as the kiosk request, however long the video is
+	res, err := i.client.Stream(ctx, http.MethodGet, apiUrl.String(), header)
+	if err != nil {
+		log.Error("video playback request failed", "URL", apiUrl.String(), "err", err)
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		res.Body.Close()
+		err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		log.Error(err)
+		return nil, err
+	}
+
+	return res, nil
+}
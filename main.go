@@ -27,6 +27,9 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/diskcache"
+	"github.com/damongolding/immich-kiosk/metrics"
+	"github.com/damongolding/immich-kiosk/mqtt"
 	"github.com/damongolding/immich-kiosk/routes"
 	"github.com/damongolding/immich-kiosk/weather"
 )
@@ -58,6 +61,9 @@ func main() {
 
 	if baseConfig.Kiosk.WatchConfig {
 		log.Infof("Watching %s for changes", baseConfig.V.ConfigFileUsed())
+		baseConfig.OnReload(func() {
+			routes.PushEvent("", routes.EventReload)
+		})
 		baseConfig.WatchConfig()
 	}
 
@@ -74,18 +80,37 @@ func main() {
 		log.Debug("🕐", "current_time", time.Now().Format(time.Kitchen), "current_zone", zone)
 	}
 
+	if baseConfig.Kiosk.DiskCacheDir != "" {
+		diskCache, err := diskcache.New(baseConfig.Kiosk.DiskCacheDir, int64(baseConfig.Kiosk.DiskCacheSize)*1024*1024)
+		if err != nil {
+			log.Error("Failed to open disk cache", "dir", baseConfig.Kiosk.DiskCacheDir, "err", err)
+		} else {
+			log.Debug("Disk cache opened", "dir", baseConfig.Kiosk.DiskCacheDir, "entries", diskCache.Len())
+			routes.ImageDiskCache = diskCache
+		}
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
 
+	// event streams stay open, so they are ended for the server to shut down
+	e.Server.RegisterOnShutdown(routes.CloseEventStreams)
+
 	// Middleware
 	e.Use(middleware.Recover())
 	e.Use(middleware.RequestID())
 	if baseConfig.Kiosk.Password != "" {
 		e.Use(middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
 			Skipper: func(c echo.Context) bool {
-				// skip auth for assets
-				return strings.HasPrefix(c.Request().URL.String(), "/assets")
+				// skip auth for assets. Signed asset urls carry their own authentication
+				// the admin dashboard uses the admin password and the api uses the api token.
+				// Health checks are left open for orchestrators and uptime monitors
+				return strings.HasPrefix(c.Request().URL.String(), "/assets") ||
+					strings.HasPrefix(c.Request().URL.String(), "/asset/") ||
+					strings.HasPrefix(c.Request().URL.String(), "/admin") ||
+					strings.HasPrefix(c.Request().URL.String(), "/api/") ||
+					c.Path() == "/healthz" || c.Path() == "/readyz"
 			},
 			KeyLookup: "query:password,form:password",
 			Validator: func(queryPassword string, c echo.Context) (bool, error) {
@@ -114,6 +139,10 @@ func main() {
 
 	e.POST("/image/previous", routes.PreviousImage(baseConfig))
 
+	e.GET("/video/:videoID", routes.Video(baseConfig))
+
+	e.GET("/asset/:id", routes.Asset)
+
 	e.GET("/clock", routes.Clock(baseConfig))
 
 	e.GET("/weather", routes.Weather(baseConfig))
@@ -122,8 +151,42 @@ func main() {
 
 	e.GET("/cache/flush", routes.FlushCache)
 
+	e.GET("/events", routes.Events)
+
+	e.POST("/events/:event", routes.SendEvent)
+
 	e.POST("/refresh/check", routes.RefreshCheck(baseConfig))
 
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
+	e.GET("/healthz", routes.Healthz)
+
+	e.GET("/readyz", routes.Readyz(baseConfig))
+
+	admin := e.Group("/admin", routes.AdminAuth(baseConfig))
+
+	admin.GET("", routes.Admin)
+
+	admin.POST("/devices/:deviceID/events/:event", routes.AdminSendEvent)
+
+	api := e.Group("/api/v1", routes.APIAuth(baseConfig))
+
+	api.GET("/devices", routes.APIDevices)
+
+	api.POST("/devices/:deviceID/next", routes.APIEvent(routes.EventNextImage))
+
+	api.POST("/devices/:deviceID/previous", routes.APIEvent(routes.EventPreviousImage))
+
+	api.POST("/devices/:deviceID/pause", routes.APIEvent(routes.EventPause))
+
+	api.POST("/devices/:deviceID/resume", routes.APIEvent(routes.EventResume))
+
+	api.POST("/devices/:deviceID/show", routes.APIShowAsset)
+
+	api.POST("/devices/:deviceID/source", routes.APISetSource)
+
+	api.DELETE("/devices/:deviceID/source", routes.APIClearSource)
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
@@ -131,6 +194,10 @@ func main() {
 		go weather.AddWeatherLocation(ctx, w)
 	}
 
+	if baseConfig.Kiosk.MQTT.Broker != "" {
+		go mqtt.Run(ctx, baseConfig.Kiosk.MQTT, version, routes.MQTTController{})
+	}
+
 	fmt.Printf("\nKiosk listening on port %s\n\n", versionStyle(fmt.Sprintf("%v", baseConfig.Kiosk.Port)))
 
 	go func() {
@@ -0,0 +1,112 @@
+// Package metrics provides the Prometheus metrics exposed on /metrics.
+//
+// Metrics are registered with the default Prometheus registry, so the Go runtime
+// and process metrics are exposed alongside them.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kiosk"
+
+// Cache names
+const (
+	CacheAPI      = "api"
+	CacheViewData = "view_data"
+)
+
+// Image processing stages
+const (
+	StageDecode = "decode"
+	StageBlur   = "blur"
+	StageBase64 = "base64"
+)
+
+var (
+	// ImmichRequests Immich api requests by endpoint and status code. Every attempt is counted
+	ImmichRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "immich_requests_total",
+		Help:      "Immich api requests by endpoint and status code, or error when no response was received.",
+	}, []string{"endpoint", "status"})
+
+	// ImmichRequestDuration time taken by Immich api requests by endpoint
+	ImmichRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "immich_request_duration_seconds",
+		Help:      "Time taken by Immich api requests by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// ImmichRetries Immich api requests sent again after failing
+	ImmichRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "immich_retries_total",
+		Help:      "Immich api requests sent again after failing, by endpoint.",
+	}, []string{"endpoint"})
+
+	// CacheRequests cache lookups by cache and result
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	// ImageProcessingDuration time taken to process images by stage
+	ImageProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_processing_duration_seconds",
+		Help:      "Time taken to process images by stage (decode, blur or base64).",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"stage"})
+
+	// Prefetches background fetches of the next image by outcome
+	Prefetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prefetch_total",
+		Help:      "Background fetches of the next image by outcome (success or error).",
+	}, []string{"outcome"})
+
+	// WeatherRefreshFailures failed weather refreshes by location
+	WeatherRefreshFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "weather_refresh_failures_total",
+		Help:      "Failed weather refreshes by location.",
+	}, []string{"location"})
+)
+
+// CacheLookup records a cache lookup.
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveImageProcessing records the time taken by an image processing stage that began at start.
+func ObserveImageProcessing(stage string, start time.Time) {
+	ImageProcessingDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// RegisterActiveDevices exposes the number of devices returned by count as a gauge.
+func RegisterActiveDevices(count func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_devices",
+		Help:      "Devices seen in the last minute.",
+	}, func() float64 {
+		return float64(count())
+	})
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLookup(t *testing.T) {
+	hits := testutil.ToFloat64(CacheRequests.WithLabelValues(CacheViewData, "hit"))
+	misses := testutil.ToFloat64(CacheRequests.WithLabelValues(CacheViewData, "miss"))
+
+	CacheLookup(CacheViewData, true)
+	CacheLookup(CacheViewData, false)
+	CacheLookup(CacheViewData, false)
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(CacheRequests.WithLabelValues(CacheViewData, "hit")))
+	assert.Equal(t, misses+2, testutil.ToFloat64(CacheRequests.WithLabelValues(CacheViewData, "miss")))
+}
+
+func TestHandler(t *testing.T) {
+	RegisterActiveDevices(func() int { return 3 })
+	Prefetches.WithLabelValues("success").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "kiosk_active_devices 3")
+	assert.Contains(t, rec.Body.String(), `kiosk_prefetch_total{outcome="success"}`)
+}
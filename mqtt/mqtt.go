@@ -0,0 +1,307 @@
+// Package mqtt publishes Kiosk devices to an MQTT broker and controls them with MQTT commands.
+//
+// Devices are announced with Home Assistant discovery, so each device shows up in
+// Home Assistant with switches for sleep and pause, a button for the next image and
+// a sensor for the asset being shown. Commands are turned into the same events
+// pushed to devices by the events routes.
+//
+// The broker is reached through the Client interface, so the package can be tested
+// with a stand-in broker.
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/config"
+)
+
+const (
+	stateOn  = "ON"
+	stateOff = "OFF"
+
+	statusOnline  = "online"
+	statusOffline = "offline"
+
+	// payloadPress payload sent by Home Assistant buttons
+	payloadPress = "PRESS"
+)
+
+// Device a Kiosk device as published to the broker
+type Device struct {
+	ID       string
+	Version  string
+	Online   bool
+	Sleeping bool
+	Paused   bool
+	AssetIDs []string
+}
+
+// Controller gives the bridge access to the devices and the events that can be pushed to them.
+type Controller interface {
+	// Devices returns the known devices
+	Devices() []Device
+	// Push pushes the named event to the device and returns the number of devices it was delivered to
+	Push(deviceID, event string) int
+}
+
+// Client the parts of an MQTT client used by the bridge.
+type Client interface {
+	Publish(topic string, retained bool, payload []byte) error
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+}
+
+// command a command topic and the events its payloads push
+type command struct {
+	// events maps a payload to the event it pushes
+	events map[string]string
+}
+
+// commands the command topics of each device, by entity
+var commands = map[string]command{
+	"sleep": {events: map[string]string{stateOn: "sleep", stateOff: "wake"}},
+	"pause": {events: map[string]string{stateOn: "pause", stateOff: "resume"}},
+	"next":  {events: map[string]string{payloadPress: "next-image"}},
+}
+
+// Bridge publishes devices to the broker and turns commands into events.
+type Bridge struct {
+	client     Client
+	controller Controller
+	settings   config.MQTTSettings
+	version    string
+
+	mu sync.Mutex
+	// announced devices that have had their discovery messages published
+	announced map[string]bool
+	// states the last state published for each device
+	states map[string]string
+}
+
+// NewBridge returns a bridge that publishes the devices of controller with client.
+func NewBridge(client Client, controller Controller, settings config.MQTTSettings, version string) *Bridge {
+	return &Bridge{
+		client:     client,
+		controller: controller,
+		settings:   settings,
+		version:    version,
+		announced:  make(map[string]bool),
+		states:     make(map[string]string),
+	}
+}
+
+// AvailabilityTopic topic telling Home Assistant if Kiosk is connected to the broker.
+func (b *Bridge) AvailabilityTopic() string {
+	return b.settings.Topic + "/status"
+}
+
+func (b *Bridge) stateTopic(deviceID string) string {
+	return fmt.Sprintf("%s/%s/state", b.settings.Topic, deviceID)
+}
+
+func (b *Bridge) commandTopic(deviceID, entity string) string {
+	return fmt.Sprintf("%s/%s/%s/set", b.settings.Topic, deviceID, entity)
+}
+
+// Connected publishes Kiosk as online, subscribes to the command topics and
+// publishes every device again. It is called each time the client connects.
+func (b *Bridge) Connected() error {
+	b.mu.Lock()
+	b.announced = make(map[string]bool)
+	b.states = make(map[string]string)
+	b.mu.Unlock()
+
+	if err := b.client.Publish(b.AvailabilityTopic(), true, []byte(statusOnline)); err != nil {
+		return err
+	}
+
+	if err := b.client.Subscribe(b.settings.Topic+"/+/+/set", b.handleCommand); err != nil {
+		return err
+	}
+
+	return b.Sync()
+}
+
+// Sync publishes discovery messages for new devices and the state of devices that have changed.
+func (b *Bridge) Sync() error {
+	for _, device := range b.controller.Devices() {
+		if err := b.announce(device); err != nil {
+			return err
+		}
+		if err := b.publishState(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// announce publishes the Home Assistant discovery messages of a device not yet announced.
+func (b *Bridge) announce(device Device) error {
+	b.mu.Lock()
+	announced := b.announced[device.ID]
+	b.mu.Unlock()
+
+	if announced {
+		return nil
+	}
+
+	for topic, payload := range b.discovery(device) {
+		message, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if err := b.client.Publish(topic, true, message); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.announced[device.ID] = true
+	b.mu.Unlock()
+
+	return nil
+}
+
+// discovery returns the Home Assistant discovery messages of a device by topic.
+func (b *Bridge) discovery(device Device) map[string]map[string]any {
+	nodeID := "immich_kiosk_" + strings.ReplaceAll(device.ID, "-", "_")
+
+	shortID := device.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+
+	haDevice := map[string]any{
+		"identifiers":  []string{nodeID},
+		"name":         "Immich Kiosk " + shortID,
+		"manufacturer": "Immich Kiosk",
+		"sw_version":   b.version,
+	}
+
+	entity := func(component, object, name string, extra map[string]any) (string, map[string]any) {
+		payload := map[string]any{
+			"name":               name,
+			"unique_id":          nodeID + "_" + object,
+			"object_id":          nodeID + "_" + object,
+			"availability_topic": b.AvailabilityTopic(),
+			"device":             haDevice,
+		}
+		for key, value := range extra {
+			payload[key] = value
+		}
+		return fmt.Sprintf("%s/%s/%s/%s/config", b.settings.DiscoveryPrefix, component, nodeID, object), payload
+	}
+
+	messages := make(map[string]map[string]any)
+
+	add := func(topic string, payload map[string]any) {
+		messages[topic] = payload
+	}
+
+	add(entity("switch", "sleep", "Sleep", map[string]any{
+		"state_topic":    b.stateTopic(device.ID),
+		"value_template": "{{ value_json.sleep }}",
+		"command_topic":  b.commandTopic(device.ID, "sleep"),
+		"icon":           "mdi:sleep",
+	}))
+
+	add(entity("switch", "pause", "Pause", map[string]any{
+		"state_topic":    b.stateTopic(device.ID),
+		"value_template": "{{ value_json.pause }}",
+		"command_topic":  b.commandTopic(device.ID, "pause"),
+		"icon":           "mdi:pause",
+	}))
+
+	add(entity("button", "next", "Next image", map[string]any{
+		"command_topic": b.commandTopic(device.ID, "next"),
+		"payload_press": payloadPress,
+		"icon":          "mdi:skip-next",
+	}))
+
+	add(entity("sensor", "asset", "Current asset", map[string]any{
+		"state_topic":    b.stateTopic(device.ID),
+		"value_template": "{{ value_json.asset }}",
+		"icon":           "mdi:image",
+	}))
+
+	add(entity("binary_sensor", "connected", "Connected", map[string]any{
+		"state_topic":    b.stateTopic(device.ID),
+		"value_template": "{{ value_json.connected }}",
+		"device_class":   "connectivity",
+	}))
+
+	return messages
+}
+
+// onOff returns the Home Assistant state of a switch.
+func onOff(on bool) string {
+	if on {
+		return stateOn
+	}
+	return stateOff
+}
+
+// publishState publishes the state of a device when it has changed since it was last published.
+func (b *Bridge) publishState(device Device) error {
+	state, err := json.Marshal(map[string]string{
+		"sleep":     onOff(device.Sleeping),
+		"pause":     onOff(device.Paused),
+		"connected": onOff(device.Online),
+		"asset":     strings.Join(device.AssetIDs, ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	unchanged := b.states[device.ID] == string(state)
+	b.mu.Unlock()
+
+	if unchanged {
+		return nil
+	}
+
+	if err := b.client.Publish(b.stateTopic(device.ID), true, state); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.states[device.ID] = string(state)
+	b.mu.Unlock()
+
+	return nil
+}
+
+// handleCommand pushes the event for a message on a command topic, then publishes the new state.
+func (b *Bridge) handleCommand(topic string, payload []byte) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.settings.Topic+"/"), "/")
+	if len(parts) != 3 || parts[2] != "set" {
+		return
+	}
+
+	deviceID, entity := parts[0], parts[1]
+
+	cmd, ok := commands[entity]
+	if !ok {
+		log.Warn("Unknown MQTT command", "topic", topic)
+		return
+	}
+
+	event, ok := cmd.events[strings.ToUpper(strings.TrimSpace(string(payload)))]
+	if !ok {
+		log.Warn("Unknown MQTT command payload", "topic", topic, "payload", string(payload))
+		return
+	}
+
+	delivered := b.controller.Push(deviceID, event)
+
+	log.Debug("MQTT command", "deviceID", deviceID, "event", event, "delivered", delivered)
+
+	if err := b.Sync(); err != nil {
+		log.Error("publishing MQTT state", "err", err)
+	}
+}
@@ -0,0 +1,214 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/damongolding/immich-kiosk/config"
+)
+
+// testBroker a stand-in broker that keeps retained messages and delivers messages to subscribers.
+type testBroker struct {
+	mu          sync.Mutex
+	retained    map[string][]byte
+	published   []string
+	subscribers map[string]func(topic string, payload []byte)
+}
+
+func newTestBroker() *testBroker {
+	return &testBroker{
+		retained:    make(map[string][]byte),
+		subscribers: make(map[string]func(topic string, payload []byte)),
+	}
+}
+
+// topicMatches reports whether topic matches filter, supporting the single level wildcard.
+func topicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+
+	if len(filterParts) != len(topicParts) {
+		return false
+	}
+
+	for i, part := range filterParts {
+		if part != "+" && part != topicParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *testBroker) Publish(topic string, retained bool, payload []byte) error {
+	b.mu.Lock()
+	b.published = append(b.published, topic)
+	if retained {
+		b.retained[topic] = payload
+	}
+
+	var handlers []func(topic string, payload []byte)
+	for filter, handler := range b.subscribers {
+		if topicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+
+	return nil
+}
+
+func (b *testBroker) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[topic] = handler
+	return nil
+}
+
+// count returns the number of messages published to topic.
+func (b *testBroker) count(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, published := range b.published {
+		if published == topic {
+			n++
+		}
+	}
+	return n
+}
+
+func (b *testBroker) message(topic string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retained[topic]
+}
+
+// testController a controller that sleeps and wakes its devices like the events routes do.
+type testController struct {
+	mu      sync.Mutex
+	devices []Device
+	pushed  []string
+}
+
+func (c *testController) Devices() []Device {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Device(nil), c.devices...)
+}
+
+func (c *testController) Push(deviceID, event string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pushed = append(c.pushed, deviceID+":"+event)
+
+	for i := range c.devices {
+		if c.devices[i].ID != deviceID {
+			continue
+		}
+		switch event {
+		case "sleep":
+			c.devices[i].Sleeping = true
+		case "wake":
+			c.devices[i].Sleeping = false
+		}
+		return 1
+	}
+
+	return 0
+}
+
+func testSettings() config.MQTTSettings {
+	return config.MQTTSettings{Topic: "immich-kiosk", DiscoveryPrefix: "homeassistant"}
+}
+
+func TestDiscovery(t *testing.T) {
+	broker := newTestBroker()
+	controller := &testController{devices: []Device{{ID: "device-1", Online: true, AssetIDs: []string{"asset-1"}}}}
+
+	bridge := NewBridge(broker, controller, testSettings(), "1.0.0")
+	assert.NoError(t, bridge.Connected())
+
+	assert.Equal(t, statusOnline, string(broker.message("immich-kiosk/status")))
+
+	var sleepSwitch map[string]any
+	assert.NoError(t, json.Unmarshal(broker.message("homeassistant/switch/immich_kiosk_device_1/sleep/config"), &sleepSwitch))
+	assert.Equal(t, "immich-kiosk/device-1/sleep/set", sleepSwitch["command_topic"])
+	assert.Equal(t, "immich-kiosk/device-1/state", sleepSwitch["state_topic"])
+	assert.Equal(t, "immich-kiosk/status", sleepSwitch["availability_topic"])
+
+	for _, topic := range []string{
+		"homeassistant/switch/immich_kiosk_device_1/pause/config",
+		"homeassistant/button/immich_kiosk_device_1/next/config",
+		"homeassistant/sensor/immich_kiosk_device_1/asset/config",
+		"homeassistant/binary_sensor/immich_kiosk_device_1/connected/config",
+	} {
+		assert.NotEmpty(t, broker.message(topic), "Missing discovery message %s", topic)
+	}
+
+	var state map[string]string
+	assert.NoError(t, json.Unmarshal(broker.message("immich-kiosk/device-1/state"), &state))
+	assert.Equal(t, map[string]string{"sleep": "OFF", "pause": "OFF", "connected": "ON", "asset": "asset-1"}, state)
+
+	// nothing has changed, so nothing is published again
+	assert.NoError(t, bridge.Sync())
+	assert.Equal(t, 1, broker.count("immich-kiosk/device-1/state"), "Unchanged state should not be published")
+	assert.Equal(t, 1, broker.count("homeassistant/switch/immich_kiosk_device_1/sleep/config"), "Devices should be announced once")
+}
+
+func TestCommands(t *testing.T) {
+	broker := newTestBroker()
+	controller := &testController{devices: []Device{{ID: "device-1"}}}
+
+	bridge := NewBridge(broker, controller, testSettings(), "1.0.0")
+	assert.NoError(t, bridge.Connected())
+
+	tests := []struct {
+		topic   string
+		payload string
+		pushed  string
+	}{
+		{topic: "immich-kiosk/device-1/sleep/set", payload: "ON", pushed: "device-1:sleep"},
+		{topic: "immich-kiosk/device-1/sleep/set", payload: "off", pushed: "device-1:wake"},
+		{topic: "immich-kiosk/device-1/pause/set", payload: "ON", pushed: "device-1:pause"},
+		{topic: "immich-kiosk/device-1/pause/set", payload: "OFF", pushed: "device-1:resume"},
+		{topic: "immich-kiosk/device-1/next/set", payload: "PRESS", pushed: "device-1:next-image"},
+		{topic: "immich-kiosk/device-1/next/set", payload: "EXPLODE", pushed: ""},
+		{topic: "immich-kiosk/device-1/explode/set", payload: "ON", pushed: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic+" "+tt.payload, func(t *testing.T) {
+			controller.mu.Lock()
+			controller.pushed = nil
+			controller.mu.Unlock()
+
+			assert.NoError(t, broker.Publish(tt.topic, false, []byte(tt.payload)))
+
+			controller.mu.Lock()
+			defer controller.mu.Unlock()
+
+			if tt.pushed == "" {
+				assert.Empty(t, controller.pushed, "Unknown commands should be ignored")
+				return
+			}
+			assert.Equal(t, []string{tt.pushed}, controller.pushed)
+		})
+	}
+
+	assert.NoError(t, broker.Publish("immich-kiosk/device-1/sleep/set", false, []byte("ON")))
+
+	var state map[string]string
+	assert.NoError(t, json.Unmarshal(broker.message("immich-kiosk/device-1/state"), &state))
+	assert.Equal(t, "ON", state["sleep"], "State should be published after a command")
+}
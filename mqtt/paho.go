@@ -0,0 +1,101 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/config"
+)
+
+const (
+	// syncInterval time between publishing changes to devices
+	syncInterval = 5 * time.Second
+	// pahoTimeout time to wait for the broker to confirm a connect, publish or subscribe
+	pahoTimeout = 10 * time.Second
+)
+
+// pahoClient Client backed by the Eclipse Paho MQTT client
+type pahoClient struct {
+	client paho.Client
+}
+
+// wait waits for the broker to confirm token.
+func wait(token paho.Token) error {
+	if !token.WaitTimeout(pahoTimeout) {
+		return errors.New("timed out waiting for the MQTT broker")
+	}
+	return token.Error()
+}
+
+func (p *pahoClient) Publish(topic string, retained bool, payload []byte) error {
+	return wait(p.client.Publish(topic, 1, retained, payload))
+}
+
+func (p *pahoClient) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	return wait(p.client.Subscribe(topic, 1, func(_ paho.Client, message paho.Message) {
+		handler(message.Topic(), message.Payload())
+	}))
+}
+
+// Run connects to the broker and publishes the devices of controller until ctx is done.
+// The client reconnects by itself when the connection to the broker is lost.
+func Run(ctx context.Context, settings config.MQTTSettings, version string, controller Controller) {
+	client := &pahoClient{}
+	bridge := NewBridge(client, controller, settings, version)
+
+	opts := paho.NewClientOptions().
+		AddBroker(settings.Broker).
+		SetClientID(settings.ClientID).
+		SetUsername(settings.Username).
+		SetPassword(settings.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		// commands publish the new state from the message handler
+		SetOrderMatters(false).
+		SetWill(bridge.AvailabilityTopic(), statusOffline, 1, true).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Info("Connected to MQTT broker", "broker", settings.Broker)
+			// publishing waits for the broker, which must not hold up paho's connection handling
+			go func() {
+				if err := bridge.Connected(); err != nil {
+					log.Error("publishing to MQTT broker", "err", err)
+				}
+			}()
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn("Lost connection to MQTT broker", "err", err)
+		})
+
+	client.client = paho.NewClient(opts)
+
+	// with ConnectRetry the token completes once connected, which may never happen
+	client.client.Connect()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if client.client.IsConnectionOpen() {
+				if err := client.Publish(bridge.AvailabilityTopic(), true, []byte(statusOffline)); err != nil {
+					log.Error("publishing to MQTT broker", "err", err)
+				}
+			}
+			client.client.Disconnect(250)
+			return
+		case <-ticker.C:
+			if !client.client.IsConnectionOpen() {
+				continue
+			}
+			if err := bridge.Sync(); err != nil {
+				log.Error("publishing to MQTT broker", "err", err)
+			}
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/patrickmn/go-cache"
 
 	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/diskcache"
 	"github.com/damongolding/immich-kiosk/views"
 )
 
@@ -25,6 +26,9 @@ var (
 	ViewDataCache      *cache.Cache
 	viewDataCacheMutex sync.Mutex
 
+	// ImageDiskCache image and blurred background bytes kept on disk. nil when disabled
+	ImageDiskCache *diskcache.Cache
+
 	drawFacesOnImages string
 )
 
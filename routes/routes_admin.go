@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/views"
+)
+
+const (
+	// adminUsername the username for the admin dashboard
+	adminUsername = "admin"
+	// adminAllDevices device ID used by the dashboard to push an event to every device
+	adminAllDevices = "all"
+	// adminCSRFField form field holding the CSRF token of the dashboard forms
+	adminCSRFField = "_csrf"
+	// adminCSRFContextKey context key the CSRF middleware stores the token under
+	adminCSRFContextKey = "csrf"
+)
+
+// AdminAuth protects the admin dashboard with basic auth using the admin password.
+// Browsers resend basic auth credentials with any request, so the dashboard forms also
+// carry a CSRF token that other sites can not read.
+// The dashboard is not found when no admin password is set.
+func AdminAuth(baseConfig *config.Config) echo.MiddlewareFunc {
+	basicAuth := middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "Immich Kiosk admin",
+		Validator: func(username, password string, c echo.Context) (bool, error) {
+			validUsername := subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) == 1
+			validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(baseConfig.Kiosk.AdminPassword)) == 1
+			return validUsername && validPassword, nil
+		},
+	})
+
+	csrf := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "form:" + adminCSRFField,
+		ContextKey:     adminCSRFContextKey,
+		CookieName:     "kiosk-admin-csrf",
+		CookiePath:     "/admin",
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAuth := basicAuth(csrf(next))
+		return func(c echo.Context) error {
+			if baseConfig.Kiosk.AdminPassword == "" {
+				return echo.ErrNotFound
+			}
+			return withAuth(c)
+		}
+	}
+}
+
+// adminSettings the config values shown for a device. Credentials are never shown.
+func adminSettings(c config.Config) []views.AdminSetting {
+	settings := []views.AdminSetting{
+		{Name: "profile", Value: c.Profile},
+		{Name: "account", Value: c.Account},
+		{Name: "person", Value: strings.Join(c.Person, ", ")},
+		{Name: "album", Value: strings.Join(c.Album, ", ")},
+		{Name: "tag", Value: strings.Join(c.Tag, ", ")},
+		{Name: "layout", Value: c.Layout},
+		{Name: "theme", Value: c.Theme},
+		{Name: "refresh", Value: fmt.Sprintf("%ds", c.Refresh)},
+		{Name: "transition", Value: c.Transition},
+		{Name: "image_fit", Value: c.ImageFit},
+		{Name: "sleep_start", Value: c.SleepStart},
+		{Name: "sleep_end", Value: c.SleepEnd},
+	}
+
+	return slices.DeleteFunc(settings, func(s views.AdminSetting) bool {
+		return s.Value == ""
+	})
+}
+
+// adminDevices the known devices as shown on the dashboard.
+func adminDevices(now time.Time) []views.AdminDevice {
+	devices := kioskDevices.list(now)
+	adminDevices := make([]views.AdminDevice, len(devices))
+
+	for i, device := range devices {
+		adminDevices[i] = views.AdminDevice{
+			ID:        device.ID,
+			Version:   device.Version,
+			UserAgent: device.UserAgent,
+			Address:   device.Address,
+			FirstSeen: device.FirstSeen,
+			LastSeen:  device.LastSeen,
+			Online:    now.Sub(device.LastSeen) <= deviceOnlineWindow,
+			Listening: kioskEvents.listening(device.ID),
+			Sleeping:  kioskEvents.isSleeping(device.ID),
+			ImmichUrl: device.Config.ImmichUrl,
+			AssetIDs:  device.AssetIDs,
+			Settings:  adminSettings(device.Config),
+		}
+	}
+
+	return adminDevices
+}
+
+// adminEvents the events that can be pushed from the dashboard, in a stable order.
+func adminEvents() []string {
+	events := make([]string, 0, len(kioskEventNames))
+	for event := range kioskEventNames {
+		events = append(events, string(event))
+	}
+	slices.Sort(events)
+	return events
+}
+
+// adminCSRFToken the CSRF token set by AdminAuth for the dashboard forms.
+func adminCSRFToken(c echo.Context) string {
+	token, _ := c.Get(adminCSRFContextKey).(string)
+	return token
+}
+
+// Admin admin dashboard listing known devices
+func Admin(c echo.Context) error {
+	return Render(c, http.StatusOK, views.Admin(views.AdminData{
+		KioskVersion: KioskVersion,
+		Devices:      adminDevices(time.Now()),
+		Events:       adminEvents(),
+		Message:      c.QueryParam("message"),
+		CSRFToken:    adminCSRFToken(c),
+	}))
+}
+
+// AdminSendEvent pushes an event to a device from the admin dashboard and returns to the dashboard.
+func AdminSendEvent(c echo.Context) error {
+
+	event := KioskEvent(c.Param("event"))
+	if _, known := kioskEventNames[event]; !known {
+		return c.String(http.StatusBadRequest, "unknown event")
+	}
+
+	deviceID := c.Param("deviceID")
+	target := deviceID
+	if deviceID == adminAllDevices {
+		deviceID = ""
+		target = "all devices"
+	}
+
+	delivered := PushEvent(deviceID, event)
+
+	log.Info("Admin pushed event", "event", event, "deviceID", deviceID, "delivered", delivered)
+
+	message := fmt.Sprintf("Sent %s to %s, delivered to %d device(s).", event, target, delivered)
+
+	return c.Redirect(http.StatusSeeOther, "/admin?message="+url.QueryEscape(message))
+}
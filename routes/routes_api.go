@@ -0,0 +1,345 @@
+package routes
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/immich"
+)
+
+const (
+	// apiAllDevices device ID used to act on every known device
+	apiAllDevices = "all"
+	// apiDefaultSourceDuration how long a source set with the api is used when no duration is given
+	apiDefaultSourceDuration = time.Hour
+)
+
+// validAssetID matches Immich asset IDs
+var validAssetID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// sourceOverride albums and people a device shows instead of its own until the override ends
+type sourceOverride struct {
+	Album  []string
+	Person []string
+	Until  time.Time
+}
+
+// remoteControl changes to what devices show, made with the api.
+type remoteControl struct {
+	mu sync.Mutex
+	// assets the asset each device should show next
+	assets map[string]string
+	// sources the albums and people each device should show for a while
+	sources map[string]sourceOverride
+}
+
+var kioskRemote = newRemoteControl()
+
+func newRemoteControl() *remoteControl {
+	return &remoteControl{
+		assets:  make(map[string]string),
+		sources: make(map[string]sourceOverride),
+	}
+}
+
+// showAsset makes assetID the next asset the device shows.
+func (r *remoteControl) showAsset(deviceID, assetID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assets[deviceID] = assetID
+}
+
+// takeAsset returns the asset the device should show next, if any, and forgets it.
+func (r *remoteControl) takeAsset(deviceID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	assetID := r.assets[deviceID]
+	delete(r.assets, deviceID)
+
+	return assetID
+}
+
+// setSource makes the device show the given source until it ends.
+func (r *remoteControl) setSource(deviceID string, source sourceOverride) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[deviceID] = source
+}
+
+// clearSource returns the device to its own albums and people.
+func (r *remoteControl) clearSource(deviceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sources, deviceID)
+}
+
+// source returns the source the device should show, if one is set and has not ended.
+func (r *remoteControl) source(deviceID string, now time.Time) (sourceOverride, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source, found := r.sources[deviceID]
+	if !found {
+		return sourceOverride{}, false
+	}
+
+	if now.After(source.Until) {
+		delete(r.sources, deviceID)
+		return sourceOverride{}, false
+	}
+
+	return source, true
+}
+
+// useSourceOverride swaps the sources of the request for the albums and people set with the api.
+// It reports whether an override is in use.
+func useSourceOverride(requestConfig *config.Config, kioskDeviceID string) bool {
+	source, found := kioskRemote.source(kioskDeviceID, time.Now())
+	if !found {
+		return false
+	}
+
+	requestConfig.ClearSources()
+	requestConfig.Album = slices.Clone(source.Album)
+	requestConfig.Person = slices.Clone(source.Person)
+
+	return true
+}
+
+// APIAuth protects the api with a bearer token. The api is not found when no token is set.
+func APIAuth(baseConfig *config.Config) echo.MiddlewareFunc {
+	keyAuth := middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:" + echo.HeaderAuthorization + ":Bearer ",
+		Validator: func(token string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(baseConfig.Kiosk.APIToken)) == 1, nil
+		},
+		ErrorHandler: func(err error, c echo.Context) error {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or missing api token"})
+		},
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAuth := keyAuth(next)
+		return func(c echo.Context) error {
+			if baseConfig.Kiosk.APIToken == "" {
+				return echo.ErrNotFound
+			}
+			return withAuth(c)
+		}
+	}
+}
+
+// apiDevice a device as returned by the api
+type apiDevice struct {
+	ID        string    `json:"id"`
+	Version   string    `json:"version"`
+	Address   string    `json:"address"`
+	LastSeen  time.Time `json:"last_seen"`
+	Online    bool      `json:"online"`
+	Listening bool      `json:"listening"`
+	Sleeping  bool      `json:"sleeping"`
+	Profile   string    `json:"profile"`
+	Account   string    `json:"account"`
+	Assets    []string  `json:"assets"`
+}
+
+// apiResult the outcome of an action
+type apiResult struct {
+	Action string `json:"action"`
+	// Devices the number of devices the action was applied to
+	Devices int `json:"devices"`
+	// Delivered the number of devices that were told about the action straight away
+	Delivered int `json:"delivered"`
+}
+
+// apiError writes an error response.
+func apiError(c echo.Context, status int, message string) error {
+	return c.JSON(status, map[string]string{"error": message})
+}
+
+// apiTargetDevices the IDs of the devices named in the url. "all" is every known device.
+func apiTargetDevices(c echo.Context) ([]string, bool) {
+	deviceID := c.Param("deviceID")
+	devices := kioskDevices.list(time.Now())
+
+	var ids []string
+	for _, device := range devices {
+		if deviceID == apiAllDevices || device.ID == deviceID {
+			ids = append(ids, device.ID)
+		}
+	}
+
+	return ids, deviceID == apiAllDevices || len(ids) > 0
+}
+
+// APIDevices lists the known devices.
+func APIDevices(c echo.Context) error {
+	now := time.Now()
+	devices := kioskDevices.list(now)
+
+	out := make([]apiDevice, len(devices))
+
+	for i, device := range devices {
+		assets := device.AssetIDs
+		if assets == nil {
+			assets = []string{}
+		}
+
+		out[i] = apiDevice{
+			ID:        device.ID,
+			Version:   device.Version,
+			Address:   device.Address,
+			LastSeen:  device.LastSeen,
+			Online:    now.Sub(device.LastSeen) <= deviceOnlineWindow,
+			Listening: kioskEvents.listening(device.ID),
+			Sleeping:  kioskEvents.isSleeping(device.ID),
+			Profile:   device.Config.Profile,
+			Account:   device.Config.Account,
+			Assets:    assets,
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// APIEvent returns a handler that pushes event to the devices named in the url.
+func APIEvent(event KioskEvent) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		deviceIDs, found := apiTargetDevices(c)
+		if !found {
+			return apiError(c, http.StatusNotFound, "device not found")
+		}
+
+		delivered := 0
+		for _, deviceID := range deviceIDs {
+			delivered += PushEvent(deviceID, event)
+		}
+
+		log.Debug("api pushed event", "event", event, "deviceID", c.Param("deviceID"), "delivered", delivered)
+
+		return c.JSON(http.StatusOK, apiResult{Action: string(event), Devices: len(deviceIDs), Delivered: delivered})
+	}
+}
+
+// APIShowAsset shows an asset on the devices named in the url.
+// Devices with the asset in exclude_asset are skipped.
+func APIShowAsset(c echo.Context) error {
+	var request struct {
+		AssetID string `json:"asset_id"`
+	}
+
+	if err := c.Bind(&request); err != nil || !validAssetID.MatchString(request.AssetID) {
+		return apiError(c, http.StatusBadRequest, "asset_id is missing or invalid")
+	}
+
+	deviceIDs, found := apiTargetDevices(c)
+	if !found {
+		return apiError(c, http.StatusNotFound, "device not found")
+	}
+
+	deviceIDs = slices.DeleteFunc(deviceIDs, func(deviceID string) bool {
+		return kioskDevices.excludesAsset(deviceID, request.AssetID)
+	})
+
+	if len(deviceIDs) == 0 && c.Param("deviceID") != apiAllDevices {
+		return apiError(c, http.StatusForbidden, "asset is excluded on this device")
+	}
+
+	delivered := 0
+	for _, deviceID := range deviceIDs {
+		kioskRemote.showAsset(deviceID, request.AssetID)
+		delivered += PushEvent(deviceID, EventNextImage)
+	}
+
+	return c.JSON(http.StatusOK, apiResult{Action: "show", Devices: len(deviceIDs), Delivered: delivered})
+}
+
+// requestedAssetExcluded reports whether an asset requested with the api is excluded by the request,
+// either directly or through an excluded album or person. Assets are not shown when this can not be checked.
+func requestedAssetExcluded(ctx context.Context, requestConfig config.Config, assetID, requestID string) bool {
+	immichAsset := immich.NewImage(requestConfig)
+
+	excluded, err := immichAsset.IsExcluded(ctx, assetID, requestID)
+	if err != nil {
+		log.Error(requestID, "checking exclusions of requested asset", "asset", assetID, "err", err)
+		return true
+	}
+
+	if excluded {
+		log.Info(requestID, "requested asset is excluded", "asset", assetID)
+	}
+
+	return excluded
+}
+
+// APISetSource makes the devices named in the url show the given albums and people for a while.
+func APISetSource(c echo.Context) error {
+	var request struct {
+		Album    []string `json:"album"`
+		Person   []string `json:"person"`
+		Duration string   `json:"duration"`
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return apiError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if len(request.Album) == 0 && len(request.Person) == 0 {
+		return apiError(c, http.StatusBadRequest, "album or person is required")
+	}
+
+	duration := apiDefaultSourceDuration
+	if request.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			return apiError(c, http.StatusBadRequest, "duration is invalid, e.g. 30m or 2h")
+		}
+	}
+
+	deviceIDs, found := apiTargetDevices(c)
+	if !found {
+		return apiError(c, http.StatusNotFound, "device not found")
+	}
+
+	source := sourceOverride{
+		Album:  request.Album,
+		Person: request.Person,
+		Until:  time.Now().Add(duration),
+	}
+
+	delivered := 0
+	for _, deviceID := range deviceIDs {
+		kioskRemote.setSource(deviceID, source)
+		delivered += PushEvent(deviceID, EventNextImage)
+	}
+
+	return c.JSON(http.StatusOK, apiResult{Action: "source", Devices: len(deviceIDs), Delivered: delivered})
+}
+
+// APIClearSource returns the devices named in the url to their own albums and people.
+func APIClearSource(c echo.Context) error {
+	deviceIDs, found := apiTargetDevices(c)
+	if !found {
+		return apiError(c, http.StatusNotFound, "device not found")
+	}
+
+	delivered := 0
+	for _, deviceID := range deviceIDs {
+		kioskRemote.clearSource(deviceID)
+		delivered += PushEvent(deviceID, EventNextImage)
+	}
+
+	return c.JSON(http.StatusOK, apiResult{Action: "clear-source", Devices: len(deviceIDs), Delivered: delivered})
+}
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/damongolding/immich-kiosk/config"
+)
+
+const (
+	// assetURLMinLifetime the shortest time a signed asset url is valid for
+	assetURLMinLifetime = 10 * time.Minute
+
+	assetVariantPreview  = "preview"
+	assetVariantOriginal = "original"
+	assetBlurSuffix      = "-blur"
+)
+
+var (
+	// assetStore image bytes served by the asset route, keyed by account, asset ID and variant
+	assetStore      *cache.Cache
+	assetStoreMutex sync.Mutex
+
+	// assetURLSecret key used to sign asset urls. A new key is made on every start
+	// so urls handed out before a restart stop working.
+	assetURLSecret []byte
+)
+
+// storedAsset image bytes and the headers needed to serve them.
+type storedAsset struct {
+	Bytes       []byte
+	ContentType string
+	ETag        string
+}
+
+func init() {
+	assetStore = cache.New(assetURLMinLifetime, 10*time.Minute)
+
+	assetURLSecret = make([]byte, 32)
+	if _, err := rand.Read(assetURLSecret); err != nil {
+		log.Fatal("generating asset url secret", "err", err)
+	}
+}
+
+// assetStoreKey returns the key the given account, asset and variant are stored under.
+func assetStoreKey(account, assetID, variant string) string {
+	return account + "|" + assetID + "|" + variant
+}
+
+// assetURLLifetime returns how long asset urls handed to a device are valid for.
+// Urls must outlive the refresh interval as prefetched view data is shown a refresh later.
+func assetURLLifetime(requestConfig config.Config) time.Duration {
+	lifetime := time.Duration(requestConfig.Refresh) * time.Second * 2
+	return max(lifetime, assetURLMinLifetime)
+}
+
+// assetURLExpiry returns when a url made now with the given lifetime expires.
+// Expiry is rounded so every device gets the same url within the same window,
+// which lets browsers and proxies reuse cached responses.
+func assetURLExpiry(now time.Time, lifetime time.Duration) time.Time {
+	return now.Truncate(lifetime).Add(lifetime * 2)
+}
+
+// signAssetURL returns the signature for the given store key and expiry.
+func signAssetURL(key string, expires int64) string {
+	mac := hmac.New(sha256.New, assetURLSecret)
+	mac.Write([]byte(key + "|" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storeAsset keeps the image bytes for the asset route and returns a signed url for them.
+// Bytes already stored for the same account, asset and variant are kept as they are,
+// so every device is served the same bytes.
+func storeAsset(requestConfig config.Config, assetID, variant string, imgBytes []byte) string {
+	assetURL, _ := keepAsset(requestConfig, assetID, variant, imgBytes)
+	return assetURL
+}
+
+// storedAssetURL returns a signed url for bytes already stored for the account, asset and variant.
+// It reports false when nothing is stored, in which case the bytes must be stored with storeAsset.
+func storedAssetURL(requestConfig config.Config, assetID, variant string) (string, bool) {
+	return keepAsset(requestConfig, assetID, variant, nil)
+}
+
+// keepAsset stores the image bytes unless bytes are already stored, and makes sure
+// the stored bytes outlive the url it returns. With nil bytes nothing new is stored.
+func keepAsset(requestConfig config.Config, assetID, variant string, imgBytes []byte) (string, bool) {
+	key := assetStoreKey(requestConfig.Account, assetID, variant)
+	expires := assetURLExpiry(time.Now(), assetURLLifetime(requestConfig))
+
+	assetStoreMutex.Lock()
+	defer assetStoreMutex.Unlock()
+
+	asset, storedUntil, found := assetStore.GetWithExpiration(key)
+	if !found {
+		if imgBytes == nil {
+			return "", false
+		}
+
+		sum := sha256.Sum256(imgBytes)
+		asset = storedAsset{
+			Bytes:       imgBytes,
+			ContentType: http.DetectContentType(imgBytes),
+			ETag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		}
+	}
+
+	if !found || storedUntil.Before(expires) {
+		assetStore.Set(key, asset, time.Until(expires))
+	}
+
+	return signedAssetURL(requestConfig.Account, assetID, variant, expires), true
+}
+
+// signedAssetURL returns the url the asset route serves the given account, asset and variant from.
+func signedAssetURL(account, assetID, variant string, expires time.Time) string {
+	key := assetStoreKey(account, assetID, variant)
+
+	queries := url.Values{}
+	queries.Set("variant", variant)
+	if account != "" {
+		queries.Set("account", account)
+	}
+	queries.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	queries.Set("signature", signAssetURL(key, expires.Unix()))
+
+	return "/asset/" + url.PathEscape(assetID) + "?" + queries.Encode()
+}
+
+// etagMatches reports whether the If-None-Match header matches the given ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Asset serves stored image bytes from a signed url.
+func Asset(c echo.Context) error {
+
+	assetID := c.Param("id")
+	variant := c.QueryParam("variant")
+	account := c.QueryParam("account")
+	signature := c.QueryParam("signature")
+
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	key := assetStoreKey(account, assetID, variant)
+
+	if !hmac.Equal([]byte(signature), []byte(signAssetURL(key, expires))) {
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	remaining := time.Until(time.Unix(expires, 0))
+	if remaining <= 0 {
+		return c.NoContent(http.StatusGone)
+	}
+
+	data, found := assetStore.Get(key)
+	if !found {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	asset := data.(storedAsset)
+
+	c.Response().Header().Set("ETag", asset.ETag)
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", int(remaining.Seconds())))
+
+	if etagMatches(c.Request().Header.Get("If-None-Match"), asset.ETag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, asset.ContentType, asset.Bytes)
+}
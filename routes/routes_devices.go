@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/metrics"
+	"github.com/damongolding/immich-kiosk/utils"
+	"github.com/damongolding/immich-kiosk/views"
+)
+
+const (
+	// deviceCookie cookie holding the device ID so a device keeps its ID across page loads
+	deviceCookie = "kiosk-device-id"
+	// deviceOnlineWindow time since a device was last seen before it is shown as offline.
+	// Devices check for updates every 7 seconds so this covers a few missed checks
+	deviceOnlineWindow = time.Minute
+	// deviceForgetAfter time since a device was last seen before it is removed from the registry
+	deviceForgetAfter = 7 * 24 * time.Hour
+	// maxDevices the most devices kept in the registry. The least recently seen device is removed to make room
+	maxDevices = 1000
+)
+
+// validDeviceID matches device IDs that are safe to keep in a cookie and send in headers
+var validDeviceID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// kioskDevice what the server knows about a device
+type kioskDevice struct {
+	ID        string
+	Version   string
+	UserAgent string
+	Address   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// AssetIDs the assets the device is showing
+	AssetIDs []string
+	// Config the effective config of the last request from the device
+	Config config.Config
+}
+
+// deviceRegistry devices that have requested Kiosk recently.
+type deviceRegistry struct {
+	mu      sync.Mutex
+	devices map[string]*kioskDevice
+	// onForget is called, with mu held, for each device removed from the registry
+	onForget func(deviceID string)
+}
+
+var kioskDevices = newDeviceRegistry()
+
+func init() {
+	metrics.RegisterActiveDevices(func() int {
+		return kioskDevices.online(time.Now())
+	})
+}
+
+func newDeviceRegistry() *deviceRegistry {
+	return &deviceRegistry{
+		devices: make(map[string]*kioskDevice),
+	}
+}
+
+// device returns the record for deviceID, creating it when needed.
+// Room is made for new devices by removing devices that have not been seen for a long time. r.mu must be held.
+func (r *deviceRegistry) device(deviceID string, now time.Time) *kioskDevice {
+	device, found := r.devices[deviceID]
+	if !found {
+		r.forget(now)
+		device = &kioskDevice{ID: deviceID, FirstSeen: now}
+		r.devices[deviceID] = device
+	}
+	return device
+}
+
+// forget removes devices not seen for deviceForgetAfter and, while the registry is full,
+// the least recently seen device. r.mu must be held.
+func (r *deviceRegistry) forget(now time.Time) {
+	var oldest *kioskDevice
+
+	for id, device := range r.devices {
+		if now.Sub(device.LastSeen) > deviceForgetAfter {
+			r.remove(id)
+			continue
+		}
+		if oldest == nil || device.LastSeen.Before(oldest.LastSeen) {
+			oldest = device
+		}
+	}
+
+	if len(r.devices) >= maxDevices && oldest != nil {
+		r.remove(oldest.ID)
+	}
+}
+
+// remove deletes the device from the registry. r.mu must be held.
+func (r *deviceRegistry) remove(deviceID string) {
+	delete(r.devices, deviceID)
+	if r.onForget != nil {
+		r.onForget(deviceID)
+	}
+}
+
+// known reports whether the device is in the registry.
+func (r *deviceRegistry) known(deviceID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, found := r.devices[deviceID]
+	return found
+}
+
+// seen records a request from the device. A nil requestConfig keeps the config already recorded,
+// for requests that are not made with the device's config.
+func (r *deviceRegistry) seen(deviceID, version, userAgent, address string, requestConfig *config.Config, now time.Time) {
+	if !validDeviceID.MatchString(deviceID) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device := r.device(deviceID, now)
+	device.LastSeen = now
+	device.UserAgent = userAgent
+	device.Address = address
+	if requestConfig != nil {
+		device.Config = *requestConfig
+	}
+	if version != "" {
+		device.Version = version
+	}
+}
+
+// showing records the assets the device has been sent.
+func (r *deviceRegistry) showing(deviceID string, assetIDs []string, now time.Time) {
+	if !validDeviceID.MatchString(deviceID) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device := r.device(deviceID, now)
+	device.LastSeen = now
+	device.AssetIDs = assetIDs
+}
+
+// excludesAsset reports whether assetID is in exclude_asset of the last config recorded for the device.
+func (r *deviceRegistry) excludesAsset(deviceID, assetID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, found := r.devices[deviceID]
+	return found && slices.Contains(device.Config.ExcludeAsset, assetID)
+}
+
+// list returns a copy of every device, most recently seen first.
+// Devices not seen for deviceForgetAfter are removed.
+func (r *deviceRegistry) list(now time.Time) []kioskDevice {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	devices := make([]kioskDevice, 0, len(r.devices))
+
+	for id, device := range r.devices {
+		if now.Sub(device.LastSeen) > deviceForgetAfter {
+			r.remove(id)
+			continue
+		}
+		devices = append(devices, *device)
+	}
+
+	slices.SortFunc(devices, func(a, b kioskDevice) int {
+		if c := b.LastSeen.Compare(a.LastSeen); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return devices
+}
+
+// online returns the number of devices seen within deviceOnlineWindow.
+func (r *deviceRegistry) online(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, device := range r.devices {
+		if now.Sub(device.LastSeen) <= deviceOnlineWindow {
+			count++
+		}
+	}
+
+	return count
+}
+
+// recordDevice records a request from the device set in the kiosk-device-id header.
+func recordDevice(c echo.Context, requestConfig *config.Config) {
+	kioskDevices.seen(
+		c.Request().Header.Get("kiosk-device-id"),
+		c.Request().Header.Get("kiosk-version"),
+		c.Request().UserAgent(),
+		c.RealIP(),
+		requestConfig,
+		time.Now(),
+	)
+}
+
+// deviceID returns the ID kept in the device cookie, or a new ID which is stored in the cookie.
+func deviceID(c echo.Context) string {
+	if cookie, err := c.Cookie(deviceCookie); err == nil && validDeviceID.MatchString(cookie.Value) {
+		return cookie.Value
+	}
+
+	id := utils.GenerateUUID()
+
+	c.SetCookie(&http.Cookie{
+		Name:     deviceCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int((10 * 365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+// renderImage records the assets being sent to the device and renders them.
+func renderImage(c echo.Context, viewData views.ViewData) error {
+	assetIDs := make([]string, 0, len(viewData.Images))
+	for _, image := range viewData.Images {
+		assetIDs = append(assetIDs, image.ImmichImage.ID)
+	}
+
+	kioskDevices.showing(viewData.DeviceID, assetIDs, time.Now())
+
+	return Render(c, http.StatusOK, views.Image(viewData))
+}
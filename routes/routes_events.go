@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+)
+
+// KioskEvent an event pushed to kiosk devices
+type KioskEvent string
+
+const (
+	EventNextImage     KioskEvent = "next-image"
+	EventPreviousImage KioskEvent = "previous-image"
+	EventReload        KioskEvent = "reload"
+	EventPause         KioskEvent = "pause"
+	EventResume        KioskEvent = "resume"
+	EventSleep         KioskEvent = "sleep"
+	EventWake          KioskEvent = "wake"
+	EventFlushCache    KioskEvent = "flush-cache"
+
+	// eventsKeepAliveInterval time between comments sent to keep idle connections open
+	eventsKeepAliveInterval = 25 * time.Second
+	// eventsBufferSize the number of events held for a device that is not reading
+	eventsBufferSize = 8
+)
+
+// kioskEventNames events that can be pushed to devices
+var kioskEventNames = map[KioskEvent]struct{}{
+	EventNextImage:     {},
+	EventPreviousImage: {},
+	EventReload:        {},
+	EventPause:         {},
+	EventResume:        {},
+	EventSleep:         {},
+	EventWake:          {},
+	EventFlushCache:    {},
+}
+
+// eventBroker delivers events to the devices subscribed to the event stream.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan KioskEvent]struct{}
+	// sleeping devices put to sleep with EventSleep
+	sleeping map[string]bool
+	// paused devices paused with EventPause
+	paused map[string]bool
+	// known reports whether a device is in the device registry. The sleeping and paused state is
+	// only kept for known or subscribed devices, so made up device IDs are not remembered
+	known func(deviceID string) bool
+	// done is closed when the server shuts down so open streams end
+	done chan struct{}
+}
+
+var kioskEvents = newEventBroker(kioskDevices.known)
+
+func init() {
+	kioskDevices.onForget = kioskEvents.forget
+}
+
+func newEventBroker(known func(deviceID string) bool) *eventBroker {
+	return &eventBroker{
+		subscribers: make(map[string]map[chan KioskEvent]struct{}),
+		sleeping:    make(map[string]bool),
+		paused:      make(map[string]bool),
+		known:       known,
+		done:        make(chan struct{}),
+	}
+}
+
+// subscribe returns a channel of the events pushed to the device and a func to stop receiving them.
+func (b *eventBroker) subscribe(deviceID string) (chan KioskEvent, func()) {
+	events := make(chan KioskEvent, eventsBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[deviceID] == nil {
+		b.subscribers[deviceID] = make(map[chan KioskEvent]struct{})
+	}
+	b.subscribers[deviceID][events] = struct{}{}
+
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[deviceID], events)
+		if len(b.subscribers[deviceID]) == 0 {
+			delete(b.subscribers, deviceID)
+		}
+	}
+}
+
+// publish pushes the event to the device, or to every device when deviceID is empty.
+// It returns the number of devices the event was delivered to.
+func (b *eventBroker) publish(deviceID string, event KioskEvent) int {
+	// checked before locking, as the registry calls forget while holding its own lock
+	known := deviceID != "" && b.known != nil && b.known(deviceID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deviceIDs := []string{deviceID}
+	if deviceID == "" {
+		deviceIDs = make([]string, 0, len(b.subscribers))
+		for id := range b.subscribers {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+
+	delivered := 0
+
+	for _, id := range deviceIDs {
+		if !known && len(b.subscribers[id]) == 0 {
+			continue
+		}
+
+		switch event {
+		case EventSleep:
+			b.sleeping[id] = true
+		case EventWake:
+			delete(b.sleeping, id)
+		case EventPause:
+			b.paused[id] = true
+		case EventResume:
+			delete(b.paused, id)
+		}
+
+		if len(b.subscribers[id]) == 0 {
+			continue
+		}
+
+		for events := range b.subscribers[id] {
+			select {
+			case events <- event:
+			default:
+				log.Warn("Dropped event for slow device", "deviceID", id, "event", event)
+			}
+		}
+
+		delivered++
+	}
+
+	return delivered
+}
+
+// forget removes the sleeping and paused state of the device.
+func (b *eventBroker) forget(deviceID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.sleeping, deviceID)
+	delete(b.paused, deviceID)
+}
+
+// isSleeping reports whether the device has been put to sleep with EventSleep.
+func (b *eventBroker) isSleeping(deviceID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sleeping[deviceID]
+}
+
+// isPaused reports whether the device has been paused with EventPause.
+// Pausing on the device itself is not known to the server.
+func (b *eventBroker) isPaused(deviceID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paused[deviceID]
+}
+
+// listening reports whether the device is connected to the event stream.
+func (b *eventBroker) listening(deviceID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[deviceID]) > 0
+}
+
+// close ends all open event streams.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
+
+// PushEvent pushes the event to the device, or to every device when deviceID is empty.
+// It returns the number of devices the event was delivered to.
+func PushEvent(deviceID string, event KioskEvent) int {
+	return kioskEvents.publish(deviceID, event)
+}
+
+// CloseEventStreams ends all open event streams, so the server can shut down.
+func CloseEventStreams() {
+	kioskEvents.close()
+}
+
+// Events streams events pushed to a device as server-sent events.
+func Events(c echo.Context) error {
+
+	deviceID := c.QueryParam("device")
+	if deviceID == "" {
+		return c.String(http.StatusBadRequest, "missing device")
+	}
+
+	events, unsubscribe := kioskEvents.subscribe(deviceID)
+	defer unsubscribe()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-kioskEvents.done:
+			return nil
+		case event := <-events:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", event); err != nil {
+				return nil
+			}
+			w.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
+
+// SendEvent pushes the event named in the url to the device set in the device param, or to every device.
+func SendEvent(c echo.Context) error {
+
+	event := KioskEvent(c.Param("event"))
+	if _, known := kioskEventNames[event]; !known {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown event"})
+	}
+
+	deviceID := c.QueryParam("device")
+	if deviceID == "" {
+		deviceID = c.FormValue("device")
+	}
+
+	delivered := PushEvent(deviceID, event)
+
+	log.Debug("Pushed event", "event", event, "deviceID", deviceID, "delivered", delivered)
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"event":     event,
+		"delivered": delivered,
+	})
+}
@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/damongolding/immich-kiosk/weather"
+)
+
+const (
+	// healthCheckTimeout time before the checks of an Immich server are considered failed
+	healthCheckTimeout = 5 * time.Second
+	// readinessCacheFor time a readiness report is reused, so frequent probes do not call Immich each time
+	readinessCacheFor = 5 * time.Second
+
+	healthStatusOK = "ok"
+	// healthStatusDegraded Kiosk can show assets but some optional data is missing, e.g. stale weather
+	healthStatusDegraded = "degraded"
+	// healthStatusUnavailable Kiosk can not show assets
+	healthStatusUnavailable = "unavailable"
+)
+
+// immichHealth the outcome of checking an Immich server
+type immichHealth struct {
+	// Account the name of the account, empty for the default account
+	Account   string `json:"account"`
+	Reachable bool   `json:"reachable"`
+	APIKey    bool   `json:"api_key_valid"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// weatherHealth a weather location with stale data
+type weatherHealth struct {
+	Name string `json:"name"`
+	// Updated the last successful refresh, nil when the weather has never been refreshed
+	Updated *time.Time `json:"last_updated"`
+}
+
+// readiness the readiness report
+type readiness struct {
+	Status       string          `json:"status"`
+	Immich       []immichHealth  `json:"immich"`
+	StaleWeather []weatherHealth `json:"stale_weather"`
+}
+
+// readinessSummary the readiness report shown to callers that have not authenticated.
+// It leaves out account names, versions and errors.
+type readinessSummary struct {
+	Status string `json:"status"`
+	// Immich the number of Immich servers checked
+	Immich int `json:"immich"`
+	// ImmichReady the number of Immich servers that can be reached and accept their API key
+	ImmichReady  int `json:"immich_ready"`
+	StaleWeather int `json:"stale_weather"`
+}
+
+// summary returns the report without details.
+func (r readiness) summary() readinessSummary {
+	summary := readinessSummary{
+		Status:       r.Status,
+		Immich:       len(r.Immich),
+		StaleWeather: len(r.StaleWeather),
+	}
+
+	for _, health := range r.Immich {
+		if health.APIKey {
+			summary.ImmichReady++
+		}
+	}
+
+	return summary
+}
+
+// readinessAuthenticated reports whether the request carries the API token or the kiosk password,
+// so can be shown the full readiness report.
+func readinessAuthenticated(c echo.Context, baseConfig *config.Config) bool {
+	if token := baseConfig.Kiosk.APIToken; token != "" {
+		if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get(echo.HeaderAuthorization)), []byte("Bearer "+token)) == 1 {
+			return true
+		}
+	}
+
+	if password := baseConfig.Kiosk.Password; password != "" {
+		if subtle.ConstantTimeCompare([]byte(c.QueryParam("password")), []byte(password)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkImmich pings the Immich server of requestConfig, then checks its API key is accepted.
+func checkImmich(requestConfig config.Config, account string) immichHealth {
+	health := immichHealth{Account: account}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	immichServer := immich.NewImage(requestConfig)
+
+	if err := immichServer.Ping(ctx); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+
+	about, err := immichServer.About(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.APIKey = true
+	health.Version = about.Version
+
+	return health
+}
+
+// checkReadiness checks the Immich server of the default account and of each named account,
+// and looks for weather locations with stale data.
+func checkReadiness(baseConfig *config.Config, now time.Time) readiness {
+	report := readiness{
+		Status:       healthStatusOK,
+		Immich:       []immichHealth{checkImmich(*baseConfig, "")},
+		StaleWeather: []weatherHealth{},
+	}
+
+	accounts := make([]string, 0, len(baseConfig.Accounts))
+	for name := range baseConfig.Accounts {
+		accounts = append(accounts, name)
+	}
+	slices.Sort(accounts)
+
+	for _, name := range accounts {
+		accountConfig := *baseConfig
+		accountConfig.Account = name
+		accountConfig.ImmichUrl = baseConfig.Accounts[name].ImmichUrl
+		accountConfig.ImmichApiKey = baseConfig.Accounts[name].ImmichApiKey
+
+		report.Immich = append(report.Immich, checkImmich(accountConfig, name))
+	}
+
+	for _, location := range weather.StaleLocations(now) {
+		health := weatherHealth{Name: location.Name}
+		if !location.Updated.IsZero() {
+			updated := location.Updated
+			health.Updated = &updated
+		}
+		report.StaleWeather = append(report.StaleWeather, health)
+	}
+
+	if len(report.StaleWeather) > 0 {
+		report.Status = healthStatusDegraded
+	}
+
+	for _, health := range report.Immich {
+		if !health.APIKey {
+			report.Status = healthStatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// Healthz reports that Kiosk is running.
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": healthStatusOK})
+}
+
+// Readyz reports whether Kiosk is ready to show assets. It responds with 503 when an Immich
+// server can not be reached or rejects its API key. Stale weather is reported but Kiosk stays ready.
+// Reports are reused for readinessCacheFor, and only callers with the API token or kiosk password
+// are shown the details of each check.
+func Readyz(baseConfig *config.Config) echo.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		report  readiness
+		checked time.Time
+	)
+
+	return func(c echo.Context) error {
+		now := time.Now()
+
+		// held while checking so concurrent probes wait for one report rather than each calling Immich
+		mu.Lock()
+		if checked.IsZero() || now.Sub(checked) > readinessCacheFor {
+			report = checkReadiness(baseConfig, now)
+			checked = now
+		}
+		current := report
+		mu.Unlock()
+
+		status := http.StatusOK
+		if current.Status == healthStatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+
+		if !readinessAuthenticated(c, baseConfig) {
+			return c.JSON(status, current.summary())
+		}
+
+		return c.JSON(status, current)
+	}
+}
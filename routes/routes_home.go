@@ -3,6 +3,7 @@ package routes
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/labstack/echo/v4"
@@ -33,6 +34,10 @@ func Home(baseConfig *config.Config) echo.HandlerFunc {
 			"requestConfig", requestConfig.String(),
 		)
 
+		kioskDeviceID := deviceID(c)
+
+		kioskDevices.seen(kioskDeviceID, KioskVersion, c.Request().UserAgent(), c.RealIP(), &requestConfig, time.Now())
+
 		var customCss []byte
 
 		if utils.FileExists("./custom.css") {
@@ -44,7 +49,7 @@ func Home(baseConfig *config.Config) echo.HandlerFunc {
 
 		viewData := views.ViewData{
 			KioskVersion: KioskVersion,
-			DeviceID:     utils.GenerateUUID(),
+			DeviceID:     kioskDeviceID,
 			Queries:      c.QueryParams(),
 			CustomCss:    customCss,
 			Config:       requestConfig,
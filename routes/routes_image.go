@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/charmbracelet/log"
@@ -32,6 +33,10 @@ func NewImage(baseConfig *config.Config) echo.HandlerFunc {
 
 		err := requestConfig.ConfigWithOverrides(c)
 		if err != nil {
+			// never fall back to another account's or profile's assets
+			if errors.Is(err, config.ErrAccountNotFound) || errors.Is(err, config.ErrProfileNotFound) {
+				return RenderError(c, err, "selecting account or profile")
+			}
 			log.Error("overriding config", "err", err)
 		}
 
@@ -43,29 +48,61 @@ func NewImage(baseConfig *config.Config) echo.HandlerFunc {
 			"requestConfig", requestConfig.String(),
 		)
 
-		if isSleepMode(requestConfig) {
+		recordDevice(c, &requestConfig)
+
+		if isSleepMode(requestConfig) || kioskEvents.isSleeping(kioskDeviceID) {
 			return c.NoContent(http.StatusNoContent)
 		}
 
+		// assets requested with the api are shown before anything else, unless they are excluded
+		if assetID := kioskRemote.takeAsset(kioskDeviceID); assetID != "" && !requestedAssetExcluded(c.Request().Context(), requestConfig, assetID, requestID) {
+			images, err := assetsImageData(c.Request().Context(), requestConfig, requestID, kioskDeviceID, []string{assetID})
+			if err != nil {
+				return RenderError(c, err, "retrieving requested image")
+			}
+			return renderImage(c, views.ViewData{DeviceID: kioskDeviceID, Images: images, Config: requestConfig})
+		}
+
+		// prefetched data was made with the device's own albums and people, so is not used while they are swapped
+		sourceOverridden := useSourceOverride(&requestConfig, kioskDeviceID)
+
+		immichOffline := isImmichOffline(requestConfig)
+
 		// get and use prefetch data (if found)
-		if requestConfig.Kiosk.PreFetch {
-			if viewData := fromCache(c, kioskDeviceID); viewData != nil {
-				go imagePreFetch(requestConfig, c, kioskDeviceID)
+		if requestConfig.Kiosk.PreFetch && !sourceOverridden {
+			if viewData := fromCache(c, requestConfig.Account, requestConfig.ActiveSchedule, kioskDeviceID); viewData != nil {
+				if immichOffline {
+					c.Response().Header().Set(offlineHeader, "true")
+				} else {
+					go imagePreFetch(requestConfig, c, kioskDeviceID)
+				}
 				return renderCachedViewData(c, viewData, &requestConfig, requestID, kioskDeviceID)
 			}
 			log.Debug(requestID, "deviceID", kioskDeviceID, "cache miss for new image")
 		}
 
+		// keep the slideshow going with recent assets until Immich is back
+		if immichOffline {
+			if rendered, err := renderOffline(c, requestConfig, requestID, kioskDeviceID); rendered {
+				return err
+			}
+		}
+
 		ViewData, err := generateViewData(requestConfig, c, kioskDeviceID, false)
 		if err != nil {
+			if checkImmichOffline(requestConfig) {
+				if rendered, err := renderOffline(c, requestConfig, requestID, kioskDeviceID); rendered {
+					return err
+				}
+			}
 			return RenderError(c, err, "retrieving image")
 		}
 
-		if requestConfig.Kiosk.PreFetch {
+		if requestConfig.Kiosk.PreFetch && !sourceOverridden {
 			go imagePreFetch(requestConfig, c, kioskDeviceID)
 		}
 
-		return Render(c, http.StatusOK, views.Image(ViewData))
+		return renderImage(c, ViewData)
 	}
 }
 
@@ -81,6 +118,10 @@ func NewRawImage(baseConfig *config.Config) echo.HandlerFunc {
 
 		err := requestConfig.ConfigWithOverrides(c)
 		if err != nil {
+			// never fall back to another account's or profile's assets
+			if errors.Is(err, config.ErrAccountNotFound) || errors.Is(err, config.ErrProfileNotFound) {
+				return RenderError(c, err, "selecting account or profile")
+			}
 			log.Error("overriding config", "err", err)
 		}
 
@@ -93,7 +134,7 @@ func NewRawImage(baseConfig *config.Config) echo.HandlerFunc {
 
 		immichImage := immich.NewImage(requestConfig)
 
-		imgBytes, err := processImage(&immichImage, requestConfig, requestID, "", false)
+		imgBytes, err := processImage(c.Request().Context(), &immichImage, requestConfig, requestID, "", false)
 		if err != nil {
 			return err
 		}
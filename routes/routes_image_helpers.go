@@ -2,14 +2,16 @@ package routes
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/diskcache"
 	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/damongolding/immich-kiosk/metrics"
 	"github.com/damongolding/immich-kiosk/utils"
 	"github.com/damongolding/immich-kiosk/views"
 	"github.com/disintegration/imaging"
@@ -18,13 +20,63 @@ import (
 	"github.com/patrickmn/go-cache"
 )
 
-// gatherPeopleAndAlbums collects asset weightings for people and albums.
+// searchFilters returns the date range and location filters set in the config.
+func searchFilters(requestConfig config.Config) []immich.SearchFilter {
+	filters := []immich.SearchFilter{}
+
+	for _, source := range []struct {
+		filterType string
+		values     []string
+	}{
+		{immich.FilterDateRange, requestConfig.DateRange},
+		{immich.FilterCity, requestConfig.City},
+		{immich.FilterState, requestConfig.State},
+		{immich.FilterCountry, requestConfig.Country},
+		{immich.FilterCameraMake, requestConfig.CameraMake},
+		{immich.FilterCameraModel, requestConfig.CameraModel},
+	} {
+		for _, value := range source.values {
+			filters = append(filters, immich.SearchFilter{Type: source.filterType, Value: value})
+		}
+	}
+
+	return filters
+}
+
+// gatherPeopleAndAlbums collects asset weightings for people, albums, tags, smart searches and date range or location filters.
 // It returns a slice of AssetWithWeighting and an error if any occurs during the process.
-func gatherPeopleAndAlbums(immichImage *immich.ImmichAsset, requestConfig config.Config, requestID string) ([]utils.AssetWithWeighting, error) {
+// Albums and people of matching selection rules are added and boosted. When the request shows the whole
+// library, the library is kept as a source alongside them so rules do not narrow it down to just their sources.
+func gatherPeopleAndAlbums(ctx context.Context, immichImage *immich.ImmichAsset, requestConfig config.Config, requestID string) ([]utils.AssetWithWeighting, error) {
 	peopleAndAlbums := []utils.AssetWithWeighting{}
 
+	hasSources := len(requestConfig.Person) > 0 || len(requestConfig.Album) > 0 || len(requestConfig.Tag) > 0 ||
+		len(requestConfig.Search) > 0 || len(searchFilters(requestConfig)) > 0
+
+	boosts := selectionBoosts(requestConfig.SelectionRules, currentRuleConditions())
+
+	if len(boosts) > 0 {
+		log.Debug(requestID, "selection rules matched", "boosts", len(boosts))
+
+		if !hasSources {
+			libraryAssetCount, err := immichImage.LibraryImageCount(ctx, requestID)
+			if err != nil {
+				return nil, fmt.Errorf("getting library asset count: %w", err)
+			}
+
+			if libraryAssetCount > 0 {
+				peopleAndAlbums = append(peopleAndAlbums, utils.AssetWithWeighting{
+					Asset:  utils.WeightedAsset{Type: libraryAssetType},
+					Weight: libraryAssetCount,
+				})
+			}
+		}
+
+		addBoostedSources(&requestConfig, boosts)
+	}
+
 	for _, person := range requestConfig.Person {
-		personAssetCount, err := immichImage.PersonImageCount(person, requestID)
+		personAssetCount, err := immichImage.PersonImageCount(ctx, person, requestID)
 		if err != nil {
 			return nil, fmt.Errorf("getting person image count: %w", err)
 		}
@@ -41,7 +93,7 @@ func gatherPeopleAndAlbums(immichImage *immich.ImmichAsset, requestConfig config
 	}
 
 	for _, album := range requestConfig.Album {
-		albumAssetCount, err := immichImage.AlbumImageCount(album, requestID)
+		albumAssetCount, err := immichImage.AlbumImageCount(ctx, album, requestID)
 		if err != nil {
 			return nil, fmt.Errorf("getting album asset count: %w", err)
 		}
@@ -57,24 +109,71 @@ func gatherPeopleAndAlbums(immichImage *immich.ImmichAsset, requestConfig config
 		})
 	}
 
-	return peopleAndAlbums, nil
-}
+	for _, tag := range requestConfig.Tag {
+		tagAssetCount, err := immichImage.TagImageCount(ctx, tag, requestID)
+		if err != nil {
+			return nil, fmt.Errorf("getting tag asset count: %w", err)
+		}
 
-func isSleepMode(requestConfig config.Config) bool {
-	if requestConfig.SleepStart == "" || requestConfig.SleepEnd == "" {
-		return false
+		if tagAssetCount == 0 {
+			log.Error("No assets found for", "tag", tag)
+			continue
+		}
+
+		peopleAndAlbums = append(peopleAndAlbums, utils.AssetWithWeighting{
+			Asset:  utils.WeightedAsset{Type: "TAG", ID: tag},
+			Weight: tagAssetCount,
+		})
 	}
 
-	if isSleepTime, _ := utils.IsSleepTime(requestConfig.SleepStart, requestConfig.SleepEnd, time.Now()); isSleepTime {
-		return isSleepTime
+	for _, search := range requestConfig.Search {
+		searchAssetCount, err := immichImage.SearchImageCount(ctx, search, requestID)
+		if err != nil {
+			return nil, fmt.Errorf("getting search asset count: %w", err)
+		}
+
+		if searchAssetCount == 0 {
+			log.Error("No assets found for", "search", search)
+			continue
+		}
+
+		peopleAndAlbums = append(peopleAndAlbums, utils.AssetWithWeighting{
+			Asset:  utils.WeightedAsset{Type: "SEARCH", ID: search},
+			Weight: searchAssetCount,
+		})
+	}
+
+	for _, filter := range searchFilters(requestConfig) {
+		filterAssetCount, err := immichImage.SearchFilterImageCount(ctx, filter, requestID)
+		if err != nil {
+			return nil, fmt.Errorf("getting %s asset count: %w", strings.ToLower(filter.Type), err)
+		}
+
+		if filterAssetCount == 0 {
+			log.Error("No assets found for", strings.ToLower(filter.Type), filter.Value)
+			continue
+		}
+
+		peopleAndAlbums = append(peopleAndAlbums, utils.AssetWithWeighting{
+			Asset:  utils.WeightedAsset{Type: filter.Type, ID: filter.Value},
+			Weight: filterAssetCount,
+		})
 	}
 
-	return false
+	applyBoosts(peopleAndAlbums, boosts)
+
+	return peopleAndAlbums, nil
+}
+
+// isSleepMode reports whether the sleep windows of requestConfig are open now.
+func isSleepMode(requestConfig config.Config) bool {
+	asleep, _ := requestConfig.SleepState(time.Now())
+	return asleep
 }
 
 // retrieveImage fetches a random image based on the picked image type.
 // It returns an error if the image retrieval fails.
-func retrieveImage(immichImage *immich.ImmichAsset, pickedAsset utils.WeightedAsset, requestID, kioskDeviceID string, isPrefetch bool) error {
+func retrieveImage(ctx context.Context, immichImage *immich.ImmichAsset, pickedAsset utils.WeightedAsset, requestID, kioskDeviceID string, isPrefetch bool) error {
 
 	viewDataCacheMutex.Lock()
 	defer viewDataCacheMutex.Unlock()
@@ -83,37 +182,84 @@ func retrieveImage(immichImage *immich.ImmichAsset, pickedAsset utils.WeightedAs
 	case "ALBUM":
 		switch pickedAsset.ID {
 		case immich.AlbumKeywordAll:
-			pickedAlbumID, err := immichImage.RandomAlbumFromAllAlbums(requestID)
+			pickedAlbumID, err := immichImage.RandomAlbumFromAllAlbums(ctx, requestID)
 			if err != nil {
 				return err
 			}
 			pickedAsset.ID = pickedAlbumID
 		case immich.AlbumKeywordShared:
-			pickedAlbumID, err := immichImage.RandomAlbumFromSharedAlbums(requestID)
+			pickedAlbumID, err := immichImage.RandomAlbumFromSharedAlbums(ctx, requestID)
 			if err != nil {
 				return err
 			}
 			pickedAsset.ID = pickedAlbumID
 		case immich.AlbumKeywordFavourites, immich.AlbumKeywordFavorites:
-			return immichImage.RandomImageFromFavourites(requestID, kioskDeviceID, isPrefetch)
+			return immichImage.RandomImageFromFavourites(ctx, requestID, kioskDeviceID, isPrefetch)
+		case immich.AlbumKeywordMemories:
+			return immichImage.RandomImageFromMemories(ctx, requestID, kioskDeviceID, isPrefetch)
 		}
-		return immichImage.RandomImageFromAlbum(pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
+		return immichImage.RandomImageFromAlbum(ctx, pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
 	case "PERSON":
-		return immichImage.RandomImageOfPerson(pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
+		return immichImage.RandomImageOfPerson(ctx, pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
+	case "TAG":
+		return immichImage.RandomImageWithTag(ctx, pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
+	case "SEARCH":
+		return immichImage.RandomImageFromSearch(ctx, pickedAsset.ID, requestID, kioskDeviceID, isPrefetch)
+	case immich.FilterDateRange, immich.FilterCity, immich.FilterState, immich.FilterCountry, immich.FilterCameraMake, immich.FilterCameraModel:
+		filter := immich.SearchFilter{Type: pickedAsset.Type, Value: pickedAsset.ID}
+		return immichImage.RandomImage(ctx, filter, requestID, kioskDeviceID, isPrefetch)
 	default:
-		return immichImage.RandomImage(requestID, kioskDeviceID, isPrefetch)
+		// libraryAssetType and requests without sources
+		return immichImage.RandomImage(ctx, immich.SearchFilter{}, requestID, kioskDeviceID, isPrefetch)
+	}
+}
+
+// imageVariant returns the variant of the image displayed with the given config.
+func imageVariant(config config.Config) string {
+	if config.UseOriginalImage {
+		return assetVariantOriginal
 	}
+	return assetVariantPreview
 }
 
-// fetchImagePreview retrieves the preview of an image and logs the time taken.
+// diskCacheKey returns the disk cache key for the given variant of the asset.
+// It reports false when the disk cache is disabled or the asset can not be cached.
+func diskCacheKey(immichImage *immich.ImmichAsset, variant string) (string, bool) {
+	if ImageDiskCache == nil {
+		return "", false
+	}
+	return diskcache.Key(immichImage.ID, variant, immichImage.Checksum)
+}
+
+// cacheOnDisk stores the bytes in the disk cache under the given key.
+func cacheOnDisk(key string, imgBytes []byte) {
+	if err := ImageDiskCache.Set(key, imgBytes); err != nil {
+		log.Error("saving to disk cache", "key", key, "err", err)
+	}
+}
+
+// fetchImagePreview retrieves the preview of an image, from the disk cache when possible, and logs the time taken.
 // It returns the image bytes and an error if any occurs.
-func fetchImagePreview(immichImage *immich.ImmichAsset, requestID, kioskDeviceID string, isPrefetch bool) ([]byte, error) {
+func fetchImagePreview(ctx context.Context, immichImage *immich.ImmichAsset, requestConfig config.Config, requestID, kioskDeviceID string, isPrefetch bool) ([]byte, error) {
 	imageGet := time.Now()
-	imgBytes, err := immichImage.ImagePreview()
+
+	key, cacheable := diskCacheKey(immichImage, imageVariant(requestConfig))
+	if cacheable {
+		if imgBytes, found := ImageDiskCache.Get(key); found {
+			log.Debug(requestID, "Disk cache hit", "asset", immichImage.ID)
+			return imgBytes, nil
+		}
+	}
+
+	imgBytes, err := immichImage.ImagePreview(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("getting image preview: %w", err)
 	}
 
+	if cacheable {
+		cacheOnDisk(key, imgBytes)
+	}
+
 	if isPrefetch {
 		log.Debug(requestID, "PREFETCH", kioskDeviceID, "Got image in", time.Since(imageGet).Seconds())
 	} else {
@@ -125,20 +271,20 @@ func fetchImagePreview(immichImage *immich.ImmichAsset, requestID, kioskDeviceID
 
 // processImage handles the entire process of selecting and retrieving an image.
 // It returns the image bytes and an error if any step fails.
-func processImage(immichImage *immich.ImmichAsset, requestConfig config.Config, requestID string, kioskDeviceID string, isPrefetch bool) ([]byte, error) {
+func processImage(ctx context.Context, immichImage *immich.ImmichAsset, requestConfig config.Config, requestID string, kioskDeviceID string, isPrefetch bool) ([]byte, error) {
 
-	peopleAndAlbums, err := gatherPeopleAndAlbums(immichImage, requestConfig, requestID)
+	peopleAndAlbums, err := gatherPeopleAndAlbums(ctx, immichImage, requestConfig, requestID)
 	if err != nil {
 		return nil, err
 	}
 
 	pickedImage := utils.PickRandomImageType(requestConfig.Kiosk.AssetWeighting, peopleAndAlbums)
 
-	if err := retrieveImage(immichImage, pickedImage, requestID, kioskDeviceID, isPrefetch); err != nil {
+	if err := retrieveImage(ctx, immichImage, pickedImage, requestID, kioskDeviceID, isPrefetch); err != nil {
 		return nil, err
 	}
 
-	return fetchImagePreview(immichImage, requestID, kioskDeviceID, isPrefetch)
+	return fetchImagePreview(ctx, immichImage, requestConfig, requestID, kioskDeviceID, isPrefetch)
 }
 
 // imageToBase64 converts image bytes to a base64 string and logs the processing time.
@@ -150,28 +296,97 @@ func imageToBase64(imgBytes []byte, config config.Config, requestID, kioskDevice
 		return "", fmt.Errorf("converting image to base64: %w", err)
 	}
 
+	metrics.ObserveImageProcessing(metrics.StageBase64, startTime)
+
 	logImageProcessing(config, requestID, kioskDeviceID, isPrefetch, action, startTime)
 	return img, nil
 }
 
-// processBlurredImage applies a blur effect to the image if required by the configuration.
-// It returns the blurred image as a base64 string and an error if any occurs.
-func processBlurredImage(imgBytes []byte, config config.Config, requestID, kioskDeviceID string, isPrefetch bool) (string, error) {
-	if !config.BackgroundBlur || strings.EqualFold(config.ImageFit, "cover") || (config.ImageEffect != "" && config.ImageEffect != "none") {
-		return "", nil
+// useBackgroundBlur reports whether the configuration displays a blurred background.
+func useBackgroundBlur(config config.Config) bool {
+	return config.BackgroundBlur && !strings.EqualFold(config.ImageFit, "cover") && (config.ImageEffect == "" || config.ImageEffect == "none")
+}
+
+// blurImage applies a blur effect to the image, or takes it from the disk cache, and logs the processing time.
+func blurImage(immichImage *immich.ImmichAsset, imgBytes []byte, config config.Config, requestID, kioskDeviceID string, isPrefetch bool) ([]byte, error) {
+	key, cacheable := diskCacheKey(immichImage, imageVariant(config)+assetBlurSuffix)
+	if cacheable {
+		if imgBlurBytes, found := ImageDiskCache.Get(key); found {
+			return imgBlurBytes, nil
+		}
 	}
 
 	startTime := time.Now()
 	imgBlurBytes, err := utils.BlurImage(imgBytes)
 	if err != nil {
-		return "", fmt.Errorf("blurring image: %w", err)
+		return nil, fmt.Errorf("blurring image: %w", err)
 	}
 
+	metrics.ObserveImageProcessing(metrics.StageBlur, startTime)
+
 	logImageProcessing(config, requestID, kioskDeviceID, isPrefetch, "Blurred", startTime)
 
+	if cacheable {
+		cacheOnDisk(key, imgBlurBytes)
+	}
+
+	return imgBlurBytes, nil
+}
+
+// processBlurredImage applies a blur effect to the image if required by the configuration.
+// It returns the blurred image as a base64 string and an error if any occurs.
+func processBlurredImage(immichImage *immich.ImmichAsset, imgBytes []byte, config config.Config, requestID, kioskDeviceID string, isPrefetch bool) (string, error) {
+	if !useBackgroundBlur(config) {
+		return "", nil
+	}
+
+	imgBlurBytes, err := blurImage(immichImage, imgBytes, config, requestID, kioskDeviceID, isPrefetch)
+	if err != nil {
+		return "", err
+	}
+
 	return imageToBase64(imgBlurBytes, config, requestID, kioskDeviceID, "Coverted blurred", isPrefetch)
 }
 
+// imageSources returns the sources of the image and its blurred background.
+// They are inlined as base64 data, or signed asset urls when asset urls are enabled.
+func imageSources(immichImage *immich.ImmichAsset, imgBytes []byte, config config.Config, requestID, kioskDeviceID string, isPrefetch bool) (string, string, error) {
+	if !config.Kiosk.AssetURLs {
+		img, err := imageToBase64(imgBytes, config, requestID, kioskDeviceID, "Converted", isPrefetch)
+		if err != nil {
+			return "", "", err
+		}
+
+		imgBlur, err := processBlurredImage(immichImage, imgBytes, config, requestID, kioskDeviceID, isPrefetch)
+		if err != nil {
+			return "", "", err
+		}
+
+		return img, imgBlur, nil
+	}
+
+	variant := imageVariant(config)
+
+	img := storeAsset(config, immichImage.ID, variant, imgBytes)
+
+	if !useBackgroundBlur(config) {
+		return img, "", nil
+	}
+
+	// the blurred background only needs making once for all devices
+	blurVariant := variant + assetBlurSuffix
+	if imgBlur, found := storedAssetURL(config, immichImage.ID, blurVariant); found {
+		return img, imgBlur, nil
+	}
+
+	imgBlurBytes, err := blurImage(immichImage, imgBytes, config, requestID, kioskDeviceID, isPrefetch)
+	if err != nil {
+		return "", "", err
+	}
+
+	return img, storeAsset(config, immichImage.ID, blurVariant, imgBlurBytes), nil
+}
+
 // logImageProcessing logs the time taken for image processing if debug verbose is enabled.
 func logImageProcessing(config config.Config, requestID, kioskDeviceID string, isPrefetch bool, action string, startTime time.Time) {
 	if !config.Kiosk.DebugVerbose {
@@ -254,6 +469,12 @@ func processViewImageData(imageOrientation immich.ImageOrientation, requestConfi
 	requestID := utils.ColorizeRequestId(c.Response().Header().Get(echo.HeaderXRequestID))
 	kioskDeviceID := c.Request().Header.Get("kiosk-device-id")
 
+	// prefetching carries on after the response has been sent, so it must outlive the request
+	ctx := c.Request().Context()
+	if isPrefetch {
+		ctx = context.WithoutCancel(ctx)
+	}
+
 	immichImage := immich.NewImage(requestConfig)
 
 	switch imageOrientation {
@@ -263,13 +484,13 @@ func processViewImageData(imageOrientation immich.ImageOrientation, requestConfi
 		immichImage.RatioWanted = imageOrientation
 	}
 
-	imgBytes, err := processImage(&immichImage, requestConfig, requestID, kioskDeviceID, isPrefetch)
+	imgBytes, err := processImage(ctx, &immichImage, requestConfig, requestID, kioskDeviceID, isPrefetch)
 	if err != nil {
 		return views.ImageData{}, fmt.Errorf("selecting image: %w", err)
 	}
 
 	if strings.EqualFold(requestConfig.ImageEffect, "smart-zoom") && len(immichImage.People)+len(immichImage.UnassignedFaces) == 0 {
-		immichImage.CheckForFaces(requestID)
+		immichImage.CheckForFaces(ctx, requestID)
 	}
 
 	if ShouldDrawFacesOnImages() {
@@ -277,15 +498,12 @@ func processViewImageData(imageOrientation immich.ImageOrientation, requestConfi
 		imgBytes = DrawFaceOnImage(imgBytes, &immichImage)
 	}
 
-	img, err := imageToBase64(imgBytes, requestConfig, requestID, kioskDeviceID, "Converted", isPrefetch)
+	img, imgBlur, err := imageSources(&immichImage, imgBytes, requestConfig, requestID, kioskDeviceID, isPrefetch)
 	if err != nil {
 		return views.ImageData{}, err
 	}
 
-	imgBlur, err := processBlurredImage(imgBytes, requestConfig, requestID, kioskDeviceID, isPrefetch)
-	if err != nil {
-		return views.ImageData{}, err
-	}
+	rememberForOffline(requestConfig, immichImage, imgBytes)
 
 	return views.ImageData{
 		ImmichImage:   immichImage,
@@ -302,14 +520,23 @@ func ProcessViewImageDataWithRatio(imageOrientation immich.ImageOrientation, req
 	return processViewImageData(imageOrientation, requestConfig, c, isPrefetch)
 }
 
+// viewDataCacheKey returns the key for cached view data of the given request, account and device.
+// The account is part of the key so prefetched assets are never shown on another account's screen.
+func viewDataCacheKey(c echo.Context, account, kioskDeviceID string) string {
+	return c.Request().URL.String() + account + kioskDeviceID
+}
+
 func imagePreFetch(requestConfig config.Config, c echo.Context, kioskDeviceID string) {
 
 	viewDataToAdd, err := generateViewData(requestConfig, c, kioskDeviceID, true)
 	if err != nil {
+		metrics.Prefetches.WithLabelValues("error").Inc()
 		log.Error("prefetch", "err", err)
 		return
 	}
 
+	metrics.Prefetches.WithLabelValues("success").Inc()
+
 	trimHistory(&requestConfig.History, 10)
 
 	cachedViewData := []views.ViewData{}
@@ -317,7 +544,7 @@ func imagePreFetch(requestConfig config.Config, c echo.Context, kioskDeviceID st
 	viewDataCacheMutex.Lock()
 	defer viewDataCacheMutex.Unlock()
 
-	cacheKey := c.Request().URL.String() + kioskDeviceID
+	cacheKey := viewDataCacheKey(c, requestConfig.Account, kioskDeviceID)
 
 	if data, found := ViewDataCache.Get(cacheKey); found {
 		cachedViewData = data.([]views.ViewData)
@@ -369,20 +596,24 @@ func imagePreFetch(requestConfig config.Config, c echo.Context, kioskDeviceID st
 // 	wg.Wait()
 // }
 
-// fromCache retrieves cached page data for a given request and device ID.
-func fromCache(c echo.Context, kioskDeviceID string) []views.ViewData {
+// fromCache retrieves cached page data for a given request, account and device ID.
+// Data prefetched while another schedule entry was in use is flushed, as it was made with that entry's sources.
+func fromCache(c echo.Context, account, activeSchedule, kioskDeviceID string) []views.ViewData {
 
 	viewDataCacheMutex.Lock()
 	defer viewDataCacheMutex.Unlock()
 
-	cacheKey := c.Request().URL.String() + kioskDeviceID
+	cacheKey := viewDataCacheKey(c, account, kioskDeviceID)
 	if data, found := ViewDataCache.Get(cacheKey); found {
 		cachedPageData := data.([]views.ViewData)
-		if len(cachedPageData) > 0 {
+		if len(cachedPageData) > 0 && cachedPageData[0].Config.ActiveSchedule == activeSchedule {
+			metrics.CacheLookup(metrics.CacheViewData, true)
 			return cachedPageData
 		}
 		ViewDataCache.Delete(cacheKey)
 	}
+
+	metrics.CacheLookup(metrics.CacheViewData, false)
 	return nil
 }
 
@@ -393,7 +624,7 @@ func renderCachedViewData(c echo.Context, cachedViewData []views.ViewData, reque
 
 	log.Debug(requestID, "deviceID", kioskDeviceID, "cache hit for new image", true)
 
-	cacheKey := c.Request().URL.String() + kioskDeviceID
+	cacheKey := viewDataCacheKey(c, requestConfig.Account, kioskDeviceID)
 
 	viewDataToRender := cachedViewData[0]
 	ViewDataCache.Set(cacheKey, cachedViewData[1:], cache.DefaultExpiration)
@@ -402,7 +633,7 @@ func renderCachedViewData(c echo.Context, cachedViewData []views.ViewData, reque
 	trimHistory(&requestConfig.History, 10)
 	viewDataToRender.History = requestConfig.History
 
-	return Render(c, http.StatusOK, views.Image(viewDataToRender))
+	return renderImage(c, viewDataToRender)
 }
 
 // generateViewData generates page data for the current request.
@@ -423,7 +654,8 @@ func generateViewData(requestConfig config.Config, c echo.Context, kioskDeviceID
 		}
 		viewData.Images = append(viewData.Images, viewDataSplitView)
 
-		if viewDataSplitView.ImmichImage.IsLandscape {
+		// landscape images and videos are always displayed on their own
+		if viewDataSplitView.ImmichImage.IsLandscape || viewDataSplitView.ImmichImage.Type == immich.VideoType {
 			return viewData, nil
 		}
 
@@ -447,7 +679,8 @@ func generateViewData(requestConfig config.Config, c echo.Context, kioskDeviceID
 		}
 		viewData.Images = append(viewData.Images, viewDataSplitView)
 
-		if viewDataSplitView.ImmichImage.IsPortrait {
+		// portrait images and videos are always displayed on their own
+		if viewDataSplitView.ImmichImage.IsPortrait || viewDataSplitView.ImmichImage.Type == immich.VideoType {
 			return viewData, nil
 		}
 
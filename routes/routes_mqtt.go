@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/damongolding/immich-kiosk/mqtt"
+)
+
+// MQTTController gives the MQTT bridge access to the known devices and the events pushed to them.
+type MQTTController struct{}
+
+// Devices returns the known devices.
+func (MQTTController) Devices() []mqtt.Device {
+	now := time.Now()
+	devices := kioskDevices.list(now)
+
+	mqttDevices := make([]mqtt.Device, len(devices))
+
+	for i, device := range devices {
+		mqttDevices[i] = mqtt.Device{
+			ID:       device.ID,
+			Version:  device.Version,
+			Online:   now.Sub(device.LastSeen) <= deviceOnlineWindow,
+			Sleeping: kioskEvents.isSleeping(device.ID),
+			Paused:   kioskEvents.isPaused(device.ID),
+			AssetIDs: device.AssetIDs,
+		}
+	}
+
+	return mqttDevices
+}
+
+// Push pushes the named event to the device.
+func (MQTTController) Push(deviceID, event string) int {
+	return PushEvent(deviceID, KioskEvent(event))
+}
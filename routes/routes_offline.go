@@ -0,0 +1,335 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/diskcache"
+	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/damongolding/immich-kiosk/views"
+)
+
+const (
+	// offlineHistorySize the number of recently shown assets kept for each source set to show while offline
+	offlineHistorySize = 10
+	// offlineMaxSources the most source sets kept in the offline history. The least recently shown is removed to make room
+	offlineMaxSources = 100
+	// offlineProbeInterval time between checks to see if an offline Immich server is back
+	offlineProbeInterval = 15 * time.Second
+	// offlinePingTimeout time before a ping to Immich is considered failed
+	offlinePingTimeout = 5 * time.Second
+	// offlineHeader response header telling the frontend Immich could not be reached
+	offlineHeader = "kiosk-offline"
+)
+
+var errNoOfflineAssets = errors.New("no assets available while Immich is offline")
+
+// offlineAsset an asset that can be shown without Immich. Recently shown assets are kept
+// with their bytes, assets from the disk cache hold the key their bytes are stored under.
+type offlineAsset struct {
+	ImmichImage  immich.ImmichAsset
+	ImgBytes     []byte
+	DiskCacheKey string
+}
+
+// offlineSource the recently shown assets of a source set
+type offlineSource struct {
+	// immichUrl the Immich server the assets came from
+	immichUrl string
+	assets    []offlineAsset
+	updated   time.Time
+}
+
+// offlinePosition the position of a device in the offline rotation
+type offlinePosition struct {
+	// immichUrl the offline Immich server the device is using
+	immichUrl string
+	next      int
+}
+
+var (
+	offlineMutex sync.Mutex
+	// offlineServers Immich urls that can not be reached, each being probed in the background
+	offlineServers = map[string]struct{}{}
+	// offlineHistory recently shown assets by source set, see offlineSourceKey
+	offlineHistory = map[string]offlineSource{}
+	// offlinePositions the position in the offline rotation of each device
+	offlinePositions = map[string]offlinePosition{}
+)
+
+// offlineSourceKey groups requests that show the same assets: the same account, sources and
+// album and person exclusions. Assets shown to one group are never shown offline to another.
+func offlineSourceKey(requestConfig config.Config) string {
+	return fmt.Sprint(
+		requestConfig.Account,
+		requestConfig.Album,
+		requestConfig.Person,
+		requestConfig.Tag,
+		requestConfig.Search,
+		requestConfig.DateRange,
+		requestConfig.City,
+		requestConfig.State,
+		requestConfig.Country,
+		requestConfig.CameraMake,
+		requestConfig.CameraModel,
+		requestConfig.ExcludeAlbum,
+		requestConfig.ExcludePerson,
+	)
+}
+
+// hasSources reports whether the request limits which assets are shown,
+// either with sources or with album and person exclusions.
+func hasSources(requestConfig config.Config) bool {
+	return len(requestConfig.Album) > 0 ||
+		len(requestConfig.Person) > 0 ||
+		len(requestConfig.Tag) > 0 ||
+		len(requestConfig.Search) > 0 ||
+		len(requestConfig.DateRange) > 0 ||
+		len(requestConfig.City) > 0 ||
+		len(requestConfig.State) > 0 ||
+		len(requestConfig.Country) > 0 ||
+		len(requestConfig.CameraMake) > 0 ||
+		len(requestConfig.CameraModel) > 0 ||
+		len(requestConfig.ExcludeAlbum) > 0 ||
+		len(requestConfig.ExcludePerson) > 0
+}
+
+// rememberForOffline keeps a recently shown asset so it can be shown while Immich is offline.
+// Videos are skipped as they are streamed from Immich.
+func rememberForOffline(requestConfig config.Config, immichImage immich.ImmichAsset, imgBytes []byte) {
+	if immichImage.Type == immich.VideoType || len(imgBytes) == 0 {
+		return
+	}
+
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	key := offlineSourceKey(requestConfig)
+
+	source, found := offlineHistory[key]
+	if !found && len(offlineHistory) >= offlineMaxSources {
+		forgetOldestOfflineSource()
+	}
+
+	history := slices.DeleteFunc(source.assets, func(a offlineAsset) bool {
+		return a.ImmichImage.ID == immichImage.ID
+	})
+
+	history = append(history, offlineAsset{ImmichImage: immichImage, ImgBytes: imgBytes})
+	if len(history) > offlineHistorySize {
+		history = history[len(history)-offlineHistorySize:]
+	}
+
+	offlineHistory[key] = offlineSource{immichUrl: requestConfig.ImmichUrl, assets: history, updated: time.Now()}
+}
+
+// forgetOldestOfflineSource removes the source set shown least recently from the offline history.
+// offlineMutex must be held.
+func forgetOldestOfflineSource() {
+	oldestKey := ""
+	var oldest time.Time
+
+	for key, source := range offlineHistory {
+		if oldestKey == "" || source.updated.Before(oldest) {
+			oldestKey, oldest = key, source.updated
+		}
+	}
+
+	delete(offlineHistory, oldestKey)
+}
+
+// forgetOfflineServer marks the Immich server as online and removes the offline history and
+// rotation positions of its devices, as fresh assets are shown from now on.
+func forgetOfflineServer(immichUrl string) {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	delete(offlineServers, immichUrl)
+
+	for key, source := range offlineHistory {
+		if source.immichUrl == immichUrl {
+			delete(offlineHistory, key)
+		}
+	}
+
+	for deviceID, position := range offlinePositions {
+		if position.immichUrl == immichUrl {
+			delete(offlinePositions, deviceID)
+		}
+	}
+}
+
+// isImmichOffline reports whether the Immich server of the request is known to be unreachable.
+func isImmichOffline(requestConfig config.Config) bool {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	_, offline := offlineServers[requestConfig.ImmichUrl]
+	return offline
+}
+
+// pingImmich checks if the Immich server of the request can be reached.
+func pingImmich(requestConfig config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), offlinePingTimeout)
+	defer cancel()
+
+	immichServer := immich.NewImage(requestConfig)
+	return immichServer.Ping(ctx)
+}
+
+// checkImmichOffline pings Immich after a failed request. If Immich can not be reached
+// the server is marked offline and probed in the background until it is back.
+func checkImmichOffline(requestConfig config.Config) bool {
+	if isImmichOffline(requestConfig) {
+		return true
+	}
+
+	if err := pingImmich(requestConfig); err == nil {
+		return false
+	}
+
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	if _, probing := offlineServers[requestConfig.ImmichUrl]; !probing {
+		offlineServers[requestConfig.ImmichUrl] = struct{}{}
+		log.Warn("Immich is offline, showing recent assets", "url", requestConfig.ImmichUrl)
+		go probeImmich(requestConfig)
+	}
+
+	return true
+}
+
+// probeImmich pings Immich until it can be reached again and then marks the server as online.
+func probeImmich(requestConfig config.Config) {
+	ticker := time.NewTicker(offlineProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := pingImmich(requestConfig); err != nil {
+			log.Debug("Immich still offline", "url", requestConfig.ImmichUrl, "err", err)
+			continue
+		}
+
+		forgetOfflineServer(requestConfig.ImmichUrl)
+
+		log.Info("Immich is back online", "url", requestConfig.ImmichUrl)
+		return
+	}
+}
+
+// diskCachedOfflineAssets returns the assets in the disk cache that can be shown with the given config.
+// The disk cache does not record which account, album or person an asset belongs to, so it is only used
+// when no other accounts are configured and the request shows the whole library.
+func diskCachedOfflineAssets(requestConfig config.Config) []offlineAsset {
+	if ImageDiskCache == nil || len(requestConfig.Accounts) > 0 || hasSources(requestConfig) {
+		return nil
+	}
+
+	var assets []offlineAsset
+
+	for _, key := range ImageDiskCache.Keys() {
+		assetID, size, ok := diskcache.ParseKey(key)
+		if !ok || size != imageVariant(requestConfig) {
+			continue
+		}
+
+		assets = append(assets, offlineAsset{
+			ImmichImage:  immich.ImmichAsset{ID: assetID, Type: immich.ImageType},
+			DiskCacheKey: key,
+		})
+	}
+
+	return assets
+}
+
+// nextOfflineAsset returns the next asset for the device to show while Immich is offline.
+// Recently shown assets from the same source set are used first, then assets from the disk cache.
+// Assets in exclude_asset are never used.
+func nextOfflineAsset(requestConfig config.Config, kioskDeviceID string) (offlineAsset, error) {
+	offlineMutex.Lock()
+	candidates := slices.Clone(offlineHistory[offlineSourceKey(requestConfig)].assets)
+	offlineMutex.Unlock()
+
+	for _, asset := range diskCachedOfflineAssets(requestConfig) {
+		if !slices.ContainsFunc(candidates, func(a offlineAsset) bool { return a.ImmichImage.ID == asset.ImmichImage.ID }) {
+			candidates = append(candidates, asset)
+		}
+	}
+
+	candidates = slices.DeleteFunc(candidates, func(a offlineAsset) bool {
+		return slices.Contains(requestConfig.ExcludeAsset, a.ImmichImage.ID)
+	})
+
+	if len(candidates) == 0 {
+		return offlineAsset{}, errNoOfflineAssets
+	}
+
+	offlineMutex.Lock()
+	position := offlinePositions[kioskDeviceID].next % len(candidates)
+	offlinePositions[kioskDeviceID] = offlinePosition{immichUrl: requestConfig.ImmichUrl, next: position + 1}
+	offlineMutex.Unlock()
+
+	asset := candidates[position]
+
+	if asset.ImgBytes == nil {
+		imgBytes, found := ImageDiskCache.Get(asset.DiskCacheKey)
+		if !found {
+			return offlineAsset{}, errNoOfflineAssets
+		}
+		asset.ImgBytes = imgBytes
+	}
+
+	// live photo clips are streamed from Immich
+	asset.ImmichImage.LivePhotoVideoID = ""
+
+	return asset, nil
+}
+
+// offlineViewData returns view data for an asset shown while Immich is offline.
+func offlineViewData(requestConfig config.Config, requestID, kioskDeviceID string) (views.ViewData, error) {
+	asset, err := nextOfflineAsset(requestConfig, kioskDeviceID)
+	if err != nil {
+		return views.ViewData{}, err
+	}
+
+	img, imgBlur, err := imageSources(&asset.ImmichImage, asset.ImgBytes, requestConfig, requestID, kioskDeviceID, false)
+	if err != nil {
+		return views.ViewData{}, err
+	}
+
+	return views.ViewData{
+		DeviceID: kioskDeviceID,
+		Images: []views.ImageData{
+			{
+				ImmichImage:   asset.ImmichImage,
+				ImageData:     img,
+				ImageBlurData: imgBlur,
+			},
+		},
+		Config: requestConfig,
+	}, nil
+}
+
+// renderOffline renders an asset shown while Immich is offline and tells the frontend to show the offline icon.
+// It returns false when there is nothing to show.
+func renderOffline(c echo.Context, requestConfig config.Config, requestID, kioskDeviceID string) (bool, error) {
+	viewData, err := offlineViewData(requestConfig, requestID, kioskDeviceID)
+	if err != nil {
+		log.Error(requestID, "offline fallback", "err", err)
+		return false, nil
+	}
+
+	log.Debug(requestID, "showing offline asset", "asset", viewData.Images[0].ImmichImage.ID)
+
+	c.Response().Header().Set(offlineHeader, "true")
+	return true, renderImage(c, viewData)
+}
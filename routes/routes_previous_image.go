@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -30,6 +32,10 @@ func PreviousImage(baseConfig *config.Config) echo.HandlerFunc {
 
 		err := requestConfig.ConfigWithOverrides(c)
 		if err != nil {
+			// never fall back to another account's or profile's assets
+			if errors.Is(err, config.ErrAccountNotFound) || errors.Is(err, config.ErrProfileNotFound) {
+				return RenderError(c, err, "selecting account or profile")
+			}
 			log.Error("overriding config", "err", err)
 		}
 
@@ -40,6 +46,9 @@ func PreviousImage(baseConfig *config.Config) echo.HandlerFunc {
 			"path", c.Request().URL.String(),
 			"requestConfig", requestConfig.String(),
 		)
+
+		recordDevice(c, &requestConfig)
+
 		historyLen := len(requestConfig.History)
 
 		if isSleepMode(requestConfig) || historyLen < 2 {
@@ -50,63 +59,74 @@ func PreviousImage(baseConfig *config.Config) echo.HandlerFunc {
 		prevImages := strings.Split(lastHistoryEntry, ",")
 		requestConfig.History = requestConfig.History[:historyLen-2]
 
+		images, err := assetsImageData(c.Request().Context(), requestConfig, requestID, kioskDeviceID, prevImages)
+		if err != nil {
+			return RenderError(c, err, "processing images")
+		}
+
 		ViewData := views.ViewData{
 			KioskVersion: kioskDeviceVersion,
 			DeviceID:     kioskDeviceID,
-			Images:       make([]views.ImageData, len(prevImages)),
+			Images:       images,
 			Queries:      c.QueryParams(),
 			Config:       requestConfig,
 		}
 
-		g, _ := errgroup.WithContext(c.Request().Context())
+		return renderImage(c, ViewData)
+	}
+}
 
-		for i, imageID := range prevImages {
-			i, imageID := i, imageID
-			g.Go(func() error {
-				image := immich.NewImage(requestConfig)
-				image.ID = imageID
+// assetsImageData fetches the given assets and returns them ready to be shown.
+func assetsImageData(ctx context.Context, requestConfig config.Config, requestID, kioskDeviceID string, assetIDs []string) ([]views.ImageData, error) {
 
-				var wg sync.WaitGroup
-				wg.Add(1)
+	images := make([]views.ImageData, len(assetIDs))
 
-				go func(image *immich.ImmichAsset, requestID string, wg *sync.WaitGroup) {
-					defer wg.Done()
+	g, ctx := errgroup.WithContext(ctx)
 
-					image.AssetInfo(requestID)
+	for i, imageID := range assetIDs {
+		i, imageID := i, imageID
+		g.Go(func() error {
+			image := immich.NewImage(requestConfig)
+			image.ID = imageID
 
-				}(&image, requestID, &wg)
+			// AssetInfo replaces image in the background, so the preview is fetched with a copy
+			previewImage := image
 
-				imgBytes, err := image.ImagePreview()
-				if err != nil {
-					return fmt.Errorf("retrieving image: %w", err)
-				}
+			var wg sync.WaitGroup
+			wg.Add(1)
 
-				img, err := imageToBase64(imgBytes, requestConfig, requestID, kioskDeviceID, "Converted", false)
-				if err != nil {
-					return fmt.Errorf("converting image to base64: %w", err)
-				}
+			go func(image *immich.ImmichAsset, requestID string, wg *sync.WaitGroup) {
+				defer wg.Done()
 
-				imgBlur, err := processBlurredImage(imgBytes, requestConfig, requestID, kioskDeviceID, false)
-				if err != nil {
-					return fmt.Errorf("converting blurred image to base64: %w", err)
-				}
+				image.AssetInfo(ctx, requestID)
 
-				wg.Wait()
+			}(&image, requestID, &wg)
 
-				ViewData.Images[i] = views.ImageData{
-					ImmichImage:   image,
-					ImageData:     img,
-					ImageBlurData: imgBlur,
-				}
-				return nil
-			})
-		}
+			imgBytes, err := fetchImagePreview(ctx, &previewImage, requestConfig, requestID, kioskDeviceID, false)
+			if err != nil {
+				return fmt.Errorf("retrieving image: %w", err)
+			}
 
-		// Wait for all goroutines to complete and check for errors
-		if err := g.Wait(); err != nil {
-			return RenderError(c, err, "processing images")
-		}
+			img, imgBlur, err := imageSources(&previewImage, imgBytes, requestConfig, requestID, kioskDeviceID, false)
+			if err != nil {
+				return fmt.Errorf("converting image: %w", err)
+			}
+
+			wg.Wait()
 
-		return Render(c, http.StatusOK, views.Image(ViewData))
+			images[i] = views.ImageData{
+				ImmichImage:   image,
+				ImageData:     img,
+				ImageBlurData: imgBlur,
+			}
+			return nil
+		})
 	}
+
+	// Wait for all goroutines to complete and check for errors
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
 }
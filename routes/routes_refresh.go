@@ -2,6 +2,7 @@ package routes
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/labstack/echo/v4"
@@ -16,17 +17,27 @@ func RefreshCheck(baseConfig *config.Config) echo.HandlerFunc {
 
 		kioskVersionHeader := c.Request().Header.Get("kiosk-version")
 		kioskRefreshTimestampHeader := c.Request().Header.Get("kiosk-reload-timestamp")
+		kioskScheduleHeader := c.Request().Header.Get("kiosk-schedule")
 		requestID := utils.ColorizeRequestId(c.Response().Header().Get(echo.HeaderXRequestID))
 
 		// create a copy of the global config to use with this request
 		requestConfig := *baseConfig
 
+		recordDevice(c, nil)
+
 		// If kiosk version on client and server do not match refresh client.
 		if KioskVersion != kioskVersionHeader || kioskRefreshTimestampHeader != requestConfig.ReloadTimeStamp {
 			c.Response().Header().Set("HX-Refresh", "true")
 			return c.NoContent(http.StatusNoContent)
 		}
 
+		// reload clients when the schedule changes, so the new layout, theme and refresh are used
+		if schedule := requestConfig.ActiveScheduleName(time.Now()); kioskScheduleHeader != schedule {
+			log.Debug(requestID, "schedule changed", "from", kioskScheduleHeader, "to", schedule)
+			c.Response().Header().Set("HX-Refresh", "true")
+			return c.NoContent(http.StatusNoContent)
+		}
+
 		log.Debug(
 			requestID,
 			"method", c.Request().Method,
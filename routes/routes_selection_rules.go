@@ -0,0 +1,132 @@
+package routes
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/utils"
+	"github.com/damongolding/immich-kiosk/weather"
+)
+
+// libraryAssetType the weighted asset type of the whole library, used when selection rules
+// add sources to a request that has none
+const libraryAssetType = "LIBRARY"
+
+// ruleConditions what selection rules are matched against. The clock and weather are
+// passed in so rules can be checked without waiting for the right weather or time of day.
+type ruleConditions struct {
+	now time.Time
+	// weather returns the current weather of the named location
+	weather func(name string) weather.WeatherLocation
+}
+
+// currentRuleConditions the conditions right now.
+func currentRuleConditions() ruleConditions {
+	return ruleConditions{
+		now:     time.Now(),
+		weather: weather.CurrentWeather,
+	}
+}
+
+// minuteOfDay returns the minutes since midnight of t.
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+// isNight reports whether now is before sunrise or after sunset at the weather location.
+// Sunrise and sunset are compared as times of day, so they still work with weather fetched the day before.
+// known is false when the location has no sunrise and sunset.
+func isNight(location weather.WeatherLocation, now time.Time) (night, known bool) {
+	if location.Sys.Sunrise == 0 || location.Sys.Sunset == 0 {
+		return false, false
+	}
+
+	sunrise := minuteOfDay(time.Unix(int64(location.Sys.Sunrise), 0).In(now.Location()))
+	sunset := minuteOfDay(time.Unix(int64(location.Sys.Sunset), 0).In(now.Location()))
+	minute := minuteOfDay(now)
+
+	return minute < sunrise || minute >= sunset, true
+}
+
+// matches reports whether the weather and time of day match the rule.
+func (rc ruleConditions) matches(rule config.SelectionRule) bool {
+	if len(rule.Weather) == 0 && rule.TimeOfDay == "" {
+		return true
+	}
+
+	location := rc.weather(rule.WeatherLocation)
+
+	if len(rule.Weather) > 0 {
+		if len(location.Data) == 0 || !slices.Contains(rule.Weather, strings.ToLower(location.Data[0].Main)) {
+			return false
+		}
+	}
+
+	if rule.TimeOfDay != "" {
+		night, known := isNight(location, rc.now)
+		if !known || night != (rule.TimeOfDay == config.TimeOfDayNight) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectionBoosts returns the boost of each album and person of the rules that match.
+// When rules share a source the biggest boost is used.
+func selectionBoosts(rules []config.SelectionRule, rc ruleConditions) map[utils.WeightedAsset]int {
+	boosts := make(map[utils.WeightedAsset]int)
+
+	for _, rule := range rules {
+		if !rc.matches(rule) {
+			continue
+		}
+
+		for _, source := range []struct {
+			assetType string
+			ids       []string
+		}{
+			{"ALBUM", rule.Album},
+			{"PERSON", rule.Person},
+		} {
+			for _, id := range source.ids {
+				asset := utils.WeightedAsset{Type: source.assetType, ID: id}
+				boosts[asset] = max(boosts[asset], rule.Boost)
+			}
+		}
+	}
+
+	return boosts
+}
+
+// addBoostedSources adds the boosted albums and people missing from the request, so rules
+// can bring in sources that are only shown while they match. Excluded albums and people are never added.
+func addBoostedSources(requestConfig *config.Config, boosts map[utils.WeightedAsset]int) {
+	// clipped so appending never writes into a slice shared with the base config
+	requestConfig.Album = slices.Clip(requestConfig.Album)
+	requestConfig.Person = slices.Clip(requestConfig.Person)
+
+	for asset := range boosts {
+		switch asset.Type {
+		case "ALBUM":
+			if !slices.Contains(requestConfig.Album, asset.ID) && !slices.Contains(requestConfig.ExcludeAlbum, asset.ID) {
+				requestConfig.Album = append(requestConfig.Album, asset.ID)
+			}
+		case "PERSON":
+			if !slices.Contains(requestConfig.Person, asset.ID) && !slices.Contains(requestConfig.ExcludePerson, asset.ID) {
+				requestConfig.Person = append(requestConfig.Person, asset.ID)
+			}
+		}
+	}
+}
+
+// applyBoosts sets the boost of each source that has one.
+func applyBoosts(peopleAndAlbums []utils.AssetWithWeighting, boosts map[utils.WeightedAsset]int) {
+	for i := range peopleAndAlbums {
+		if boost, ok := boosts[peopleAndAlbums[i].Asset]; ok {
+			peopleAndAlbums[i].Boost = boost
+		}
+	}
+}
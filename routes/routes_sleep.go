@@ -9,6 +9,7 @@ import (
 
 	"github.com/damongolding/immich-kiosk/config"
 	"github.com/damongolding/immich-kiosk/utils"
+	"github.com/damongolding/immich-kiosk/views"
 )
 
 // Sleep sleep mode endpoint
@@ -16,6 +17,7 @@ func Sleep(baseConfig *config.Config) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
 		kioskVersionHeader := c.Request().Header.Get("kiosk-version")
+		kioskDeviceID := c.Request().Header.Get("kiosk-device-id")
 		requestID := utils.ColorizeRequestId(c.Response().Header().Get(echo.HeaderXRequestID))
 
 		// create a copy of the global config to use with this request
@@ -38,20 +40,19 @@ func Sleep(baseConfig *config.Config) echo.HandlerFunc {
 			"path", c.Request().URL.String(),
 			"Sleep start", requestConfig.SleepStart,
 			"Sleep end", requestConfig.SleepEnd,
+			"Sleep windows", len(requestConfig.SleepWindows),
 		)
 
-		if sleepTime, _ := utils.IsSleepTime(requestConfig.SleepStart, requestConfig.SleepEnd, time.Now()); sleepTime {
-			return c.HTML(http.StatusOK, `
-			<script>
-    			document.body.classList.add('sleep');
-       		</script>
-			`)
+		recordDevice(c, &requestConfig)
+
+		now := time.Now()
+		asleep, wakesAt := requestConfig.SleepState(now)
+
+		// devices put to sleep with a pushed event stay asleep until they are woken
+		if kioskEvents.isSleeping(kioskDeviceID) {
+			return Render(c, http.StatusOK, views.Sleep(requestConfig, true, time.Time{}, now))
 		}
 
-		return c.HTML(http.StatusOK, `
-		<script>
-    		document.body.classList.remove('sleep');
-       	</script>
-		`)
+		return Render(c, http.StatusOK, views.Sleep(requestConfig, asleep, wakesAt, now))
 	}
 }
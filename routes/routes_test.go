@@ -1,12 +1,29 @@
 package routes
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/damongolding/immich-kiosk/utils"
+	"github.com/damongolding/immich-kiosk/views"
+	"github.com/damongolding/immich-kiosk/weather"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -83,3 +100,932 @@ func TestTrimHistory(t *testing.T) {
 		})
 	}
 }
+
+// newImmichStandIn returns a test server that answers the Immich api calls used when picking
+// an asset of a person or from an album. Asset IDs are made up of the API key used for the
+// request and the requested person or album, so tests can check which config was used.
+func newImmichStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	asset := func(id string) map[string]any {
+		return map[string]any{
+			"id":   id,
+			"type": "IMAGE",
+			"exifInfo": map[string]any{
+				"exifImageWidth":  300,
+				"exifImageHeight": 200,
+			},
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/people/{personID}/statistics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"assets": 3}`)
+	})
+
+	mux.HandleFunc("POST /api/search/random", func(w http.ResponseWriter, r *http.Request) {
+		var body immich.ImmichSearchRandomBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.PersonIds) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		apiKey := r.Header.Get("x-api-key")
+		assets := []map[string]any{}
+		for n := 0; n < 3; n++ {
+			assets = append(assets, asset(fmt.Sprintf("%s-%s-%d", apiKey, body.PersonIds[0], n)))
+		}
+
+		_ = json.NewEncoder(w).Encode(assets)
+	})
+
+	mux.HandleFunc("GET /api/albums/{albumID}", func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get("x-api-key")
+		albumID := r.PathValue("albumID")
+
+		assets := []map[string]any{}
+		for n := 0; n < 3; n++ {
+			assets = append(assets, asset(fmt.Sprintf("%s-%s-%d", apiKey, albumID, n)))
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":         albumID,
+			"assets":     assets,
+			"assetCount": len(assets),
+		})
+	})
+
+	mux.HandleFunc("GET /api/assets/{assetID}/thumbnail", func(w http.ResponseWriter, r *http.Request) {
+		assetID := r.PathValue("assetID")
+
+		// the preview must be requested with the same API key the asset was picked with
+		if !strings.HasPrefix(assetID, r.Header.Get("x-api-key")+"-") {
+			http.Error(w, "wrong api key", http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, assetID)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// TestConcurrentRequestsWithDifferentOverrides runs many requests at once, each with their own
+// API key and person or album override, and checks every request only used its own config.
+// Run with -race to detect shared state between requests.
+func TestConcurrentRequestsWithDifferentOverrides(t *testing.T) {
+	immichServer := newImmichStandIn(t)
+	defer immichServer.Close()
+
+	const requests = 50
+
+	baseConfig := config.New()
+	baseConfig.ImmichUrl = immichServer.URL
+
+	var wg sync.WaitGroup
+
+	for n := 0; n < requests; n++ {
+		wg.Add(1)
+
+		go func(n int) {
+			defer wg.Done()
+
+			requestConfig := *baseConfig
+			requestConfig.ImmichApiKey = fmt.Sprintf("key%d", n)
+
+			source := fmt.Sprintf("source%d", n)
+			if n%2 == 0 {
+				requestConfig.Person = []string{source}
+			} else {
+				requestConfig.Album = []string{source}
+			}
+
+			immichImage := immich.NewImage(requestConfig)
+
+			imgBytes, err := processImage(context.Background(), &immichImage, requestConfig, "TESTING", "", false)
+			if !assert.NoError(t, err, "processImage should not return an error") {
+				return
+			}
+
+			wantPrefix := requestConfig.ImmichApiKey + "-" + source + "-"
+			assert.True(t, strings.HasPrefix(immichImage.ID, wantPrefix), "asset %s should start with %s", immichImage.ID, wantPrefix)
+			assert.Equal(t, immichImage.ID, string(imgBytes), "preview should belong to the picked asset")
+		}(n)
+	}
+
+	wg.Wait()
+}
+
+// serveAsset requests the given asset url from the Asset handler.
+func serveAsset(t *testing.T, assetURL string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	e.GET("/asset/:id", Asset)
+
+	req := httptest.NewRequest(http.MethodGet, assetURL, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestFromCacheScheduleChange(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/image", nil), httptest.NewRecorder())
+
+	cacheKey := viewDataCacheKey(c, "", "schedule-device")
+	defer ViewDataCache.Delete(cacheKey)
+
+	ViewDataCache.Set(cacheKey, []views.ViewData{{Config: config.Config{ActiveSchedule: "kids"}}}, time.Minute)
+
+	assert.NotNil(t, fromCache(c, "", "kids", "schedule-device"), "Data from the schedule in use should be used")
+	assert.Nil(t, fromCache(c, "", "evening", "schedule-device"), "Data from another schedule should not be used")
+
+	_, found := ViewDataCache.Get(cacheKey)
+	assert.False(t, found, "Data from another schedule should be flushed")
+}
+
+func TestAssetURLs(t *testing.T) {
+	requestConfig := config.Config{Account: "partner"}
+	imgBytes := []byte("image bytes")
+
+	assetURL := storeAsset(requestConfig, "asset-1", assetVariantPreview, imgBytes)
+
+	// a second device is handed the same url and bytes
+	otherURL := storeAsset(requestConfig, "asset-1", assetVariantPreview, []byte("other bytes"))
+	assert.Equal(t, assetURL, otherURL, "Devices should share asset urls")
+
+	rec := serveAsset(t, assetURL, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, imgBytes, rec.Body.Bytes(), "Unexpected bytes")
+
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag, "Missing ETag")
+	assert.Contains(t, rec.Header().Get("Cache-Control"), "max-age=", "Missing Cache-Control")
+
+	rec = serveAsset(t, assetURL, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code, "Matching ETag should not resend bytes")
+
+	tampered := strings.Replace(assetURL, "variant=preview", "variant=original", 1)
+	rec = serveAsset(t, tampered, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Tampered url should be rejected")
+
+	otherAccount := strings.Replace(assetURL, "account=partner", "account=family", 1)
+	rec = serveAsset(t, otherAccount, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Url should not work for another account")
+}
+
+func TestAssetURLExpiry(t *testing.T) {
+	lifetime := 10 * time.Minute
+	windowStart := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	first := assetURLExpiry(windowStart.Add(time.Minute), lifetime)
+	second := assetURLExpiry(windowStart.Add(9*time.Minute), lifetime)
+
+	assert.Equal(t, first, second, "Urls made in the same window should expire together")
+	assert.Equal(t, windowStart.Add(2*lifetime), first, "Unexpected expiry")
+	assert.True(t, first.Sub(windowStart.Add(9*time.Minute)) > lifetime, "Urls should outlive their lifetime")
+}
+
+// testPNG returns the bytes of a small png image.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	assert.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+// resetOffline clears the offline state shared between requests.
+func resetOffline() {
+	offlineMutex.Lock()
+	defer offlineMutex.Unlock()
+
+	offlineServers = map[string]struct{}{}
+	offlineHistory = map[string]offlineSource{}
+	offlinePositions = map[string]offlinePosition{}
+}
+
+func TestOfflineRotation(t *testing.T) {
+	resetOffline()
+	defer resetOffline()
+
+	requestConfig := config.Config{}
+	imgBytes := testPNG(t)
+
+	rememberForOffline(requestConfig, immich.ImmichAsset{ID: "asset-1", Type: immich.ImageType}, imgBytes)
+	rememberForOffline(requestConfig, immich.ImmichAsset{ID: "asset-2", Type: immich.ImageType}, imgBytes)
+	rememberForOffline(requestConfig, immich.ImmichAsset{ID: "video-1", Type: immich.VideoType}, imgBytes)
+
+	want := []string{"asset-1", "asset-2", "asset-1"}
+	for _, wantID := range want {
+		asset, err := nextOfflineAsset(requestConfig, "device-a")
+		assert.NoError(t, err)
+		assert.Equal(t, wantID, asset.ImmichImage.ID, "Unexpected offline asset")
+	}
+
+	asset, err := nextOfflineAsset(requestConfig, "device-b")
+	assert.NoError(t, err)
+	assert.Equal(t, "asset-1", asset.ImmichImage.ID, "Each device should have its own rotation")
+
+	_, err = nextOfflineAsset(config.Config{Account: "partner"}, "device-a")
+	assert.ErrorIs(t, err, errNoOfflineAssets, "Assets should never be shown to another account")
+}
+
+func TestOfflineSources(t *testing.T) {
+	resetOffline()
+	defer resetOffline()
+
+	imgBytes := testPNG(t)
+
+	rememberForOffline(config.Config{Album: []string{"kitchen-album"}}, immich.ImmichAsset{ID: "kitchen-asset", Type: immich.ImageType}, imgBytes)
+	rememberForOffline(config.Config{}, immich.ImmichAsset{ID: "library-asset", Type: immich.ImageType}, imgBytes)
+	rememberForOffline(config.Config{}, immich.ImmichAsset{ID: "hidden-asset", Type: immich.ImageType}, imgBytes)
+
+	tests := []struct {
+		name          string
+		requestConfig config.Config
+		want          []string
+	}{
+		{
+			name:          "album",
+			requestConfig: config.Config{Album: []string{"kitchen-album"}},
+			want:          []string{"kitchen-asset"},
+		},
+		{
+			name:          "library",
+			requestConfig: config.Config{},
+			want:          []string{"library-asset", "hidden-asset"},
+		},
+		{
+			name:          "excluded asset",
+			requestConfig: config.Config{ExcludeAsset: []string{"hidden-asset"}},
+			want:          []string{"library-asset"},
+		},
+		{
+			name:          "excluded person",
+			requestConfig: config.Config{ExcludePerson: []string{"person-1"}},
+			want:          nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for range 2 {
+				asset, err := nextOfflineAsset(tt.requestConfig, tt.name)
+				if err != nil {
+					assert.ErrorIs(t, err, errNoOfflineAssets)
+					break
+				}
+				if !slices.Contains(got, asset.ImmichImage.ID) {
+					got = append(got, asset.ImmichImage.ID)
+				}
+			}
+			assert.Equal(t, tt.want, got, "Unexpected offline assets")
+		})
+	}
+}
+
+func TestOfflineForget(t *testing.T) {
+	resetOffline()
+	defer resetOffline()
+
+	imgBytes := testPNG(t)
+	kitchen := config.Config{ImmichUrl: "http://kitchen.local"}
+	lounge := config.Config{ImmichUrl: "http://lounge.local", Account: "lounge"}
+
+	rememberForOffline(kitchen, immich.ImmichAsset{ID: "kitchen-asset", Type: immich.ImageType}, imgBytes)
+	rememberForOffline(lounge, immich.ImmichAsset{ID: "lounge-asset", Type: immich.ImageType}, imgBytes)
+
+	_, err := nextOfflineAsset(kitchen, "kitchen-device")
+	assert.NoError(t, err)
+	_, err = nextOfflineAsset(lounge, "lounge-device")
+	assert.NoError(t, err)
+
+	forgetOfflineServer(kitchen.ImmichUrl)
+
+	assert.NotContains(t, offlineHistory, offlineSourceKey(kitchen), "History should be removed once the server is back")
+	assert.NotContains(t, offlinePositions, "kitchen-device", "Positions should be removed once the server is back")
+	assert.Contains(t, offlineHistory, offlineSourceKey(lounge), "Other servers should keep their history")
+	assert.Contains(t, offlinePositions, "lounge-device", "Other servers should keep their positions")
+
+	for i := range offlineMaxSources + 1 {
+		rememberForOffline(config.Config{Album: []string{fmt.Sprint(i)}}, immich.ImmichAsset{ID: "asset", Type: immich.ImageType}, imgBytes)
+	}
+	assert.Len(t, offlineHistory, offlineMaxSources, "History should not grow past its limit")
+}
+
+func TestOfflineFallback(t *testing.T) {
+	resetOffline()
+	defer resetOffline()
+
+	// nothing listens on a closed server, so Immich can not be reached
+	immichServer := httptest.NewServer(http.NotFoundHandler())
+	immichServer.Close()
+
+	baseConfig := config.New()
+	baseConfig.ImmichUrl = immichServer.URL
+	baseConfig.Kiosk.PreFetch = false
+
+	rememberForOffline(*baseConfig, immich.ImmichAsset{ID: "recent-asset", Type: immich.ImageType}, testPNG(t))
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/image", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := NewImage(baseConfig)(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(offlineHeader), "The frontend should be told Immich is offline")
+	assert.Contains(t, rec.Body.String(), "recent-asset", "A recent asset should be shown")
+	assert.True(t, isImmichOffline(*baseConfig), "Immich should be marked offline")
+}
+
+func TestRequestedAssetExclusions(t *testing.T) {
+	imgBytes := testPNG(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/server/ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"res": "pong"}`)
+	})
+	mux.HandleFunc("GET /api/albums/excluded-album", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "excluded-album", "assets": [{"id": "album-asset"}], "assetCount": 1}`)
+	})
+	mux.HandleFunc("GET /api/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": %q, "type": "IMAGE"}`, r.PathValue("id"))
+	})
+	mux.HandleFunc("GET /api/assets/{id}/thumbnail", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(imgBytes)
+	})
+	mux.HandleFunc("POST /api/search/random", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	immichServer := httptest.NewServer(mux)
+	defer immichServer.Close()
+
+	baseConfig := config.New()
+	baseConfig.ImmichUrl = immichServer.URL
+	baseConfig.ImmichApiKey = "key"
+	baseConfig.Kiosk.PreFetch = false
+	baseConfig.ExcludeAlbum = []string{"excluded-album"}
+
+	tests := []struct {
+		name      string
+		assetID   string
+		wantShown bool
+	}{
+		{name: "allowed", assetID: "allowed-asset", wantShown: true},
+		{name: "in excluded album", assetID: "album-asset", wantShown: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deviceID := "requested-" + strings.ReplaceAll(tt.name, " ", "-")
+			kioskRemote.showAsset(deviceID, tt.assetID)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/image", nil)
+			req.Header.Set("kiosk-device-id", deviceID)
+			rec := httptest.NewRecorder()
+
+			assert.NoError(t, NewImage(baseConfig)(e.NewContext(req, rec)))
+
+			if tt.wantShown {
+				assert.Contains(t, rec.Body.String(), tt.assetID, "Requested asset should be shown")
+			} else {
+				assert.NotContains(t, rec.Body.String(), tt.assetID, "Excluded assets should never be shown")
+			}
+			assert.Empty(t, kioskRemote.takeAsset(deviceID), "Requested assets should only be used once")
+		})
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := newEventBroker(func(deviceID string) bool { return deviceID == "hallway" })
+
+	kitchen, unsubscribeKitchen := broker.subscribe("kitchen")
+	defer unsubscribeKitchen()
+
+	lounge, unsubscribeLounge := broker.subscribe("lounge")
+
+	assert.Equal(t, 1, broker.publish("kitchen", EventNextImage), "Event should reach one device")
+	assert.Equal(t, EventNextImage, <-kitchen)
+	assert.Empty(t, lounge, "Other devices should not get the event")
+
+	assert.Equal(t, 2, broker.publish("", EventSleep), "Event should reach every device")
+	assert.Equal(t, EventSleep, <-kitchen)
+	assert.Equal(t, EventSleep, <-lounge)
+	assert.True(t, broker.isSleeping("kitchen"), "kitchen should be asleep")
+	assert.True(t, broker.isSleeping("lounge"), "lounge should be asleep")
+
+	broker.publish("lounge", EventWake)
+	assert.False(t, broker.isSleeping("lounge"), "lounge should be awake")
+	assert.True(t, broker.isSleeping("kitchen"), "kitchen should still be asleep")
+
+	unsubscribeLounge()
+	assert.Equal(t, 0, broker.publish("lounge", EventReload), "Unsubscribed devices should not get events")
+
+	broker.publish("hallway", EventSleep)
+	assert.True(t, broker.isSleeping("hallway"), "Known devices should be put to sleep before they subscribe")
+
+	broker.forget("hallway")
+	assert.False(t, broker.isSleeping("hallway"), "Forgotten devices should lose their state")
+
+	broker.publish("made-up", EventSleep)
+	broker.publish("made-up", EventPause)
+	assert.NotContains(t, broker.sleeping, "made-up", "Unknown devices should not be remembered")
+	assert.NotContains(t, broker.paused, "made-up", "Unknown devices should not be remembered")
+}
+
+func TestEventStream(t *testing.T) {
+	e := echo.New()
+	e.GET("/events", Events)
+	e.POST("/events/:event", SendEvent)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events?device=stream-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	pushed, err := http.Post(server.URL+"/events/next-image?device=stream-test", "", nil)
+	if assert.NoError(t, err) {
+		pushed.Body.Close()
+		assert.Equal(t, http.StatusOK, pushed.StatusCode)
+	}
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: next-image\n", line, "Pushed event should be streamed")
+
+	unknown, err := http.Post(server.URL+"/events/explode", "", nil)
+	if assert.NoError(t, err) {
+		unknown.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, unknown.StatusCode, "Unknown events should be rejected")
+	}
+}
+
+func TestDeviceRegistry(t *testing.T) {
+	registry := newDeviceRegistry()
+	now := time.Now()
+
+	c := config.Config{Layout: "splitview"}
+
+	registry.seen("device-1", "1.0.0", "agent", "10.0.0.1", &c, now.Add(-time.Minute))
+	registry.seen("device-2", "1.0.0", "agent", "10.0.0.2", &c, now)
+	registry.showing("device-1", []string{"asset-1", "asset-2"}, now.Add(time.Second))
+
+	// a refresh check does not carry the device config
+	registry.seen("device-2", "", "agent", "10.0.0.2", nil, now)
+
+	registry.seen("../bad", "1.0.0", "agent", "10.0.0.3", &c, now)
+	registry.seen("forgotten", "1.0.0", "agent", "10.0.0.4", &c, now.Add(-deviceForgetAfter-time.Hour))
+
+	devices := registry.list(now)
+	if !assert.Len(t, devices, 2, "Invalid and stale devices should not be listed") {
+		return
+	}
+
+	assert.Equal(t, "device-1", devices[0].ID, "Most recently seen device should be first")
+	assert.Equal(t, []string{"asset-1", "asset-2"}, devices[0].AssetIDs)
+	assert.Equal(t, "splitview", devices[1].Config.Layout, "Config should be kept when not sent")
+	assert.Equal(t, "1.0.0", devices[1].Version, "Version should be kept when not sent")
+}
+
+func TestDeviceRegistryLimit(t *testing.T) {
+	registry := newDeviceRegistry()
+	now := time.Now()
+
+	for i := range maxDevices {
+		registry.seen(fmt.Sprintf("device-%d", i), "1.0.0", "agent", "10.0.0.1", nil, now.Add(time.Duration(i)*time.Second))
+	}
+
+	registry.seen("newest", "1.0.0", "agent", "10.0.0.1", nil, now.Add(time.Hour))
+
+	assert.Len(t, registry.devices, maxDevices, "Registry should not grow past its limit")
+	assert.NotContains(t, registry.devices, "device-0", "Least recently seen device should be removed")
+	assert.Contains(t, registry.devices, "newest")
+
+	registry.seen("returning", "1.0.0", "agent", "10.0.0.1", nil, now.Add(time.Hour+deviceForgetAfter))
+
+	assert.Len(t, registry.devices, 2, "Stale devices should be removed when a device is added")
+
+	var forgotten []string
+	registry.onForget = func(deviceID string) { forgotten = append(forgotten, deviceID) }
+
+	registry.list(now.Add(3 * deviceForgetAfter))
+	assert.ElementsMatch(t, []string{"newest", "returning"}, forgotten, "Removed devices should be reported")
+	assert.False(t, registry.known("newest"))
+}
+
+func TestDeviceIDCookie(t *testing.T) {
+	e := echo.New()
+
+	rec := httptest.NewRecorder()
+	first := deviceID(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+
+	cookies := rec.Result().Cookies()
+	if !assert.Len(t, cookies, 1, "A new device should be given a cookie") {
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+
+	assert.Equal(t, first, deviceID(e.NewContext(req, rec)), "Device ID should be kept across page loads")
+	assert.Empty(t, rec.Result().Cookies(), "Cookie should not be replaced")
+}
+
+func TestAdminAuth(t *testing.T) {
+	baseConfig := config.New()
+
+	e := echo.New()
+	admin := e.Group("/admin", AdminAuth(baseConfig))
+	admin.GET("", Admin)
+	admin.POST("/devices/:deviceID/events/:event", AdminSendEvent)
+
+	var csrfCookie *http.Cookie
+
+	request := func(method, target, password string) *httptest.ResponseRecorder {
+		return adminRequest(e, method, target, password, nil, nil)
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/admin", "").Code, "Admin should be disabled without a password")
+
+	baseConfig.Kiosk.AdminPassword = "secret"
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin", "wrong").Code)
+
+	kioskDevices.seen("admin-test", "1.0.0", "agent", "10.0.0.1", &config.Config{ImmichApiKey: "api-key"}, time.Now())
+
+	rec := request(http.MethodGet, "/admin", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "admin-test", "Devices should be listed")
+	assert.NotContains(t, rec.Body.String(), "api-key", "Credentials should never be shown")
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "kiosk-admin-csrf" {
+			csrfCookie = cookie
+		}
+	}
+	if !assert.NotNil(t, csrfCookie, "Dashboard should set a CSRF cookie") {
+		return
+	}
+	assert.Contains(t, rec.Body.String(), csrfCookie.Value, "Forms should carry the CSRF token")
+
+	rec = request(http.MethodPost, "/admin/devices/admin-test/events/reload", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Events without a CSRF token should be rejected")
+
+	rec = adminRequest(e, http.MethodPost, "/admin/devices/admin-test/events/reload", "secret", csrfCookie, url.Values{adminCSRFField: {"forged"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Events with the wrong CSRF token should be rejected")
+
+	rec = adminRequest(e, http.MethodPost, "/admin/devices/admin-test/events/reload", "secret", csrfCookie, url.Values{adminCSRFField: {csrfCookie.Value}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+
+	rec = adminRequest(e, http.MethodPost, "/admin/devices/all/events/explode", "secret", csrfCookie, url.Values{adminCSRFField: {csrfCookie.Value}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Unknown events should be rejected")
+}
+
+// adminRequest sends a request to the admin dashboard, with form as the body when set.
+func adminRequest(e *echo.Echo, method, target, password string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	if password != "" {
+		req.SetBasicAuth(adminUsername, password)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRemoteControl(t *testing.T) {
+	remote := newRemoteControl()
+	now := time.Now()
+
+	remote.showAsset("device-1", "asset-1")
+	assert.Equal(t, "asset-1", remote.takeAsset("device-1"))
+	assert.Empty(t, remote.takeAsset("device-1"), "Requested assets should only be shown once")
+
+	remote.setSource("device-1", sourceOverride{Album: []string{"album-1"}, Until: now.Add(time.Minute)})
+
+	source, found := remote.source("device-1", now)
+	assert.True(t, found, "Source should be in use")
+	assert.Equal(t, []string{"album-1"}, source.Album)
+
+	_, found = remote.source("device-1", now.Add(2*time.Minute))
+	assert.False(t, found, "Source should end after its duration")
+
+	remote.setSource("device-2", sourceOverride{Person: []string{"person-1"}, Until: now.Add(time.Minute)})
+	remote.clearSource("device-2")
+
+	_, found = remote.source("device-2", now)
+	assert.False(t, found, "Cleared source should not be used")
+}
+
+func TestAPI(t *testing.T) {
+	baseConfig := config.New()
+
+	e := echo.New()
+	api := e.Group("/api/v1", APIAuth(baseConfig))
+	api.GET("/devices", APIDevices)
+	api.POST("/devices/:deviceID/next", APIEvent(EventNextImage))
+	api.POST("/devices/:deviceID/show", APIShowAsset)
+	api.POST("/devices/:deviceID/source", APISetSource)
+
+	request := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/v1/devices", "", "").Code, "API should be disabled without a token")
+
+	baseConfig.Kiosk.APIToken = "token"
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/v1/devices", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/v1/devices", "wrong", "").Code)
+
+	kioskDevices.seen("api-test", "1.0.0", "agent", "10.0.0.1", &config.Config{Profile: "kitchen"}, time.Now())
+
+	rec := request(http.MethodGet, "/api/v1/devices", "token", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":"api-test"`)
+	assert.Contains(t, rec.Body.String(), `"profile":"kitchen"`)
+
+	rec = request(http.MethodPost, "/api/v1/devices/unknown/next", "token", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "Unknown devices should not be found")
+
+	rec = request(http.MethodPost, "/api/v1/devices/api-test/next", "token", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request(http.MethodPost, "/api/v1/devices/api-test/show", "token", `{"asset_id": "../etc"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Invalid asset IDs should be rejected")
+
+	rec = request(http.MethodPost, "/api/v1/devices/api-test/show", "token", `{"asset_id": "asset-1"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "asset-1", kioskRemote.takeAsset("api-test"), "Asset should be shown next")
+
+	kioskDevices.seen("api-test", "", "agent", "10.0.0.1", &config.Config{ExcludeAsset: []string{"asset-2"}}, time.Now())
+
+	rec = request(http.MethodPost, "/api/v1/devices/api-test/show", "token", `{"asset_id": "asset-2"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Excluded assets should be rejected")
+	assert.Empty(t, kioskRemote.takeAsset("api-test"), "Excluded assets should not be shown")
+
+	rec = request(http.MethodPost, "/api/v1/devices/api-test/source", "token", `{"album": ["album-1"], "duration": "soon"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Invalid durations should be rejected")
+
+	rec = request(http.MethodPost, "/api/v1/devices/all/source", "token", `{"album": ["album-1"], "duration": "30m"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	requestConfig := config.Config{Album: []string{"own-album"}, Tag: []string{"own-tag"}, DateRange: []string{"2024-01-01_2024-12-31"}, City: []string{"Paris"}}
+	assert.True(t, useSourceOverride(&requestConfig, "api-test"), "Source should be used")
+	assert.Equal(t, []string{"album-1"}, requestConfig.Album)
+	assert.Empty(t, requestConfig.Tag, "Other sources should not be used")
+	assert.Empty(t, requestConfig.DateRange, "Other sources should not be used")
+	assert.Empty(t, requestConfig.City, "Other sources should not be used")
+
+	kioskRemote.clearSource("api-test")
+}
+
+func TestReadyz(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/server/ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"res": "pong"}`)
+	})
+
+	mux.HandleFunc("GET /api/server/about", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "good-key" {
+			http.Error(w, `{"message": "Invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"version": "v1.120.0"}`)
+	})
+
+	immichServer := httptest.NewServer(mux)
+	defer immichServer.Close()
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+		want       immichHealth
+	}{
+		{
+			name:       "ready",
+			apiKey:     "good-key",
+			wantStatus: http.StatusOK,
+			want:       immichHealth{Reachable: true, APIKey: true, Version: "v1.120.0"},
+		},
+		{
+			name:       "invalid api key",
+			apiKey:     "bad-key",
+			wantStatus: http.StatusServiceUnavailable,
+			want:       immichHealth{Reachable: true, Error: "unexpected status code: 401"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseConfig := config.New()
+			baseConfig.ImmichUrl = immichServer.URL
+			baseConfig.ImmichApiKey = tt.apiKey
+			baseConfig.Kiosk.HTTPTimeout = 1
+
+			baseConfig.Kiosk.APIToken = "token"
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			assert.NoError(t, Readyz(baseConfig)(c))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			var report readiness
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+			assert.Equal(t, []immichHealth{tt.want}, report.Immich)
+			assert.Empty(t, report.StaleWeather, "No weather locations are configured")
+		})
+	}
+
+	var checks atomic.Int32
+	countingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+		mux.ServeHTTP(w, r)
+	}))
+	defer countingServer.Close()
+
+	baseConfig := config.New()
+	baseConfig.ImmichUrl = countingServer.URL
+	baseConfig.ImmichApiKey = "good-key"
+	readyz := Readyz(baseConfig)
+
+	for range 3 {
+		rec := httptest.NewRecorder()
+		assert.NoError(t, readyz(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status": "ok", "immich": 1, "immich_ready": 1, "stale_weather": 0}`, rec.Body.String(), "Details should only be shown to authenticated callers")
+	}
+	assert.Equal(t, int32(2), checks.Load(), "Reports should be reused between probes")
+
+	// nothing listens on a closed server, so Immich can not be reached
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	baseConfig = config.New()
+	baseConfig.ImmichUrl = closedServer.URL
+
+	report := checkReadiness(baseConfig, time.Now())
+	assert.Equal(t, healthStatusUnavailable, report.Status)
+	assert.False(t, report.Immich[0].Reachable)
+	assert.NotEmpty(t, report.Immich[0].Error)
+}
+
+func TestSelectionRules(t *testing.T) {
+	loc := time.FixedZone("test", 0)
+	sunrise := time.Date(2024, 11, 20, 7, 30, 0, 0, loc)
+	sunset := time.Date(2024, 11, 20, 16, 0, 0, 0, loc)
+
+	locations := map[string]weather.WeatherLocation{
+		"london": {Name: "london", Weather: weather.Weather{
+			Data: []weather.WeatherData{{ID: 601, Main: "Snow"}},
+			Sys:  weather.Sys{Sunrise: int(sunrise.Unix()), Sunset: int(sunset.Unix())},
+		}},
+		// no sunrise or sunset, e.g. before the first refresh
+		"paris": {Name: "paris", Weather: weather.Weather{
+			Data: []weather.WeatherData{{ID: 500, Main: "Rain"}},
+		}},
+	}
+
+	currentWeather := func(name string) weather.WeatherLocation {
+		return locations[name]
+	}
+
+	tests := []struct {
+		name string
+		rule config.SelectionRule
+		now  time.Time
+		want bool
+	}{
+		{name: "no conditions", rule: config.SelectionRule{}, now: sunrise, want: true},
+		{name: "snow", rule: config.SelectionRule{Weather: []string{"snow"}, WeatherLocation: "london"}, now: sunrise, want: true},
+		{name: "not raining", rule: config.SelectionRule{Weather: []string{"rain", "drizzle"}, WeatherLocation: "london"}, now: sunrise, want: false},
+		{name: "raining", rule: config.SelectionRule{Weather: []string{"rain", "drizzle"}, WeatherLocation: "paris"}, now: sunrise, want: true},
+		{name: "night after sunset", rule: config.SelectionRule{TimeOfDay: "night", WeatherLocation: "london"}, now: sunset.Add(time.Minute), want: true},
+		{name: "night before sunrise", rule: config.SelectionRule{TimeOfDay: "night", WeatherLocation: "london"}, now: sunrise.Add(-time.Minute), want: true},
+		{name: "night at midday", rule: config.SelectionRule{TimeOfDay: "night", WeatherLocation: "london"}, now: sunrise.Add(5 * time.Hour), want: false},
+		{name: "night a day later", rule: config.SelectionRule{TimeOfDay: "night", WeatherLocation: "london"}, now: sunset.Add(24*time.Hour + time.Hour), want: true},
+		{name: "day at sunrise", rule: config.SelectionRule{TimeOfDay: "day", WeatherLocation: "london"}, now: sunrise, want: true},
+		{name: "snowy night", rule: config.SelectionRule{Weather: []string{"snow"}, TimeOfDay: "night", WeatherLocation: "london"}, now: sunrise.Add(time.Hour), want: false},
+		{name: "unknown sunset", rule: config.SelectionRule{TimeOfDay: "night", WeatherLocation: "paris"}, now: sunset.Add(time.Hour), want: false},
+		{name: "no weather yet", rule: config.SelectionRule{Weather: []string{"snow"}, WeatherLocation: "berlin"}, now: sunrise, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := ruleConditions{now: tt.now, weather: currentWeather}
+			assert.Equal(t, tt.want, rc.matches(tt.rule))
+		})
+	}
+
+	rules := []config.SelectionRule{
+		{Album: []string{"snow-album", "winter-album"}, Weather: []string{"snow"}, WeatherLocation: "london", Boost: 3},
+		{Album: []string{"winter-album"}, Person: []string{"night-owl"}, TimeOfDay: "night", WeatherLocation: "london", Boost: 10},
+		{Album: []string{"rain-album"}, Weather: []string{"rain"}, WeatherLocation: "london", Boost: 5},
+	}
+
+	boosts := selectionBoosts(rules, ruleConditions{now: sunset.Add(time.Hour), weather: currentWeather})
+	assert.Equal(t, map[utils.WeightedAsset]int{
+		{Type: "ALBUM", ID: "snow-album"}:   3,
+		{Type: "ALBUM", ID: "winter-album"}: 10,
+		{Type: "PERSON", ID: "night-owl"}:   10,
+	}, boosts, "The biggest boost of matching rules should be used")
+
+	base := make([]string, 1, 10)
+	base[0] = "family-album"
+	requestConfig := config.Config{Album: base}
+
+	addBoostedSources(&requestConfig, boosts)
+	assert.ElementsMatch(t, []string{"family-album", "snow-album", "winter-album"}, requestConfig.Album)
+	assert.Equal(t, []string{"night-owl"}, requestConfig.Person)
+	assert.Equal(t, "", base[:2][1], "The base config should not be written to")
+
+	excludingConfig := config.Config{ExcludeAlbum: []string{"snow-album"}, ExcludePerson: []string{"night-owl"}}
+	addBoostedSources(&excludingConfig, boosts)
+	assert.Equal(t, []string{"winter-album"}, excludingConfig.Album, "Excluded albums should not be added")
+	assert.Empty(t, excludingConfig.Person, "Excluded people should not be added")
+
+	peopleAndAlbums := []utils.AssetWithWeighting{
+		{Asset: utils.WeightedAsset{Type: "ALBUM", ID: "family-album"}, Weight: 100},
+		{Asset: utils.WeightedAsset{Type: "ALBUM", ID: "snow-album"}, Weight: 100},
+	}
+	applyBoosts(peopleAndAlbums, boosts)
+	assert.Equal(t, 0, peopleAndAlbums[0].Boost)
+	assert.Equal(t, 3, peopleAndAlbums[1].Boost)
+}
+
+func TestSelectionRulesWholeLibrary(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/assets/statistics", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"images": 100, "videos": 5, "total": 105}`)
+	})
+	mux.HandleFunc("GET /api/albums/snow-album", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "snow-album", "assets": [{"id": "snow-1", "type": "IMAGE"}], "assetCount": 20}`)
+	})
+
+	immichServer := httptest.NewServer(mux)
+	defer immichServer.Close()
+
+	requestConfig := config.Config{ImmichUrl: immichServer.URL, ImmichApiKey: "key"}
+	requestConfig.Kiosk.HTTPTimeout = 1
+	requestConfig.SelectionRules = []config.SelectionRule{{Album: []string{"snow-album"}, Boost: 3}}
+
+	immichImage := immich.NewImage(requestConfig)
+
+	peopleAndAlbums, err := gatherPeopleAndAlbums(context.Background(), &immichImage, requestConfig, "")
+	if !assert.NoError(t, err) || !assert.Len(t, peopleAndAlbums, 2) {
+		return
+	}
+
+	assert.Equal(t, utils.WeightedAsset{Type: libraryAssetType}, peopleAndAlbums[0].Asset, "The whole library should still be shown")
+	assert.Equal(t, 100, peopleAndAlbums[0].Weight, "Videos should only be counted when shown")
+	assert.Equal(t, utils.WeightedAsset{Type: "ALBUM", ID: "snow-album"}, peopleAndAlbums[1].Asset, "Rule albums should be added")
+	assert.Equal(t, 3, peopleAndAlbums[1].Boost)
+
+	requestConfig.SelectionRules = nil
+
+	peopleAndAlbums, err = gatherPeopleAndAlbums(context.Background(), &immichImage, requestConfig, "")
+	assert.NoError(t, err)
+	assert.Empty(t, peopleAndAlbums, "Without matching rules the library is used as before")
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/labstack/echo/v4"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/damongolding/immich-kiosk/utils"
+)
+
+// videoResponseHeaders Immich response headers that are passed back to the browser
+var videoResponseHeaders = []string{
+	echo.HeaderContentType,
+	echo.HeaderContentLength,
+	"Content-Range",
+	"Accept-Ranges",
+	"Cache-Control",
+	"ETag",
+	echo.HeaderLastModified,
+}
+
+// Video returns an echo.HandlerFunc that proxies video playback from Immich.
+// The browser never talks to Immich directly, so the Immich API key stays on the server.
+func Video(baseConfig *config.Config) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		requestID := utils.ColorizeRequestId(c.Response().Header().Get(echo.HeaderXRequestID))
+		videoID := c.Param("videoID")
+
+		// create a copy of the global config to use with this request
+		requestConfig := *baseConfig
+
+		err := requestConfig.ConfigWithOverrides(c)
+		if err != nil {
+			if errors.Is(err, config.ErrAccountNotFound) || errors.Is(err, config.ErrProfileNotFound) {
+				return c.NoContent(http.StatusNotFound)
+			}
+			log.Error("overriding config", "err", err)
+		}
+
+		log.Debug(
+			requestID,
+			"method", c.Request().Method,
+			"path", c.Request().URL.String(),
+			"videoID", videoID,
+		)
+
+		if videoID == "" {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		immichVideo := immich.NewImage(requestConfig)
+		immichVideo.ID = videoID
+
+		res, err := immichVideo.VideoPlayback(c.Request().Context(), c.Request().Header)
+		if err != nil {
+			log.Error("streaming video", "videoID", videoID, "err", err)
+			return c.NoContent(http.StatusBadGateway)
+		}
+		defer res.Body.Close()
+
+		for _, header := range videoResponseHeaders {
+			if value := res.Header.Get(header); value != "" {
+				c.Response().Header().Set(header, value)
+			}
+		}
+
+		c.Response().WriteHeader(res.StatusCode)
+
+		_, err = io.Copy(c.Response(), res.Body)
+		if err != nil {
+			log.Debug(requestID, "video stream ended early", "videoID", videoID, "err", err)
+		}
+
+		return nil
+	}
+}
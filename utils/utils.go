@@ -19,6 +19,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,8 @@ import (
 	"github.com/disintegration/imaging"
 
 	"github.com/google/uuid"
+
+	"github.com/damongolding/immich-kiosk/metrics"
 )
 
 type WeightedAsset struct {
@@ -45,6 +48,13 @@ type WeightedAsset struct {
 type AssetWithWeighting struct {
 	Asset  WeightedAsset
 	Weight int
+	// Boost multiplies how likely the asset is to be picked, e.g. by selection rules. 0 counts as 1
+	Boost int
+}
+
+// boost returns the boost of the asset, at least 1.
+func (a AssetWithWeighting) boost() int {
+	return max(a.Boost, 1)
 }
 
 // GenerateUUID generates as UUID
@@ -107,6 +117,8 @@ func BlurImage(imgBytes []byte) ([]byte, error) {
 
 	imageMime := getImageMimeType(bytes.NewReader(imgBytes))
 
+	decodeStart := time.Now()
+
 	switch imageMime {
 	case "image/webp":
 		img, err = webp.Decode(bytes.NewReader(imgBytes))
@@ -122,6 +134,8 @@ func BlurImage(imgBytes []byte) ([]byte, error) {
 		}
 	}
 
+	metrics.ObserveImageProcessing(metrics.StageDecode, decodeStart)
+
 	blurredImg := imaging.Blur(img, 20)
 	blurredImg = imaging.AdjustBrightness(blurredImg, -20)
 
@@ -177,15 +191,21 @@ func RandomItem[T any](s []T) T {
 func calculateTotalWeight(assets []AssetWithWeighting) int {
 	total := 0
 	for _, asset := range assets {
-		logWeight := int(math.Log(float64(asset.Weight) + 1))
-		if logWeight == 0 {
-			logWeight = 1
-		}
-		total += logWeight
+		total += pickWeight(asset)
 	}
 	return total
 }
 
+// pickWeight returns the weight of an asset in a weighted pick: the natural log of its weight
+// plus 1, at least 1, multiplied by its boost.
+func pickWeight(asset AssetWithWeighting) int {
+	logWeight := int(math.Log(float64(asset.Weight) + 1))
+	if logWeight == 0 {
+		logWeight = 1
+	}
+	return logWeight * asset.boost()
+}
+
 // WeightedRandomItem selects a random asset from the given slice of WeightedAsset(s)
 // based on their logarithmic weights. It uses a weighted random selection algorithm.
 func WeightedRandomItem(assets []AssetWithWeighting) WeightedAsset {
@@ -202,11 +222,11 @@ func WeightedRandomItem(assets []AssetWithWeighting) WeightedAsset {
 	randomWeight := rand.IntN(totalWeight) + 1
 
 	for _, asset := range assets {
-		logWeight := int(math.Log(float64(asset.Weight) + 1))
-		if randomWeight <= logWeight {
+		weight := pickWeight(asset)
+		if randomWeight <= weight {
 			return asset.Asset
 		}
-		randomWeight -= logWeight
+		randomWeight -= weight
 	}
 
 	// WeightedRandomItem sometimes returns an empty WeightedAsset
@@ -304,9 +324,12 @@ func PickRandomImageType(useWeighting bool, peopleAndAlbums []AssetWithWeighting
 	if useWeighting {
 		pickedImage = WeightedRandomItem(peopleAndAlbums)
 	} else {
+		// boosted assets are added once for each time they are boosted
 		var assetsOnly []WeightedAsset
 		for _, item := range peopleAndAlbums {
-			assetsOnly = append(assetsOnly, item.Asset)
+			for range item.boost() {
+				assetsOnly = append(assetsOnly, item.Asset)
+			}
 		}
 		pickedImage = RandomItem(assetsOnly)
 	}
@@ -371,37 +394,244 @@ func parseTimeString(timeStr string) (time.Time, error) {
 	return time.Date(0, 1, 1, hours, minutes, 0, 0, time.UTC), nil
 }
 
+// IsSleepTime reports whether currentTime is within the sleep window from sleepStartTime to sleepEndTime.
 func IsSleepTime(sleepStartTime, sleepEndTime string, currentTime time.Time) (bool, error) {
-	// Parse start and end times
-	startTime, err := parseTimeString(sleepStartTime)
+	sleepTime, err := InTimeWindow(sleepStartTime, sleepEndTime, nil, currentTime)
 	if err != nil {
-		log.Error("parsing sleep start time:", err)
+		log.Error("parsing sleep time:", err)
 		return false, err
 	}
 
-	endTime, err := parseTimeString(sleepEndTime)
+	return sleepTime, nil
+}
+
+// weekdayNames maps the names and abbreviations of the days of the week to their weekday.
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseWeekdays parses a list of days of the week. Days can be names ("monday"), abbreviations ("mon"),
+// ranges ("mon-fri", "fri-mon"), "weekdays" or "weekends". The weekdays are returned sorted without duplicates.
+func ParseWeekdays(days []string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+
+	for _, day := range days {
+		day = strings.ToLower(strings.TrimSpace(day))
+
+		switch day {
+		case "weekdays":
+			weekdays = append(weekdays, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+			continue
+		case "weekends":
+			weekdays = append(weekdays, time.Saturday, time.Sunday)
+			continue
+		}
+
+		from, to, isRange := strings.Cut(day, "-")
+
+		first, ok := weekdayNames[strings.TrimSpace(from)]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday: %s", day)
+		}
+
+		if !isRange {
+			weekdays = append(weekdays, first)
+			continue
+		}
+
+		last, ok := weekdayNames[strings.TrimSpace(to)]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday range: %s", day)
+		}
+
+		// ranges can wrap around the end of the week
+		for d := first; ; d = (d + 1) % 7 {
+			weekdays = append(weekdays, d)
+			if d == last {
+				break
+			}
+		}
+	}
+
+	slices.Sort(weekdays)
+
+	return slices.Compact(weekdays), nil
+}
+
+// ValidTimeWindow returns an error if start or end is not a valid time of day.
+func ValidTimeWindow(start, end string) error {
+	_, _, err := timeWindowAt(start, end, time.Now())
+	return err
+}
+
+// InTimeWindow reports whether currentTime is within the daily window from start to end.
+// A window that ends before it starts crosses midnight. When days is not empty the window
+// only opens on those days, and a window crossing midnight belongs to the day it opens on.
+func InTimeWindow(start, end string, days []time.Weekday, currentTime time.Time) (bool, error) {
+	opens, closes, err := timeWindowAt(start, end, currentTime)
 	if err != nil {
-		log.Error("parsing sleep end time:", err)
 		return false, err
 	}
 
-	// Set the date of startTime and endTime to the same as currentTime
+	if currentTime.Before(opens) || !currentTime.Before(closes) {
+		return false, nil
+	}
+
+	return len(days) == 0 || slices.Contains(days, opens.Weekday()), nil
+}
+
+// timeWindowAt returns when the daily window from start to end last opened at or before currentTime,
+// and when that window closes. The times are built from the calendar date so they stay correct on
+// days when daylight saving time starts or ends.
+func timeWindowAt(start, end string, currentTime time.Time) (time.Time, time.Time, error) {
+	startTime, err := parseTimeString(start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start time: %w", err)
+	}
+
+	endTime, err := parseTimeString(end)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end time: %w", err)
+	}
+
 	year, month, day := currentTime.Date()
-	startTime = time.Date(year, month, day, startTime.Hour(), startTime.Minute(), 0, 0, currentTime.Location())
-	endTime = time.Date(year, month, day, endTime.Hour(), endTime.Minute(), 0, 0, currentTime.Location())
+	loc := currentTime.Location()
+
+	opens := time.Date(year, month, day, startTime.Hour(), startTime.Minute(), 0, 0, loc)
+	if currentTime.Before(opens) {
+		day--
+		opens = time.Date(year, month, day, startTime.Hour(), startTime.Minute(), 0, 0, loc)
+	}
 
 	// If end time is before start time, it means the period crosses midnight
 	if endTime.Before(startTime) {
-		endTime = endTime.Add(24 * time.Hour)
+		day++
+	}
+
+	closes := time.Date(year, month, day, endTime.Hour(), endTime.Minute(), 0, 0, loc)
+
+	return opens, closes, nil
+}
+
+// dateRangeSeparator separates the start and end of a date range e.g. 2019-01-01_2019-12-31
+const dateRangeSeparator = "_"
+
+// DateRange a range of days in the local time zone.
+type DateRange struct {
+	// From the start of the first day
+	From time.Time
+	// To the start of the day after the last day
+	To time.Time
+}
+
+// ParseDateRange parses a date range in the format YYYY-MM-DD_YYYY-MM-DD.
+// Both dates are inclusive, so To is the start of the day after the end date.
+// If the end date is before the start date the dates are swapped.
+func ParseDateRange(dateRange string) (DateRange, error) {
+	start, end, found := strings.Cut(strings.TrimSpace(dateRange), dateRangeSeparator)
+	if !found {
+		return DateRange{}, fmt.Errorf("invalid date range %q: expected YYYY-MM-DD_YYYY-MM-DD", dateRange)
+	}
+
+	startDate, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(start), time.Local)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("invalid date range start %q: %w", start, err)
+	}
+
+	endDate, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(end), time.Local)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("invalid date range end %q: %w", end, err)
+	}
+
+	if endDate.Before(startDate) {
+		startDate, endDate = endDate, startDate
+	}
+
+	return DateRange{From: startDate, To: endDate.AddDate(0, 0, 1)}, nil
+}
+
+// Contains reports whether the calendar date of t, in its own location, is within the range.
+func (r DateRange) Contains(t time.Time) bool {
+	year, month, day := t.Date()
+	date := time.Date(year, month, day, 0, 0, 0, 0, r.From.Location())
+
+	return !date.Before(r.From) && date.Before(r.To)
+}
+
+// SleepWindow a daily window of time to sleep during.
+type SleepWindow struct {
+	// Start when the window opens
+	Start string
+	// End when the window closes. An end before the start crosses midnight
+	End string
+	// Days the window opens on. Empty opens every day
+	Days []time.Weekday
+	// Except dates the window does not open on, e.g. holidays
+	Except []DateRange
+}
+
+// maxSleep how far ahead SleepState looks for the end of joined windows, so windows
+// covering every hour of the week can not loop forever.
+const maxSleep = 8 * 24 * time.Hour
+
+// openAt reports whether the window is open at t and when it closes.
+// Windows with an invalid start or end are never open.
+func (w SleepWindow) openAt(t time.Time) (bool, time.Time) {
+	opens, closes, err := timeWindowAt(w.Start, w.End, t)
+	if err != nil || t.Before(opens) || !t.Before(closes) {
+		return false, time.Time{}
+	}
+
+	if len(w.Days) > 0 && !slices.Contains(w.Days, opens.Weekday()) {
+		return false, time.Time{}
+	}
+
+	if slices.ContainsFunc(w.Except, func(r DateRange) bool { return r.Contains(opens) }) {
+		return false, time.Time{}
+	}
+
+	return true, closes
+}
+
+// SleepState reports whether any of the windows is open at now and, if so, when sleep ends.
+// Windows that overlap or follow on from each other are joined, so sleep ends at the first
+// time after now that none of the windows is open. The wake time is zero when sleep does not end within a week.
+func SleepState(windows []SleepWindow, now time.Time) (bool, time.Time) {
+	asleep := false
+	wakesAt := now
+
+	for wakesAt.Sub(now) < maxSleep {
+		extended := false
+
+		for _, w := range windows {
+			if open, closes := w.openAt(wakesAt); open {
+				wakesAt = closes
+				extended = true
+			}
+		}
+
+		if !extended {
+			break
+		}
+
+		asleep = true
+	}
+
+	if !asleep {
+		return false, time.Time{}
 	}
 
-	// Check if current time is between start and end times
-	if currentTime.Before(startTime) {
-		currentTime = currentTime.Add(24 * time.Hour)
+	if wakesAt.Sub(now) >= maxSleep {
+		return true, time.Time{}
 	}
 
-	return (currentTime.After(startTime) || currentTime.Equal(startTime)) &&
-		currentTime.Before(endTime), nil
+	return true, wakesAt
 }
 
 func FileExists(filename string) bool {
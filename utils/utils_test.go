@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -341,6 +342,286 @@ func TestIsSleepTime(t *testing.T) {
 	}
 }
 
+func TestInTimeWindow(t *testing.T) {
+	// 2023-01-06 is a Friday
+	friday := func(hour, minute int) time.Time { return time.Date(2023, 1, 6, hour, minute, 0, 0, time.UTC) }
+	weekend := []time.Weekday{time.Saturday, time.Sunday}
+
+	tests := []struct {
+		name        string
+		start       string
+		end         string
+		days        []time.Weekday
+		currentTime time.Time
+		want        bool
+	}{
+		{name: "any day", start: "9", end: "17", currentTime: friday(12, 0), want: true},
+		{name: "end is exclusive", start: "9", end: "17", currentTime: friday(17, 0), want: false},
+		{name: "wrong day", start: "9", end: "17", days: weekend, currentTime: friday(12, 0), want: false},
+		{name: "right day", start: "9", end: "17", days: weekend, currentTime: friday(12, 0).AddDate(0, 0, 1), want: true},
+		{name: "opened on friday before midnight", start: "2200", end: "0200", days: []time.Weekday{time.Friday}, currentTime: friday(23, 0), want: true},
+		{name: "opened on friday after midnight", start: "2200", end: "0200", days: []time.Weekday{time.Friday}, currentTime: friday(1, 0).AddDate(0, 0, 1), want: true},
+		{name: "opened on thursday after midnight", start: "2200", end: "0200", days: []time.Weekday{time.Friday}, currentTime: friday(1, 0), want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := InTimeWindow(test.start, test.end, test.days, test.currentTime)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err := InTimeWindow("25", "7", nil, friday(12, 0))
+	assert.Error(t, err)
+}
+
+func TestSleepState(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-03-01 is a Friday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	holidays, err := ParseDateRange("2024-12-26_2024-12-24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nightly := SleepWindow{Start: "22", End: "7"}
+
+	tests := []struct {
+		name        string
+		windows     []SleepWindow
+		now         time.Time
+		wantAsleep  bool
+		wantWakesAt time.Time
+	}{
+		{
+			name: "no windows",
+			now:  at(time.March, 1, 23, 0),
+		},
+		{
+			name:        "before midnight",
+			windows:     []SleepWindow{nightly},
+			now:         at(time.March, 1, 23, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 7, 0),
+		},
+		{
+			name:        "after midnight",
+			windows:     []SleepWindow{nightly},
+			now:         at(time.March, 2, 6, 59),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 7, 0),
+		},
+		{
+			name:    "awake",
+			windows: []SleepWindow{nightly},
+			now:     at(time.March, 2, 7, 0),
+		},
+		{
+			name:        "window opened on a listed day",
+			windows:     []SleepWindow{{Start: "22", End: "7", Days: []time.Weekday{time.Friday}}},
+			now:         at(time.March, 2, 3, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 7, 0),
+		},
+		{
+			name:    "window opened on another day",
+			windows: []SleepWindow{{Start: "22", End: "7", Days: []time.Weekday{time.Friday}}},
+			now:     at(time.March, 1, 3, 0),
+		},
+		{
+			name: "weekend lie in",
+			windows: []SleepWindow{
+				{Start: "22", End: "7", Days: []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday}},
+				{Start: "22", End: "9", Days: []time.Weekday{time.Friday, time.Saturday}},
+			},
+			now:         at(time.March, 2, 8, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 9, 0),
+		},
+		{
+			name:        "overlapping windows are joined",
+			windows:     []SleepWindow{{Start: "1", End: "7"}, {Start: "22", End: "2"}},
+			now:         at(time.March, 1, 23, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 7, 0),
+		},
+		{
+			name:        "adjacent windows are joined",
+			windows:     []SleepWindow{{Start: "22", End: "0"}, {Start: "0", End: "7"}},
+			now:         at(time.March, 1, 23, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 2, 7, 0),
+		},
+		{
+			name:        "separate windows",
+			windows:     []SleepWindow{nightly, {Start: "12", End: "13"}},
+			now:         at(time.March, 1, 12, 30),
+			wantAsleep:  true,
+			wantWakesAt: at(time.March, 1, 13, 0),
+		},
+		{
+			name:       "always asleep",
+			windows:    []SleepWindow{{Start: "0", End: "12"}, {Start: "12", End: "0"}},
+			now:        at(time.March, 1, 12, 30),
+			wantAsleep: true,
+		},
+		{
+			name:    "invalid window",
+			windows: []SleepWindow{{Start: "25", End: "7"}},
+			now:     at(time.March, 1, 23, 0),
+		},
+		{
+			name:    "holiday evening",
+			windows: []SleepWindow{{Start: "22", End: "7", Except: []DateRange{holidays}}},
+			now:     at(time.December, 24, 23, 0),
+		},
+		{
+			name:    "holiday morning",
+			windows: []SleepWindow{{Start: "22", End: "7", Except: []DateRange{holidays}}},
+			now:     at(time.December, 27, 3, 0),
+		},
+		{
+			name:        "after the holidays",
+			windows:     []SleepWindow{{Start: "22", End: "7", Except: []DateRange{holidays}}},
+			now:         at(time.December, 27, 23, 0),
+			wantAsleep:  true,
+			wantWakesAt: at(time.December, 28, 7, 0),
+		},
+		{
+			name:        "day the clocks go forward",
+			windows:     []SleepWindow{nightly},
+			now:         time.Date(2024, time.March, 31, 6, 30, 0, 0, london),
+			wantAsleep:  true,
+			wantWakesAt: time.Date(2024, time.March, 31, 7, 0, 0, 0, london),
+		},
+		{
+			name:        "window opening in the hour the clocks skip",
+			windows:     []SleepWindow{{Start: "0130", End: "4"}},
+			now:         time.Date(2024, time.March, 31, 2, 45, 0, 0, london),
+			wantAsleep:  true,
+			wantWakesAt: time.Date(2024, time.March, 31, 4, 0, 0, 0, london),
+		},
+		{
+			name:        "day the clocks go back",
+			windows:     []SleepWindow{nightly},
+			now:         time.Date(2024, time.October, 27, 6, 30, 0, 0, london),
+			wantAsleep:  true,
+			wantWakesAt: time.Date(2024, time.October, 27, 7, 0, 0, 0, london),
+		},
+		{
+			name:    "awake the day the clocks go back",
+			windows: []SleepWindow{nightly},
+			now:     time.Date(2024, time.October, 27, 7, 0, 0, 0, london),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asleep, wakesAt := SleepState(test.windows, test.now)
+			assert.Equal(t, test.wantAsleep, asleep)
+			assert.True(t, test.wantWakesAt.Equal(wakesAt), "wakes at %s, want %s", wakesAt, test.wantWakesAt)
+		})
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		dateRange string
+		wantFrom  string
+		wantTo    string
+		wantErr   bool
+	}{
+		{
+			name:      "Full year",
+			dateRange: "2019-01-01_2019-12-31",
+			wantFrom:  "2019-01-01",
+			wantTo:    "2020-01-01",
+		},
+		{
+			name:      "Single day",
+			dateRange: "2020-02-29_2020-02-29",
+			wantFrom:  "2020-02-29",
+			wantTo:    "2020-03-01",
+		},
+		{
+			name:      "Reversed dates",
+			dateRange: " 2019-12-31_2019-01-01 ",
+			wantFrom:  "2019-01-01",
+			wantTo:    "2020-01-01",
+		},
+		{
+			name:      "Missing separator",
+			dateRange: "2019-01-01",
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid date",
+			dateRange: "2019-13-01_2019-12-31",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dateRange, err := ParseDateRange(tt.dateRange)
+			if tt.wantErr {
+				assert.Error(t, err, "Expected an error")
+				return
+			}
+
+			assert.NoError(t, err, "Unexpected error")
+			assert.Equal(t, tt.wantFrom, dateRange.From.Format(time.DateOnly), "Unexpected range start")
+			assert.Equal(t, tt.wantTo, dateRange.To.Format(time.DateOnly), "Unexpected range end")
+		})
+	}
+}
+
+func TestDateRangeContains(t *testing.T) {
+	r, err := ParseDateRange("2024-12-24_2024-12-24")
+	assert.NoError(t, err)
+	assert.True(t, r.Contains(time.Date(2024, 12, 24, 23, 59, 0, 0, time.Local)))
+	assert.False(t, r.Contains(time.Date(2024, 12, 25, 0, 0, 0, 0, time.Local)))
+
+	// the calendar date is taken in the location of the time
+	tokyo := time.FixedZone("JST", 9*60*60)
+	assert.True(t, r.Contains(time.Date(2024, 12, 24, 1, 0, 0, 0, tokyo)))
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		days    []string
+		want    []time.Weekday
+		wantErr bool
+	}{
+		{days: nil, want: nil},
+		{days: []string{"Mon", "wednesday"}, want: []time.Weekday{time.Monday, time.Wednesday}},
+		{days: []string{"mon-fri"}, want: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{days: []string{"fri-mon"}, want: []time.Weekday{time.Sunday, time.Monday, time.Friday, time.Saturday}},
+		{days: []string{"weekends", "sun"}, want: []time.Weekday{time.Sunday, time.Saturday}},
+		{days: []string{"funday"}, wantErr: true},
+		{days: []string{"mon-someday"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseWeekdays(test.days)
+		if test.wantErr {
+			assert.Error(t, err, test.days)
+			continue
+		}
+		assert.NoError(t, err, test.days)
+		assert.Equal(t, test.want, got, test.days)
+	}
+}
+
 func TestParseTimeString(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -386,3 +667,24 @@ func TestParseTimeString(t *testing.T) {
 		}
 	}
 }
+
+// TestBoostedPicks tests boosted assets are picked more often, with and without weighting.
+func TestBoostedPicks(t *testing.T) {
+	assets := []AssetWithWeighting{
+		{Asset: WeightedAsset{ID: "plain"}, Weight: 100},
+		{Asset: WeightedAsset{ID: "boosted"}, Weight: 100, Boost: 4},
+	}
+
+	assert.Equal(t, 4*calculateTotalWeight(assets[:1]), calculateTotalWeight(assets[1:]), "Boost should multiply the weight")
+
+	for _, useWeighting := range []bool{true, false} {
+		counts := make(map[string]int)
+		iterations := 20000
+
+		for i := 0; i < iterations; i++ {
+			counts[PickRandomImageType(useWeighting, assets).ID]++
+		}
+
+		assert.InDelta(t, 0.8, float64(counts["boosted"])/float64(iterations), 0.05, "Boosted asset should be picked 4 times as often (weighting %v)", useWeighting)
+	}
+}
@@ -15,9 +15,9 @@ import (
 type ImageData struct {
 	// ImmichImage immich asset data
 	ImmichImage immich.ImmichAsset
-	// ImageData image as base64 data
+	// ImageData image as base64 data or a signed asset url
 	ImageData string
-	// ImageData blurred image as base64 data
+	// ImageBlurData blurred image as base64 data or a signed asset url
 	ImageBlurData string
 	// Date image date
 	ImageDate string
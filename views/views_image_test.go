@@ -0,0 +1,101 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/immich"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowLivePhoto(t *testing.T) {
+	livePhoto := ImageData{ImmichImage: immich.ImmichAsset{ID: "asset-1", LivePhotoVideoID: "clip-1"}}
+	stillPhoto := ImageData{ImmichImage: immich.ImmichAsset{ID: "asset-2"}}
+
+	tests := []struct {
+		name        string
+		livePhotos  string
+		imageEffect string
+		imageData   ImageData
+		want        bool
+	}{
+		{name: "default", livePhotos: "", imageData: livePhoto, want: false},
+		{name: "none", livePhotos: "none", imageData: livePhoto, want: false},
+		{name: "once", livePhotos: "once", imageData: livePhoto, want: true},
+		{name: "loop", livePhotos: "loop", imageData: livePhoto, want: true},
+		{name: "unknown mode", livePhotos: "always", imageData: livePhoto, want: false},
+		{name: "no motion clip", livePhotos: "loop", imageData: stillPhoto, want: false},
+		{name: "zoom", livePhotos: "loop", imageEffect: "zoom", imageData: livePhoto, want: false},
+		{name: "smart zoom", livePhotos: "once", imageEffect: "smart-zoom", imageData: livePhoto, want: false},
+		{name: "other effect", livePhotos: "once", imageEffect: "blur", imageData: livePhoto, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viewData := ViewData{Config: config.Config{LivePhotos: tt.livePhotos, ImageEffect: tt.imageEffect}}
+			assert.Equal(t, tt.want, showLivePhoto(viewData, tt.imageData))
+		})
+	}
+}
+
+func TestVideoURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		account  string
+		videoID  string
+		want     string
+	}{
+		{name: "no queries", videoID: "clip-1", want: "/video/clip-1"},
+		{name: "password", password: "secret", videoID: "clip-1", want: "/video/clip-1?password=secret"},
+		{name: "account", account: "partner", videoID: "clip-1", want: "/video/clip-1?account=partner"},
+		{name: "password and account", password: "secret", account: "partner", videoID: "clip-1", want: "/video/clip-1?account=partner&password=secret"},
+		{name: "password is escaped", password: "a&b=c d#", videoID: "clip-1", want: "/video/clip-1?password=a%26b%3Dc+d%23"},
+		{name: "video ID is escaped", videoID: "../clip?1", want: "/video/..%2Fclip%3F1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.Config{Account: tt.account}
+			c.Kiosk.Password = tt.password
+
+			assert.Equal(t, tt.want, videoURL(ViewData{Config: c}, tt.videoID))
+		})
+	}
+}
+
+func TestRenderLivePhoto(t *testing.T) {
+	tests := []struct {
+		name       string
+		livePhotos string
+		wantLoop   bool
+	}{
+		{name: "once", livePhotos: "once", wantLoop: false},
+		{name: "loop", livePhotos: "loop", wantLoop: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.Config{LivePhotos: tt.livePhotos}
+			c.Kiosk.Password = `pass"word&`
+
+			imageData := ImageData{ImmichImage: immich.ImmichAsset{ID: "asset-1", LivePhotoVideoID: "clip-1"}}
+
+			var buf bytes.Buffer
+			assert.NoError(t, renderLivePhoto(ViewData{Config: c}, imageData).Render(context.Background(), &buf))
+
+			html := buf.String()
+			assert.Contains(t, html, `src="/video/clip-1?password=pass%22word%26"`, "The password should be query escaped in the src attribute")
+			assert.NotContains(t, html, `pass"word&`, "The raw password should never be rendered")
+			assert.Contains(t, html, "muted", "Live photos should be muted so they can autoplay")
+
+			if tt.wantLoop {
+				assert.Contains(t, html, " loop")
+			} else {
+				assert.NotContains(t, html, " loop")
+			}
+		})
+	}
+}
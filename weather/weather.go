@@ -2,16 +2,24 @@ package weather
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/damongolding/immich-kiosk/config"
+	"github.com/damongolding/immich-kiosk/metrics"
+)
+
+const (
+	// refreshInterval time between weather refreshes
+	refreshInterval = 10 * time.Minute
+	// StaleAfter time without a successful refresh before the weather of a location is stale.
+	// This allows for a couple of failed refreshes
+	StaleAfter = 3 * refreshInterval
 )
 
 var weatherDataStore sync.Map
@@ -23,6 +31,16 @@ type WeatherLocation struct {
 	API  string
 	Unit string
 	Lang string
+	// Provider where the weather comes from, one of the config.WeatherProvider names
+	Provider string
+	// URL endpoint of the json provider
+	URL string
+	// ForecastLength number of days, or hours with ForecastHourly, in the forecast. 0 skips the forecast
+	ForecastLength int
+	// ForecastHourly fetch an hourly forecast instead of a daily one
+	ForecastHourly bool
+	// Updated time of the last successful refresh. Zero if the weather has never been refreshed
+	Updated time.Time
 	Weather
 }
 
@@ -40,6 +58,22 @@ type Weather struct {
 	ID         int           `json:"id"`
 	Name       string        `json:"name"`
 	Cod        int           `json:"cod"`
+	// Forecast the days or hours ahead, fetched separately from the current weather
+	Forecast []Forecast `json:"-"`
+}
+
+// NoPrecipitationChance the chance of precipitation of a forecast from a provider that does not give one
+const NoPrecipitationChance = -1
+
+// Forecast the weather expected for a day, or for an hour of an hourly forecast
+type Forecast struct {
+	Time time.Time
+	Data WeatherData
+	// High and Low the highest and lowest temperature. In an hourly forecast both are the temperature of the hour
+	High float64
+	Low  float64
+	// PrecipitationChance percent chance of precipitation, or NoPrecipitationChance
+	PrecipitationChance int
 }
 
 type Coord struct {
@@ -85,7 +119,7 @@ type Sys struct {
 
 func AddWeatherLocation(ctx context.Context, location config.WeatherLocation) {
 
-	ticker := time.NewTicker(time.Minute * 10)
+	ticker := time.NewTicker(refreshInterval)
 	defer ticker.Stop()
 
 	w := &WeatherLocation{
@@ -95,15 +129,22 @@ func AddWeatherLocation(ctx context.Context, location config.WeatherLocation) {
 		API:  location.API,
 		Unit: location.Unit,
 		Lang: location.Lang,
+
+		Provider: location.Provider,
+		URL:      location.URL,
+
+		ForecastLength: location.ForecastLength,
+		ForecastHourly: location.ForecastHourly,
 	}
 
 	weatherDataStore.Store(w.Name, *w)
 
 	// Run once immediately
 	log.Debug("Getting initial weather for", "name", w.Name)
-	newWeather, err := w.updateWeather()
+	newWeather, err := w.updateWeather(ctx)
 	if err != nil {
 		log.Error("Failed to update initial weather", "name", w.Name, "error", err)
+		metrics.WeatherRefreshFailures.WithLabelValues(w.Name).Inc()
 	} else {
 		weatherDataStore.Store(w.Name, newWeather)
 		log.Debug("Retrieved initial weather for", "name", w.Name)
@@ -116,9 +157,10 @@ func AddWeatherLocation(ctx context.Context, location config.WeatherLocation) {
 			return
 		case <-ticker.C:
 			log.Debug("Getting weather for", "name", w.Name)
-			newWeather, err := w.updateWeather()
+			newWeather, err := w.updateWeather(ctx)
 			if err != nil {
 				log.Error("Failed to update weather", "name", w.Name, "error", err)
+				metrics.WeatherRefreshFailures.WithLabelValues(w.Name).Inc()
 				continue
 			}
 			weatherDataStore.Store(w.Name, newWeather)
@@ -127,6 +169,25 @@ func AddWeatherLocation(ctx context.Context, location config.WeatherLocation) {
 	}
 }
 
+// StaleLocations returns the locations whose weather has not been refreshed within StaleAfter, sorted by name.
+func StaleLocations(now time.Time) []WeatherLocation {
+	var stale []WeatherLocation
+
+	weatherDataStore.Range(func(_, value any) bool {
+		location := value.(WeatherLocation)
+		if now.Sub(location.Updated) > StaleAfter {
+			stale = append(stale, location)
+		}
+		return true
+	})
+
+	slices.SortFunc(stale, func(a, b WeatherLocation) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return stale
+}
+
 func CurrentWeather(name string) WeatherLocation {
 	value, ok := weatherDataStore.Load(name)
 	if !ok {
@@ -135,61 +196,25 @@ func CurrentWeather(name string) WeatherLocation {
 	return value.(WeatherLocation)
 }
 
-func (w *WeatherLocation) updateWeather() (WeatherLocation, error) {
+// updateWeather fetches the weather of the location from its provider.
+func (w *WeatherLocation) updateWeather(ctx context.Context) (WeatherLocation, error) {
 
-	apiUrl := url.URL{
-		Scheme:   "https",
-		Host:     "api.openweathermap.org",
-		Path:     "data/2.5/weather",
-		RawQuery: fmt.Sprintf("appid=%s&lat=%s&lon=%s&units=%s&lang=%s", w.API, w.Lat, w.Lon, w.Unit, w.Lang),
+	provider, ok := providers[w.Provider]
+	if !ok {
+		return *w, fmt.Errorf("unknown weather provider: %q", w.Provider)
 	}
 
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
-	req, err := http.NewRequest("GET", apiUrl.String(), nil)
-	if err != nil {
-		log.Error(err)
-		return *w, err
-	}
-
-	req.Header.Add("Accept", "application/json")
 
-	var res *http.Response
-	for attempts := 0; attempts < 3; attempts++ {
-		res, err = client.Do(req)
-		if err == nil {
-			break
-		}
-		log.Error("Request failed, retrying", "attempt", attempts, "URL", apiUrl, "err", err)
-		time.Sleep(time.Duration(attempts) * time.Second)
-	}
+	newWeather, err := provider.Fetch(ctx, client, *w)
 	if err != nil {
-		log.Error("Request failed after retries", "err", err)
-		return *w, err
-	}
-
-	defer res.Body.Close()
-
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Error(err)
 		return *w, err
 	}
 
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Error("reading response body", "url", apiUrl, "err", err)
-		return *w, err
-	}
-
-	var newWeather Weather
-
-	if err := json.Unmarshal(responseBody, &newWeather); err != nil {
-		log.Error(err)
-	}
-
 	w.Weather = newWeather
+	w.Updated = time.Now()
 
 	return *w, nil
 }
@@ -0,0 +1,56 @@
+package weather
+
+import (
+	"time"
+)
+
+// forecastFor returns the forecast of the location from a forecast in hours, combined
+// into days in loc unless the location has an hourly forecast.
+func forecastFor(location WeatherLocation, hours []Forecast, loc *time.Location) []Forecast {
+	forecast := hours
+	if !location.ForecastHourly {
+		forecast = dailyForecast(hours, loc)
+	}
+
+	if len(forecast) > location.ForecastLength {
+		forecast = forecast[:location.ForecastLength]
+	}
+
+	return forecast
+}
+
+// dailyForecast combines a forecast in hours, in time order, into days in loc. Each day has the
+// highest and lowest temperature and chance of precipitation of its hours, and the conditions
+// of the hour nearest midday.
+func dailyForecast(hours []Forecast, loc *time.Location) []Forecast {
+	var days []Forecast
+	// fromMidday how far the conditions of each day are from midday
+	var fromMidday []time.Duration
+
+	for _, hour := range hours {
+		local := hour.Time.In(loc)
+		year, month, day := local.Date()
+		date := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+		distance := local.Sub(date.Add(12 * time.Hour)).Abs()
+
+		last := len(days) - 1
+		if last < 0 || !days[last].Time.Equal(date) {
+			hour.Time = date
+			days = append(days, hour)
+			fromMidday = append(fromMidday, distance)
+			continue
+		}
+
+		days[last].High = max(days[last].High, hour.High)
+		days[last].Low = min(days[last].Low, hour.Low)
+		days[last].PrecipitationChance = max(days[last].PrecipitationChance, hour.PrecipitationChance)
+
+		if distance < fromMidday[last] {
+			days[last].Data = hour.Data
+			fromMidday[last] = distance
+		}
+	}
+
+	return days
+}
@@ -0,0 +1,824 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/damongolding/immich-kiosk/config"
+)
+
+const (
+	// providerAttempts times a request to a provider is sent before giving up
+	providerAttempts = 3
+	// metNoUserAgent Met.no turns away requests that do not identify the app
+	metNoUserAgent = "immich-kiosk github.com/damongolding/immich-kiosk"
+)
+
+// Provider fetches the current weather of a location from a weather service.
+//
+// Providers convert the weather into the OpenWeatherMap shape, with OpenWeatherMap
+// condition codes, so the views work the same whichever provider is used.
+type Provider interface {
+	Fetch(ctx context.Context, client *http.Client, location WeatherLocation) (Weather, error)
+}
+
+// providers the weather providers by name
+var providers = map[string]Provider{
+	config.WeatherProviderOpenWeatherMap: openWeatherMap{baseURL: "https://api.openweathermap.org"},
+	config.WeatherProviderOpenMeteo:      openMeteo{baseURL: "https://api.open-meteo.com"},
+	config.WeatherProviderMetNo:          metNo{baseURL: "https://api.met.no"},
+	config.WeatherProviderJSON:           jsonProvider{},
+}
+
+// getJSON requests apiUrl and decodes the json response into v. Requests that fail
+// before a response is received are retried.
+func getJSON(ctx context.Context, client *http.Client, apiUrl string, header http.Header, v any) error {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Accept", "application/json")
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	var res *http.Response
+	for attempts := 0; attempts < providerAttempts; attempts++ {
+		res, err = client.Do(req)
+		if err == nil {
+			break
+		}
+		log.Error("Request failed, retrying", "attempt", attempts, "URL", apiUrl, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempts) * time.Second):
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("request failed after retries: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	return json.Unmarshal(responseBody, v)
+}
+
+// convertTemp converts a temperature in celsius to the unit of the location.
+// Like OpenWeatherMap, standard (or no unit) is kelvin.
+func convertTemp(celsius float64, unit string) float64 {
+	switch unit {
+	case "metric":
+		return celsius
+	case "imperial":
+		return celsius*9/5 + 32
+	default:
+		return celsius + 273.15
+	}
+}
+
+// convertSpeed converts a speed in metres per second to the unit of the location.
+func convertSpeed(metresPerSecond float64, unit string) float64 {
+	if unit == "imperial" {
+		return metresPerSecond * 2.23694
+	}
+	return metresPerSecond
+}
+
+// conditionGroup returns the OpenWeatherMap group of a condition code, e.g. Rain or Clouds.
+func conditionGroup(id int) string {
+	switch {
+	case id >= 200 && id < 300:
+		return "Thunderstorm"
+	case id >= 300 && id < 400:
+		return "Drizzle"
+	case id >= 500 && id < 600:
+		return "Rain"
+	case id >= 600 && id < 700:
+		return "Snow"
+	case id == 741:
+		return "Fog"
+	case id == 771:
+		return "Squall"
+	case id == 781:
+		return "Tornado"
+	case id >= 700 && id < 800:
+		return "Mist"
+	case id == 800:
+		return "Clear"
+	default:
+		return "Clouds"
+	}
+}
+
+// condition returns the weather data of an OpenWeatherMap condition code.
+func condition(id int, description string) WeatherData {
+	return WeatherData{
+		ID:          id,
+		Main:        conditionGroup(id),
+		Description: description,
+	}
+}
+
+// openWeatherMap the OpenWeatherMap current weather api. Needs an API key.
+type openWeatherMap struct {
+	baseURL string
+}
+
+func (p openWeatherMap) Fetch(ctx context.Context, client *http.Client, location WeatherLocation) (Weather, error) {
+
+	apiUrl, err := url.Parse(p.baseURL)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	apiUrl.Path = "data/2.5/weather"
+	apiUrl.RawQuery = url.Values{
+		"appid": {location.API},
+		"lat":   {location.Lat},
+		"lon":   {location.Lon},
+		"units": {location.Unit},
+		"lang":  {location.Lang},
+	}.Encode()
+
+	var weather Weather
+	if err := getJSON(ctx, client, apiUrl.String(), nil, &weather); err != nil {
+		return weather, err
+	}
+
+	// the current weather is still shown when the forecast can not be fetched
+	if location.ForecastLength > 0 {
+		weather.Forecast, err = p.forecast(ctx, client, location)
+		if err != nil {
+			log.Error("Failed to get forecast", "name", location.Name, "err", err)
+		}
+	}
+
+	return weather, nil
+}
+
+type openWeatherMapForecast struct {
+	List []struct {
+		Dt   int64         `json:"dt"`
+		Main Main          `json:"main"`
+		Data []WeatherData `json:"weather"`
+		// Pop probability of precipitation from 0 to 1
+		Pop float64 `json:"pop"`
+	} `json:"list"`
+}
+
+// forecast fetches the forecast in 3 hour steps, the finest the OpenWeatherMap free plan offers.
+func (p openWeatherMap) forecast(ctx context.Context, client *http.Client, location WeatherLocation) ([]Forecast, error) {
+
+	apiUrl, err := url.Parse(p.baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	apiUrl.Path = "data/2.5/forecast"
+	apiUrl.RawQuery = url.Values{
+		"appid": {location.API},
+		"lat":   {location.Lat},
+		"lon":   {location.Lon},
+		"units": {location.Unit},
+		"lang":  {location.Lang},
+	}.Encode()
+
+	var res openWeatherMapForecast
+	if err := getJSON(ctx, client, apiUrl.String(), nil, &res); err != nil {
+		return nil, err
+	}
+
+	hours := make([]Forecast, 0, len(res.List))
+	for _, step := range res.List {
+		if len(step.Data) == 0 {
+			continue
+		}
+		hours = append(hours, Forecast{
+			Time:                time.Unix(step.Dt, 0),
+			Data:                step.Data[0],
+			High:                step.Main.TempMax,
+			Low:                 step.Main.TempMin,
+			PrecipitationChance: int(math.Round(step.Pop * 100)),
+		})
+	}
+
+	return forecastFor(location, hours, time.Local), nil
+}
+
+// openMeteo the Open-Meteo forecast api. No API key is needed.
+type openMeteo struct {
+	baseURL string
+}
+
+type openMeteoCurrent struct {
+	Time                int64   `json:"time"`
+	Temperature         float64 `json:"temperature_2m"`
+	ApparentTemperature float64 `json:"apparent_temperature"`
+	Humidity            int     `json:"relative_humidity_2m"`
+	WeatherCode         int     `json:"weather_code"`
+	WindSpeed           float64 `json:"wind_speed_10m"`
+	WindDirection       int     `json:"wind_direction_10m"`
+	Pressure            float64 `json:"pressure_msl"`
+}
+
+type openMeteoDaily struct {
+	Time                     []int64   `json:"time"`
+	Sunrise                  []int64   `json:"sunrise"`
+	Sunset                   []int64   `json:"sunset"`
+	WeatherCode              []int     `json:"weather_code"`
+	TemperatureMax           []float64 `json:"temperature_2m_max"`
+	TemperatureMin           []float64 `json:"temperature_2m_min"`
+	PrecipitationProbability []*int    `json:"precipitation_probability_max"`
+}
+
+type openMeteoHourly struct {
+	Time                     []int64   `json:"time"`
+	Temperature              []float64 `json:"temperature_2m"`
+	WeatherCode              []int     `json:"weather_code"`
+	PrecipitationProbability []*int    `json:"precipitation_probability"`
+}
+
+type openMeteoResponse struct {
+	Current openMeteoCurrent `json:"current"`
+	Daily   openMeteoDaily   `json:"daily"`
+	Hourly  openMeteoHourly  `json:"hourly"`
+}
+
+// openMeteoChance returns the precipitation probability at index i, which Open-Meteo leaves null when it has none.
+func openMeteoChance(probabilities []*int, i int) int {
+	if i >= len(probabilities) || probabilities[i] == nil {
+		return NoPrecipitationChance
+	}
+	return *probabilities[i]
+}
+
+// forecast returns the forecast from the daily or hourly values of the response.
+// Values with unknown weather codes are skipped.
+func (res openMeteoResponse) forecast(location WeatherLocation) []Forecast {
+	var forecast []Forecast
+
+	if location.ForecastHourly {
+		hourly := res.Hourly
+		for i, t := range hourly.Time {
+			if i >= len(hourly.Temperature) || i >= len(hourly.WeatherCode) {
+				break
+			}
+			data, ok := wmoConditions[hourly.WeatherCode[i]]
+			if !ok {
+				continue
+			}
+			temp := convertTemp(hourly.Temperature[i], location.Unit)
+			forecast = append(forecast, Forecast{
+				Time:                time.Unix(t, 0),
+				Data:                data,
+				High:                temp,
+				Low:                 temp,
+				PrecipitationChance: openMeteoChance(hourly.PrecipitationProbability, i),
+			})
+		}
+	} else {
+		daily := res.Daily
+		for i, t := range daily.Time {
+			if i >= len(daily.WeatherCode) || i >= len(daily.TemperatureMax) || i >= len(daily.TemperatureMin) {
+				break
+			}
+			data, ok := wmoConditions[daily.WeatherCode[i]]
+			if !ok {
+				continue
+			}
+			forecast = append(forecast, Forecast{
+				Time:                time.Unix(t, 0),
+				Data:                data,
+				High:                convertTemp(daily.TemperatureMax[i], location.Unit),
+				Low:                 convertTemp(daily.TemperatureMin[i], location.Unit),
+				PrecipitationChance: openMeteoChance(daily.PrecipitationProbability, i),
+			})
+		}
+	}
+
+	// the hourly values start with the current hour
+	forecast = slices.DeleteFunc(forecast, func(f Forecast) bool {
+		return location.ForecastHourly && f.Time.Unix() <= res.Current.Time
+	})
+
+	if len(forecast) > location.ForecastLength {
+		forecast = forecast[:location.ForecastLength]
+	}
+
+	return forecast
+}
+
+// wmoConditions OpenWeatherMap condition codes of the WMO weather codes used by Open-Meteo
+var wmoConditions = map[int]WeatherData{
+	0:  condition(800, "clear sky"),
+	1:  condition(801, "mainly clear"),
+	2:  condition(802, "partly cloudy"),
+	3:  condition(804, "overcast"),
+	45: condition(741, "fog"),
+	48: condition(741, "depositing rime fog"),
+	51: condition(300, "light drizzle"),
+	53: condition(301, "drizzle"),
+	55: condition(302, "dense drizzle"),
+	56: condition(311, "light freezing drizzle"),
+	57: condition(312, "dense freezing drizzle"),
+	61: condition(500, "light rain"),
+	63: condition(501, "rain"),
+	65: condition(502, "heavy rain"),
+	66: condition(511, "light freezing rain"),
+	67: condition(511, "heavy freezing rain"),
+	71: condition(600, "light snow"),
+	73: condition(601, "snow"),
+	75: condition(602, "heavy snow"),
+	77: condition(600, "snow grains"),
+	80: condition(520, "light rain showers"),
+	81: condition(521, "rain showers"),
+	82: condition(522, "violent rain showers"),
+	85: condition(620, "light snow showers"),
+	86: condition(622, "heavy snow showers"),
+	95: condition(211, "thunderstorm"),
+	96: condition(201, "thunderstorm with hail"),
+	99: condition(202, "thunderstorm with heavy hail"),
+}
+
+func (p openMeteo) Fetch(ctx context.Context, client *http.Client, location WeatherLocation) (Weather, error) {
+
+	apiUrl, err := url.Parse(p.baseURL)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	query := url.Values{
+		"latitude":        {location.Lat},
+		"longitude":       {location.Lon},
+		"current":         {"temperature_2m,apparent_temperature,relative_humidity_2m,weather_code,wind_speed_10m,wind_direction_10m,pressure_msl"},
+		"daily":           {"sunrise,sunset"},
+		"forecast_days":   {"1"},
+		"timezone":        {"auto"},
+		"timeformat":      {"unixtime"},
+		"wind_speed_unit": {"ms"},
+	}
+
+	switch {
+	case location.ForecastLength > 0 && location.ForecastHourly:
+		query.Set("hourly", "temperature_2m,weather_code,precipitation_probability")
+		// the hourly values start with the current hour, which is not part of the forecast
+		query.Set("forecast_hours", strconv.Itoa(location.ForecastLength+1))
+	case location.ForecastLength > 0:
+		query.Set("daily", "sunrise,sunset,weather_code,temperature_2m_max,temperature_2m_min,precipitation_probability_max")
+		query.Set("forecast_days", strconv.Itoa(location.ForecastLength))
+	}
+
+	apiUrl.Path = "v1/forecast"
+	apiUrl.RawQuery = query.Encode()
+
+	var res openMeteoResponse
+	if err := getJSON(ctx, client, apiUrl.String(), nil, &res); err != nil {
+		return Weather{}, err
+	}
+
+	current := res.Current
+
+	data, ok := wmoConditions[current.WeatherCode]
+	if !ok {
+		return Weather{}, fmt.Errorf("unknown weather code: %d", current.WeatherCode)
+	}
+
+	weather := Weather{
+		Data: []WeatherData{data},
+		Main: Main{
+			Temp:      convertTemp(current.Temperature, location.Unit),
+			FeelsLike: convertTemp(current.ApparentTemperature, location.Unit),
+			Humidity:  current.Humidity,
+			Pressure:  int(math.Round(current.Pressure)),
+		},
+		Wind: Wind{
+			Speed: convertSpeed(current.WindSpeed, location.Unit),
+			Deg:   current.WindDirection,
+		},
+		Dt:   int(current.Time),
+		Name: location.Name,
+	}
+
+	if len(res.Daily.Sunrise) > 0 && len(res.Daily.Sunset) > 0 {
+		weather.Sys.Sunrise = int(res.Daily.Sunrise[0])
+		weather.Sys.Sunset = int(res.Daily.Sunset[0])
+	}
+
+	if location.ForecastLength > 0 {
+		weather.Forecast = res.forecast(location)
+	}
+
+	return weather, nil
+}
+
+// metNo the Norwegian Meteorological Institute forecast and sunrise apis. No API key is needed.
+type metNo struct {
+	baseURL string
+}
+
+type metNoDetails struct {
+	AirTemperature float64 `json:"air_temperature"`
+	Humidity       float64 `json:"relative_humidity"`
+	WindSpeed      float64 `json:"wind_speed"`
+	WindDirection  float64 `json:"wind_from_direction"`
+	Pressure       float64 `json:"air_pressure_at_sea_level"`
+}
+
+type metNoSummary struct {
+	SymbolCode string `json:"symbol_code"`
+}
+
+type metNoTimeseries struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		Instant struct {
+			Details metNoDetails `json:"details"`
+		} `json:"instant"`
+		Next1Hours struct {
+			Summary metNoSummary `json:"summary"`
+		} `json:"next_1_hours"`
+		Next6Hours struct {
+			Summary metNoSummary `json:"summary"`
+		} `json:"next_6_hours"`
+	} `json:"data"`
+}
+
+type metNoForecast struct {
+	Properties struct {
+		Timeseries []metNoTimeseries `json:"timeseries"`
+	} `json:"properties"`
+}
+
+type metNoSun struct {
+	Properties struct {
+		Sunrise struct {
+			Time string `json:"time"`
+		} `json:"sunrise"`
+		Sunset struct {
+			Time string `json:"time"`
+		} `json:"sunset"`
+	} `json:"properties"`
+}
+
+// metNoTimeLayout the layout of the times in the sunrise api, which have no seconds
+const metNoTimeLayout = "2006-01-02T15:04Z07:00"
+
+// metNoCoordinate rounds a coordinate to the four decimals Met.no asks for.
+func metNoCoordinate(coordinate string) (string, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(coordinate), 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid coordinate %q: %w", coordinate, err)
+	}
+	return strconv.FormatFloat(value, 'f', 4, 64), nil
+}
+
+// metNoCondition returns the weather data of a Met.no symbol code, e.g. lightrainshowers_day.
+func metNoCondition(symbolCode string) (WeatherData, error) {
+	symbol, _, _ := strings.Cut(symbolCode, "_")
+
+	switch symbol {
+	case "clearsky":
+		return condition(800, "clear sky"), nil
+	case "fair":
+		return condition(801, "fair"), nil
+	case "partlycloudy":
+		return condition(802, "partly cloudy"), nil
+	case "cloudy":
+		return condition(804, "cloudy"), nil
+	case "fog":
+		return condition(741, "fog"), nil
+	}
+
+	// the rest are made up of an intensity, a kind of precipitation, showers and thunder,
+	// e.g. heavysleetshowersandthunder. Met.no spells some light symbols "lights"
+	rest, thunder := strings.CutSuffix(symbol, "andthunder")
+	rest, showers := strings.CutSuffix(rest, "showers")
+
+	rest = strings.Replace(rest, "lightss", "lights", 1)
+
+	intensity := 1
+	words := []string{}
+
+	switch {
+	case strings.HasPrefix(rest, "light"):
+		rest = strings.TrimPrefix(rest, "light")
+		intensity = 0
+		words = append(words, "light")
+	case strings.HasPrefix(rest, "heavy"):
+		rest = strings.TrimPrefix(rest, "heavy")
+		intensity = 2
+		words = append(words, "heavy")
+	}
+
+	var id int
+	switch {
+	case rest == "rain" && showers:
+		id = 520 + intensity
+	case rest == "rain":
+		id = 500 + intensity
+	case rest == "sleet" && showers:
+		id = 613
+	case rest == "sleet":
+		id = 611
+	case rest == "snow" && showers:
+		id = 620 + intensity
+	case rest == "snow":
+		id = 600 + intensity
+	default:
+		return WeatherData{}, fmt.Errorf("unknown symbol code: %q", symbolCode)
+	}
+
+	words = append(words, rest)
+	if showers {
+		words = append(words, "showers")
+	}
+	if thunder {
+		id = 200 + intensity
+		words = append(words, "and thunder")
+	}
+
+	return condition(id, strings.Join(words, " ")), nil
+}
+
+// metNoForecastFor returns the forecast from the timeseries. The timeseries is hourly for the
+// next couple of days and in 6 hour steps after that. Met.no gives no chance of precipitation
+// in its compact forecast.
+func metNoForecastFor(location WeatherLocation, timeseries []metNoTimeseries) []Forecast {
+	hours := make([]Forecast, 0, len(timeseries))
+
+	for _, step := range timeseries {
+		symbolCode := step.Data.Next1Hours.Summary.SymbolCode
+		if symbolCode == "" {
+			if location.ForecastHourly {
+				break
+			}
+			symbolCode = step.Data.Next6Hours.Summary.SymbolCode
+		}
+
+		data, err := metNoCondition(symbolCode)
+		if err != nil {
+			log.Debug("Skipping forecast step", "name", location.Name, "err", err)
+			continue
+		}
+
+		temp := convertTemp(step.Data.Instant.Details.AirTemperature, location.Unit)
+		hours = append(hours, Forecast{
+			Time:                step.Time,
+			Data:                data,
+			High:                temp,
+			Low:                 temp,
+			PrecipitationChance: NoPrecipitationChance,
+		})
+	}
+
+	return forecastFor(location, hours, time.Local)
+}
+
+func (p metNo) Fetch(ctx context.Context, client *http.Client, location WeatherLocation) (Weather, error) {
+
+	lat, err := metNoCoordinate(location.Lat)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	lon, err := metNoCoordinate(location.Lon)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	header := http.Header{}
+	header.Set("User-Agent", metNoUserAgent)
+
+	forecastUrl, err := url.Parse(p.baseURL)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	forecastUrl.Path = "weatherapi/locationforecast/2.0/compact"
+	forecastUrl.RawQuery = url.Values{"lat": {lat}, "lon": {lon}}.Encode()
+
+	var forecast metNoForecast
+	if err := getJSON(ctx, client, forecastUrl.String(), header, &forecast); err != nil {
+		return Weather{}, err
+	}
+
+	if len(forecast.Properties.Timeseries) == 0 {
+		return Weather{}, errors.New("forecast has no timeseries")
+	}
+
+	now := forecast.Properties.Timeseries[0]
+	details := now.Data.Instant.Details
+
+	data, err := metNoCondition(now.Data.Next1Hours.Summary.SymbolCode)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	weather := Weather{
+		Data: []WeatherData{data},
+		Main: Main{
+			Temp:      convertTemp(details.AirTemperature, location.Unit),
+			FeelsLike: convertTemp(details.AirTemperature, location.Unit),
+			Humidity:  int(math.Round(details.Humidity)),
+			Pressure:  int(math.Round(details.Pressure)),
+		},
+		Wind: Wind{
+			Speed: convertSpeed(details.WindSpeed, location.Unit),
+			Deg:   int(math.Round(details.WindDirection)),
+		},
+		Dt:   int(now.Time.Unix()),
+		Name: location.Name,
+	}
+
+	if location.ForecastLength > 0 {
+		weather.Forecast = metNoForecastFor(location, forecast.Properties.Timeseries[1:])
+	}
+
+	sunUrl, err := url.Parse(p.baseURL)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	sunUrl.Path = "weatherapi/sunrise/3.0/sun"
+	sunUrl.RawQuery = url.Values{"lat": {lat}, "lon": {lon}}.Encode()
+
+	// the current weather is still shown without sunrise and sunset when they can not be fetched
+	var sun metNoSun
+	if err := getJSON(ctx, client, sunUrl.String(), header, &sun); err != nil {
+		log.Error("Failed to get sunrise and sunset", "name", location.Name, "err", err)
+		return weather, nil
+	}
+
+	// there is no sunrise or sunset during polar day and night
+	if sunrise, err := time.Parse(metNoTimeLayout, sun.Properties.Sunrise.Time); err == nil {
+		weather.Sys.Sunrise = int(sunrise.Unix())
+	}
+	if sunset, err := time.Parse(metNoTimeLayout, sun.Properties.Sunset.Time); err == nil {
+		weather.Sys.Sunset = int(sunset.Unix())
+	}
+
+	return weather, nil
+}
+
+// jsonProvider a json endpoint of your own, e.g. a home weather station.
+// The API key, if set, is sent as a bearer token.
+type jsonProvider struct{}
+
+// jsonWeather the response expected from the json provider. Temperatures are in the unit of the location
+type jsonWeather struct {
+	Temp        *float64 `json:"temp"`
+	FeelsLike   *float64 `json:"feels_like"`
+	Humidity    int      `json:"humidity"`
+	Condition   string   `json:"condition"`
+	Description string   `json:"description"`
+	Sunrise     int      `json:"sunrise"`
+	Sunset      int      `json:"sunset"`
+	// Forecast the days or hours ahead. The first ForecastLength entries are used
+	Forecast []jsonForecast `json:"forecast"`
+}
+
+// jsonForecast a day or hour of the forecast given by the json provider
+type jsonForecast struct {
+	Time                int64    `json:"time"`
+	Condition           string   `json:"condition"`
+	Description         string   `json:"description"`
+	High                *float64 `json:"high"`
+	Low                 *float64 `json:"low"`
+	PrecipitationChance *int     `json:"precipitation_chance"`
+}
+
+// jsonConditions OpenWeatherMap condition codes of the conditions the json provider accepts
+var jsonConditions = map[string]int{
+	"clear":         800,
+	"partly-cloudy": 802,
+	"clouds":        804,
+	"drizzle":       301,
+	"rain":          501,
+	"showers":       521,
+	"sleet":         611,
+	"snow":          601,
+	"thunderstorm":  211,
+	"mist":          701,
+	"fog":           741,
+	"wind":          771,
+	"tornado":       781,
+}
+
+func (p jsonProvider) Fetch(ctx context.Context, client *http.Client, location WeatherLocation) (Weather, error) {
+
+	header := http.Header{}
+	if location.API != "" {
+		header.Set("Authorization", "Bearer "+location.API)
+	}
+
+	var res jsonWeather
+	if err := getJSON(ctx, client, location.URL, header, &res); err != nil {
+		return Weather{}, err
+	}
+
+	if res.Temp == nil {
+		return Weather{}, errors.New("response is missing temp")
+	}
+
+	data, err := jsonCondition(res.Condition, res.Description)
+	if err != nil {
+		return Weather{}, err
+	}
+
+	feelsLike := *res.Temp
+	if res.FeelsLike != nil {
+		feelsLike = *res.FeelsLike
+	}
+
+	var forecast []Forecast
+
+	for _, entry := range res.Forecast {
+		if len(forecast) == location.ForecastLength {
+			break
+		}
+
+		entryData, err := jsonCondition(entry.Condition, entry.Description)
+		if err != nil || entry.High == nil {
+			log.Debug("Skipping forecast entry", "name", location.Name, "time", entry.Time, "err", err)
+			continue
+		}
+
+		low := *entry.High
+		if entry.Low != nil {
+			low = *entry.Low
+		}
+
+		chance := NoPrecipitationChance
+		if entry.PrecipitationChance != nil {
+			chance = *entry.PrecipitationChance
+		}
+
+		forecast = append(forecast, Forecast{
+			Time:                time.Unix(entry.Time, 0),
+			Data:                entryData,
+			High:                *entry.High,
+			Low:                 low,
+			PrecipitationChance: chance,
+		})
+	}
+
+	return Weather{
+		Data: []WeatherData{data},
+		Main: Main{
+			Temp:      *res.Temp,
+			FeelsLike: feelsLike,
+			Humidity:  res.Humidity,
+		},
+		Sys: Sys{
+			Sunrise: res.Sunrise,
+			Sunset:  res.Sunset,
+		},
+		Dt:       int(time.Now().Unix()),
+		Name:     location.Name,
+		Forecast: forecast,
+	}, nil
+}
+
+// jsonCondition returns the weather data of a condition given by the json provider.
+// The condition is used as the description when there is none.
+func jsonCondition(conditionName, description string) (WeatherData, error) {
+	conditionName = strings.ToLower(strings.TrimSpace(conditionName))
+
+	id, ok := jsonConditions[conditionName]
+	if !ok {
+		return WeatherData{}, fmt.Errorf("unknown condition: %q", conditionName)
+	}
+
+	if description == "" {
+		description = strings.ReplaceAll(conditionName, "-", " ")
+	}
+
+	return condition(id, description), nil
+}
@@ -0,0 +1,324 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newProviderStandIn returns a test server answering the weather provider apis.
+// Requests are checked for the parameters each provider needs.
+func newProviderStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /data/2.5/weather", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") != "owm-key" {
+			http.Error(w, `{"cod": 401}`, http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "metric", r.URL.Query().Get("units"))
+		fmt.Fprint(w, `{
+			"weather": [{"id": 500, "main": "Rain", "description": "light rain", "icon": "10d"}],
+			"main": {"temp": 11.5, "feels_like": 10.2, "humidity": 80},
+			"sys": {"sunrise": 1732087800, "sunset": 1732117800},
+			"name": "London"
+		}`)
+	})
+
+	mux.HandleFunc("GET /v1/forecast", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "51.5285262", r.URL.Query().Get("latitude"))
+		assert.Equal(t, "unixtime", r.URL.Query().Get("timeformat"))
+		fmt.Fprint(w, `{
+			"current": {"time": 1732100400, "temperature_2m": 20, "apparent_temperature": 18, "relative_humidity_2m": 65,
+				"weather_code": 73, "wind_speed_10m": 10, "wind_direction_10m": 270, "pressure_msl": 1012.6},
+			"daily": {"time": [1732060800, 1732147200], "sunrise": [1732087800, 1732174200], "sunset": [1732117800, 1732204200],
+				"weather_code": [73, 61], "temperature_2m_max": [21, 15.5], "temperature_2m_min": [12, 9], "precipitation_probability_max": [80, null]},
+			"hourly": {"time": [1732100400, 1732104000, 1732107600], "temperature_2m": [20, 19, 18],
+				"weather_code": [73, 3, 0], "precipitation_probability": [90, 40, 0]}
+		}`)
+	})
+
+	mux.HandleFunc("GET /weatherapi/locationforecast/2.0/compact", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != metNoUserAgent {
+			http.Error(w, "identify yourself", http.StatusForbidden)
+			return
+		}
+		assert.Equal(t, "51.5285", r.URL.Query().Get("lat"), "Coordinates should be rounded to four decimals")
+		fmt.Fprint(w, `{"properties": {"timeseries": [{
+			"time": "2024-11-20T11:00:00Z",
+			"data": {
+				"instant": {"details": {"air_temperature": 5, "relative_humidity": 91.4, "wind_speed": 4.2,
+					"wind_from_direction": 200.6, "air_pressure_at_sea_level": 1001.2}},
+				"next_1_hours": {"summary": {"symbol_code": "heavyrainshowersandthunder_day"}}
+			}
+		}]}}`)
+	})
+
+	mux.HandleFunc("GET /weatherapi/sunrise/3.0/sun", func(w http.ResponseWriter, r *http.Request) {
+		// a longitude of 0 stands in for the sunrise api being down
+		if r.URL.Query().Get("lon") == "0.0000" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"properties": {"sunrise": {"time": "2024-11-20T07:30+00:00"}, "sunset": {"time": "2024-11-20T15:50+00:00"}}}`)
+	})
+
+	mux.HandleFunc("GET /station.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer station-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"temp": 3.5, "humidity": 70, "condition": "Snow", "sunrise": 1732087800, "sunset": 1732117800,
+			"forecast": [
+				{"time": 1732147200, "condition": "rain", "high": 6, "low": 1, "precipitation_chance": 60},
+				{"time": 1732233600, "condition": "lava", "high": 900},
+				{"time": 1732320000, "condition": "clear", "high": 8}
+			]}`)
+	})
+
+	mux.HandleFunc("GET /broken.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"temperature": 3.5, "condition": "snow"}`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestProviders(t *testing.T) {
+	server := newProviderStandIn(t)
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		provider     Provider
+		location     WeatherLocation
+		wantErr      bool
+		wantID       int
+		wantMain     string
+		wantDesc     string
+		wantTemp     float64
+		wantFeels    float64
+		wantHumidity int
+		wantSunrise  int
+	}{
+		{
+			name:     "OpenWeatherMap",
+			provider: openWeatherMap{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", API: "owm-key", Unit: "metric"},
+			wantID:   500, wantMain: "Rain", wantDesc: "light rain", wantTemp: 11.5, wantFeels: 10.2, wantHumidity: 80, wantSunrise: 1732087800,
+		},
+		{
+			// the stand in has no forecast api, so the forecast fails
+			name:     "OpenWeatherMap without forecast",
+			provider: openWeatherMap{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", API: "owm-key", Unit: "metric", ForecastLength: 3},
+			wantID:   500, wantMain: "Rain", wantDesc: "light rain", wantTemp: 11.5, wantFeels: 10.2, wantHumidity: 80, wantSunrise: 1732087800,
+		},
+		{
+			name:     "OpenWeatherMap wrong key",
+			provider: openWeatherMap{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", API: "wrong", Unit: "metric"},
+			wantErr:  true,
+		},
+		{
+			name:     "Open-Meteo imperial",
+			provider: openMeteo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", Unit: "imperial"},
+			wantID:   601, wantMain: "Snow", wantDesc: "snow", wantTemp: 68, wantFeels: 64.4, wantHumidity: 65, wantSunrise: 1732087800,
+		},
+		{
+			name:     "Met.no",
+			provider: metNo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", Unit: "metric"},
+			wantID:   202, wantMain: "Thunderstorm", wantDesc: "heavy rain showers and thunder", wantTemp: 5, wantFeels: 5, wantHumidity: 91,
+			wantSunrise: int(time.Date(2024, 11, 20, 7, 30, 0, 0, time.UTC).Unix()),
+		},
+		{
+			name:     "Met.no without sunrise",
+			provider: metNo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "0", Unit: "metric"},
+			wantID:   202, wantMain: "Thunderstorm", wantDesc: "heavy rain showers and thunder", wantTemp: 5, wantFeels: 5, wantHumidity: 91,
+		},
+		{
+			name:     "Met.no invalid coordinates",
+			provider: metNo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "north", Lon: "-0.2663999", Unit: "metric"},
+			wantErr:  true,
+		},
+		{
+			name:     "json",
+			provider: jsonProvider{},
+			location: WeatherLocation{Name: "garden", URL: server.URL + "/station.json", API: "station-key", Unit: "metric"},
+			wantID:   601, wantMain: "Snow", wantDesc: "snow", wantTemp: 3.5, wantFeels: 3.5, wantHumidity: 70, wantSunrise: 1732087800,
+		},
+		{
+			name:     "json missing temp",
+			provider: jsonProvider{},
+			location: WeatherLocation{Name: "garden", URL: server.URL + "/broken.json", Unit: "metric"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weather, err := tt.provider.Fetch(context.Background(), server.Client(), tt.location)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if !assert.Len(t, weather.Data, 1) {
+				return
+			}
+
+			assert.Equal(t, tt.wantID, weather.Data[0].ID)
+			assert.Equal(t, tt.wantMain, weather.Data[0].Main)
+			assert.Equal(t, tt.wantDesc, weather.Data[0].Description)
+			assert.InDelta(t, tt.wantTemp, weather.Main.Temp, 0.01)
+			assert.InDelta(t, tt.wantFeels, weather.Main.FeelsLike, 0.01)
+			assert.Equal(t, tt.wantHumidity, weather.Main.Humidity)
+			assert.Equal(t, tt.wantSunrise, weather.Sys.Sunrise)
+		})
+	}
+}
+
+func TestMetNoCondition(t *testing.T) {
+
+	tests := []struct {
+		symbolCode string
+		wantID     int
+		wantDesc   string
+		wantErr    bool
+	}{
+		{symbolCode: "clearsky_night", wantID: 800, wantDesc: "clear sky"},
+		{symbolCode: "cloudy", wantID: 804, wantDesc: "cloudy"},
+		{symbolCode: "lightrain", wantID: 500, wantDesc: "light rain"},
+		{symbolCode: "lightsnow", wantID: 600, wantDesc: "light snow"},
+		{symbolCode: "snowshowers_polartwilight", wantID: 621, wantDesc: "snow showers"},
+		{symbolCode: "lightssleetshowersandthunder_day", wantID: 200, wantDesc: "light sleet showers and thunder"},
+		{symbolCode: "sleet", wantID: 611, wantDesc: "sleet"},
+		{symbolCode: "sandstorm", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbolCode, func(t *testing.T) {
+			data, err := metNoCondition(tt.symbolCode)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantID, data.ID)
+			assert.Equal(t, tt.wantDesc, data.Description)
+		})
+	}
+}
+
+func TestUpdateWeatherUnknownProvider(t *testing.T) {
+	w := &WeatherLocation{Name: "london", Provider: "barometer"}
+
+	_, err := w.updateWeather(context.Background())
+	assert.Error(t, err)
+	assert.True(t, w.Updated.IsZero(), "A failed refresh should not mark the weather as updated")
+}
+
+func TestForecast(t *testing.T) {
+	server := newProviderStandIn(t)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider Provider
+		location WeatherLocation
+		want     []Forecast
+	}{
+		{
+			name:     "Open-Meteo daily",
+			provider: openMeteo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", Unit: "metric", ForecastLength: 2},
+			want: []Forecast{
+				{Time: time.Unix(1732060800, 0), Data: condition(601, "snow"), High: 21, Low: 12, PrecipitationChance: 80},
+				{Time: time.Unix(1732147200, 0), Data: condition(500, "light rain"), High: 15.5, Low: 9, PrecipitationChance: NoPrecipitationChance},
+			},
+		},
+		{
+			name:     "Open-Meteo hourly skips the current hour",
+			provider: openMeteo{baseURL: server.URL},
+			location: WeatherLocation{Name: "london", Lat: "51.5285262", Lon: "-0.2663999", Unit: "metric", ForecastLength: 1, ForecastHourly: true},
+			want: []Forecast{
+				{Time: time.Unix(1732104000, 0), Data: condition(804, "overcast"), High: 19, Low: 19, PrecipitationChance: 40},
+			},
+		},
+		{
+			name:     "json skips unknown conditions",
+			provider: jsonProvider{},
+			location: WeatherLocation{Name: "garden", URL: server.URL + "/station.json", API: "station-key", Unit: "metric", ForecastLength: 2},
+			want: []Forecast{
+				{Time: time.Unix(1732147200, 0), Data: condition(501, "rain"), High: 6, Low: 1, PrecipitationChance: 60},
+				{Time: time.Unix(1732320000, 0), Data: condition(800, "clear"), High: 8, Low: 8, PrecipitationChance: NoPrecipitationChance},
+			},
+		},
+		{
+			name:     "no forecast",
+			provider: jsonProvider{},
+			location: WeatherLocation{Name: "garden", URL: server.URL + "/station.json", API: "station-key", Unit: "metric"},
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weather, err := tt.provider.Fetch(context.Background(), server.Client(), tt.location)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, weather.Forecast)
+		})
+	}
+}
+
+func TestDailyForecast(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+
+	hour := func(day, hour int, temp float64, chance int, data WeatherData) Forecast {
+		return Forecast{
+			Time:                time.Date(2024, 11, day, hour, 0, 0, 0, loc),
+			Data:                data,
+			High:                temp,
+			Low:                 temp,
+			PrecipitationChance: chance,
+		}
+	}
+
+	rain := condition(501, "rain")
+	clearSky := condition(800, "clear sky")
+	snow := condition(601, "snow")
+
+	hours := []Forecast{
+		hour(20, 9, 4, 10, rain),
+		hour(20, 13, 9, 70, clearSky),
+		hour(20, 23, 2, 20, rain),
+		hour(21, 6, -1, NoPrecipitationChance, snow),
+		hour(21, 18, 3, NoPrecipitationChance, rain),
+	}
+
+	days := dailyForecast(hours, loc)
+
+	assert.Equal(t, []Forecast{
+		{Time: time.Date(2024, 11, 20, 0, 0, 0, 0, loc), Data: clearSky, High: 9, Low: 2, PrecipitationChance: 70},
+		{Time: time.Date(2024, 11, 21, 0, 0, 0, 0, loc), Data: snow, High: 3, Low: -1, PrecipitationChance: NoPrecipitationChance},
+	}, days)
+
+	location := WeatherLocation{ForecastLength: 1}
+	assert.Len(t, forecastFor(location, hours, loc), 1, "The forecast should be cut to its length")
+
+	location.ForecastHourly = true
+	assert.Len(t, forecastFor(location, hours, loc), 1, "Hourly forecasts should not be combined into days")
+}